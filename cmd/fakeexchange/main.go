@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"github.com/sefikcan/read-time-trade/pkg/exchangetest"
+	"log"
+	"net/http"
+)
+
+func main() {
+	defaults := exchangetest.DefaultOptions()
+
+	addr := flag.String("addr", "localhost:9443", "address to listen on")
+	seed := flag.Int64("seed", 0, "random seed, 0 uses the current time")
+	interval := flag.Duration("interval", defaults.TradeInterval, "pause between trades per stream")
+	startPrice := flag.Float64("start-price", defaults.StartPrice, "initial price of every symbol")
+	volatility := flag.Float64("volatility", defaults.Volatility, "maximum relative move per trade")
+	burstProbability := flag.Float64("burst-probability", 0, "chance that a tick emits a burst of trades")
+	burstSize := flag.Int("burst-size", defaults.BurstSize, "number of trades in a burst")
+	latency := flag.Duration("latency", 0, "delay added to every frame")
+	malformed := flag.Float64("malformed-probability", 0, "chance that a trade frame is invalid JSON")
+	disconnectAfter := flag.Int("disconnect-after", 0, "close connections after that many trades, 0 never")
+	flag.Parse()
+
+	exchange := exchangetest.New(exchangetest.Options{
+		Seed:                 *seed,
+		TradeInterval:        *interval,
+		StartPrice:           *startPrice,
+		Volatility:           *volatility,
+		BurstProbability:     *burstProbability,
+		BurstSize:            *burstSize,
+		Latency:              *latency,
+		MalformedProbability: *malformed,
+		DisconnectAfter:      *disconnectAfter,
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/ws", exchange)
+
+	log.Printf("Fake exchange listening on ws://%s/ws", *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,59 +1,65 @@
 package main
 
 import (
-	"github.com/opentracing/opentracing-go"
+	"context"
+	"errors"
 	"github.com/sefikcan/read-time-trade/internal/server"
 	"github.com/sefikcan/read-time-trade/pkg/config"
 	"github.com/sefikcan/read-time-trade/pkg/logger"
-	"github.com/uber/jaeger-client-go"
-	jaegerCfg "github.com/uber/jaeger-client-go/config"
-	jaegerLog "github.com/uber/jaeger-client-go/log"
-	"github.com/uber/jaeger-lib/metrics"
-	"io"
+	"github.com/sefikcan/read-time-trade/pkg/tracing"
 	"log"
+	"os"
+	"time"
 )
 
+const tracerShutdownTimeout = 5 * time.Second
+
 func main() {
 	log.Println("Starting api server")
 
-	cfg := config.NewConfig()
+	loader, err := config.NewLoader(os.Args[1:])
+	if errors.Is(err, config.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid command line, nothing was started. %s", err)
+	}
+	if loader.PrintConfigRequested() {
+		if err = loader.PrintConfig(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	log.Printf("Environment: [%s], configuration file: [%s]", loader.Environment(), loader.File())
+	cfg, err := loader.Load()
+	if err != nil {
+		log.Fatalf("Configuration could not be read, nothing was started. %s", err)
+	}
+	if err = cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration, nothing was started. %s", err)
+	}
 
 	zapLogger := logger.NewLogger(cfg)
 	zapLogger.InitLogger()
 	zapLogger.Infof("AppVersion: %s, LogLevel: %s, Mode: %s, SSL: %v", cfg.Server.AppVersion, cfg.Logger.Level, cfg.Server.Mode, false)
 
-	jaegerConfigInstance := jaegerCfg.Configuration{
-		ServiceName: cfg.Metric.ServiceName,
-		Sampler: &jaegerCfg.SamplerConfig{
-			Type:  jaeger.SamplerTypeConst,
-			Param: 1,
-		},
-		Reporter: &jaegerCfg.ReporterConfig{
-			LogSpans:           cfg.Jaeger.LogSpans,
-			LocalAgentHostPort: cfg.Jaeger.Host,
-		},
-	}
-
-	tracer, closer, err := jaegerConfigInstance.NewTracer(
-		jaegerCfg.Logger(jaegerLog.StdLogger),
-		jaegerCfg.Metrics(metrics.NullFactory),
-	)
+	tracerProvider, err := tracing.NewTracerProvider(context.Background(), cfg, zapLogger)
 	if err != nil {
-		log.Fatal("can't create tracer", err)
+		log.Fatal("can't create tracer provider", err)
 	}
-	zapLogger.Info("Jaeger connected")
+	zapLogger.Infof("OpenTelemetry exporting to %s, sampling ratio %v", cfg.Jaeger.Host, cfg.Jaeger.SamplingRatio)
 
-	opentracing.SetGlobalTracer(tracer)
-	defer func(closer io.Closer) {
-		err := closer.Close()
-		if err != nil {
+	s := server.NewServer(cfg, loader, zapLogger)
+	err = s.Run()
 
-		}
-	}(closer)
-	zapLogger.Info("Opentracing connected")
-	
-	s := server.NewServer(cfg, zapLogger)
-	if err = s.Run(); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), tracerShutdownTimeout)
+	defer cancel()
+	if shutdownErr := tracerProvider.Shutdown(ctx); shutdownErr != nil {
+		zapLogger.Errorf("Tracer provider shutdown error: %s", shutdownErr)
+	}
+
+	if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"net/http"
+)
+
+// logLevelRequest changes the global level, or the level of Component when set. An empty Level
+// removes the override of Component.
+type logLevelRequest struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type LogLevelHandler struct {
+	log    logger.Logger
+	levels *logger.Levels
+}
+
+func NewLogLevelHandler(log logger.Logger) *LogLevelHandler {
+	return &LogLevelHandler{
+		log:    log,
+		levels: log.Levels(),
+	}
+}
+
+// Get returns the global level and the component overrides.
+func (h *LogLevelHandler) Get(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.levels.Settings())
+}
+
+// Put changes a level and returns the resulting settings.
+func (h *LogLevelHandler) Put(c echo.Context) error {
+	var request logLevelRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: "invalid request body"})
+	}
+
+	if request.Component != "" && request.Level == "" {
+		h.levels.ResetComponentLevel(request.Component)
+		h.log.InfoCtx(c.Request().Context(), "Log level override removed", "component", request.Component)
+		return c.JSON(http.StatusOK, h.levels.Settings())
+	}
+
+	level, err := logger.ParseLevel(request.Level)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+	}
+
+	if request.Component == "" {
+		h.levels.SetLevel(level)
+	} else {
+		h.levels.SetComponentLevel(request.Component, level)
+	}
+	h.log.InfoCtx(c.Request().Context(), "Log level changed", "component", request.Component, "level", level.String())
+
+	return c.JSON(http.StatusOK, h.levels.Settings())
+}
@@ -0,0 +1,83 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// sharedAddressSpace is the carrier-grade NAT range, as internal as the private ones.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// hostPolicy decides where alerts may be posted, so that a rule cannot make the service call into
+// its own network. With allowed hosts only those are reachable; without, every host whose
+// addresses are all public. The zero policy has no allowed hosts.
+type hostPolicy struct {
+	allowed map[string]bool
+}
+
+func newHostPolicy(hosts []string) hostPolicy {
+	p := hostPolicy{}
+	if len(hosts) > 0 {
+		p.allowed = make(map[string]bool, len(hosts))
+		for _, host := range hosts {
+			p.allowed[strings.ToLower(host)] = true
+		}
+	}
+	return p
+}
+
+// permits checks host against the allowed hosts, if there are any.
+func (p hostPolicy) permits(host string) error {
+	if p.allowed != nil && !p.allowed[strings.ToLower(host)] {
+		return fmt.Errorf("host %s is not an allowed webhook host", host)
+	}
+	return nil
+}
+
+// check refuses a host that is not permitted or, without allowed hosts, that resolves to an
+// address that is not public.
+func (p hostPolicy) check(ctx context.Context, host string) error {
+	if err := p.permits(host); err != nil || p.allowed != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return checkPublic(ip)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if err := checkPublic(addr.IP); err != nil {
+			return fmt.Errorf("host %s: %w", host, err)
+		}
+	}
+	return nil
+}
+
+// control is the net.Dialer Control of the webhook client. It checks the address actually
+// dialed, which a host could change between the checks of a rule and its delivery.
+func (p hostPolicy) control(_, address string, _ syscall.RawConn) error {
+	if p.allowed != nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("dialing %s, not an ip address", address)
+	}
+	return checkPublic(ip)
+}
+
+func checkPublic(ip net.IP) error {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) {
+		return fmt.Errorf("address %s is not public", ip)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package alerts
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// volumeBaselineWindows is how many windows before the current one a volume spike is measured
+// against. A rule alerts only once it has seen them all.
+const volumeBaselineWindows = 10
+
+type trade struct {
+	price      float64
+	quantity   float64
+	at         time.Time
+	buyerMaker bool
+}
+
+// condition is the state of a rule between trades. Every trade costs it constant time, so the
+// trade stream is not slowed down by the number of rules.
+type condition interface {
+	// evaluate takes trade into account and tells whether the rule is met, with the measured
+	// value and a description of it.
+	evaluate(t trade) (value float64, message string, met bool)
+}
+
+func newCondition(rule Rule) condition {
+	window := time.Duration(rule.Window) * time.Second
+	switch rule.Type {
+	case PriceCross:
+		return &priceCross{rule: rule}
+	case PercentMove:
+		return &percentMove{rule: rule, window: window}
+	case VolumeSpike:
+		return &volumeSpike{rule: rule, window: window.Milliseconds()}
+	default:
+		return &spreadWidening{rule: rule, window: window}
+	}
+}
+
+type priceCross struct {
+	rule Rule
+	last float64
+}
+
+func (c *priceCross) evaluate(t trade) (float64, string, bool) {
+	last := c.last
+	c.last = t.price
+	if last == 0 {
+		return 0, "", false
+	}
+
+	level := c.rule.Level
+	if last < level && t.price >= level && c.rule.Direction != "below" {
+		return t.price, fmt.Sprintf("%s crossed above %v at %v", c.rule.Symbol, level, t.price), true
+	}
+	if last > level && t.price <= level && c.rule.Direction != "above" {
+		return t.price, fmt.Sprintf("%s crossed below %v at %v", c.rule.Symbol, level, t.price), true
+	}
+	return 0, "", false
+}
+
+type timedPrice struct {
+	price float64
+	at    time.Time
+}
+
+// percentMove keeps the lowest and highest price of the window as monotonic queues: every price
+// is pushed and popped at most once, whatever the trade rate.
+type percentMove struct {
+	rule   Rule
+	window time.Duration
+	lows   []timedPrice
+	highs  []timedPrice
+}
+
+func (c *percentMove) evaluate(t trade) (float64, string, bool) {
+	for len(c.lows) > 0 && c.lows[len(c.lows)-1].price >= t.price {
+		c.lows = c.lows[:len(c.lows)-1]
+	}
+	c.lows = append(c.lows, timedPrice{price: t.price, at: t.at})
+	for len(c.highs) > 0 && c.highs[len(c.highs)-1].price <= t.price {
+		c.highs = c.highs[:len(c.highs)-1]
+	}
+	c.highs = append(c.highs, timedPrice{price: t.price, at: t.at})
+
+	since := t.at.Add(-c.window)
+	for c.lows[0].at.Before(since) {
+		c.lows = c.lows[1:]
+	}
+	for c.highs[0].at.Before(since) {
+		c.highs = c.highs[1:]
+	}
+
+	window := windowLabel(c.rule.Window)
+	if up := (t.price - c.lows[0].price) / c.lows[0].price * 100; up >= c.rule.Percent && c.rule.Direction != "down" {
+		return up, fmt.Sprintf("%s rose %.2f%% within %s to %v", c.rule.Symbol, up, window, t.price), true
+	}
+	if down := (c.highs[0].price - t.price) / c.highs[0].price * 100; down >= c.rule.Percent && c.rule.Direction != "up" {
+		return -down, fmt.Sprintf("%s fell %.2f%% within %s to %v", c.rule.Symbol, down, window, t.price), true
+	}
+	return 0, "", false
+}
+
+// volumeSpike sums the volume of windows aligned to the unix epoch and keeps the sums of the
+// windows before the current one in a ring.
+type volumeSpike struct {
+	rule    Rule
+	window  int64
+	index   int64
+	current float64
+	history [volumeBaselineWindows]float64
+	next    int
+	filled  int
+	total   float64
+}
+
+func (c *volumeSpike) evaluate(t trade) (float64, string, bool) {
+	index := t.at.UnixMilli() / c.window
+	if index < c.index {
+		return 0, "", false
+	}
+	if c.index != 0 && index > c.index {
+		// Windows without trades count with no volume, and a gap longer than the baseline
+		// replaces all of it.
+		for i := int64(0); i < index-c.index && i < volumeBaselineWindows; i++ {
+			c.push(c.current)
+			c.current = 0
+		}
+	}
+	if index > c.index {
+		c.index, c.current = index, 0
+	}
+	c.current += t.quantity
+
+	if c.filled < volumeBaselineWindows || c.total <= 0 {
+		return 0, "", false
+	}
+	average := c.total / volumeBaselineWindows
+	ratio := c.current / average
+	if ratio < c.rule.Factor {
+		return 0, "", false
+	}
+	return ratio, fmt.Sprintf("%s traded %.2fx its average volume within %s", c.rule.Symbol, ratio, windowLabel(c.rule.Window)), true
+}
+
+func (c *volumeSpike) push(volume float64) {
+	c.total += volume - c.history[c.next]
+	c.history[c.next] = volume
+	c.next = (c.next + 1) % volumeBaselineWindows
+	if c.filled < volumeBaselineWindows {
+		c.filled++
+	}
+}
+
+// spreadWidening estimates the spread from the aggressor side of the trades: a trade where the
+// buyer was the maker hit the bid, any other lifted the ask.
+type spreadWidening struct {
+	rule   Rule
+	window time.Duration
+	bid    timedPrice
+	ask    timedPrice
+}
+
+func (c *spreadWidening) evaluate(t trade) (float64, string, bool) {
+	if t.buyerMaker {
+		c.bid = timedPrice{price: t.price, at: t.at}
+	} else {
+		c.ask = timedPrice{price: t.price, at: t.at}
+	}
+	if c.bid.price == 0 || c.ask.price == 0 {
+		return 0, "", false
+	}
+	if apart := c.bid.at.Sub(c.ask.at); apart > c.window || apart < -c.window {
+		return 0, "", false
+	}
+
+	mid := (c.bid.price + c.ask.price) / 2
+	bps := math.Max(c.ask.price-c.bid.price, 0) / mid * 10000
+	if bps < c.rule.Bps {
+		return 0, "", false
+	}
+	return bps, fmt.Sprintf("%s spread widened to %.1f bps (bid %v, ask %v)", c.rule.Symbol, bps, c.bid.price, c.ask.price), true
+}
+
+// windowLabel names a window of seconds, e.g. 30s, 5m or 1h.
+func windowLabel(seconds int64) string {
+	switch {
+	case seconds%3600 == 0:
+		return fmt.Sprintf("%dh", seconds/3600)
+	case seconds%60 == 0:
+		return fmt.Sprintf("%dm", seconds/60)
+	default:
+		return fmt.Sprintf("%ds", seconds)
+	}
+}
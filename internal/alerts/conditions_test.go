@@ -0,0 +1,132 @@
+package alerts
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// tick is a trade of a test, at seconds after start.
+type tick struct {
+	seconds    float64
+	price      float64
+	quantity   float64
+	buyerMaker bool
+}
+
+func (k tick) trade() trade {
+	quantity := k.quantity
+	if quantity == 0 {
+		quantity = 1
+	}
+	return trade{
+		price:      k.price,
+		quantity:   quantity,
+		at:         start.Add(time.Duration(k.seconds * float64(time.Second))),
+		buyerMaker: k.buyerMaker,
+	}
+}
+
+func TestConditions(t *testing.T) {
+	cases := []struct {
+		name  string
+		rule  Rule
+		ticks []tick
+		// met lists the ticks that meet the rule, with the value measured at each.
+		met map[int]float64
+	}{
+		{
+			name:  "price crosses above",
+			rule:  Rule{Type: PriceCross, Level: 100, Direction: "above"},
+			ticks: []tick{{0, 99, 0, false}, {1, 100, 0, false}, {2, 101, 0, false}, {3, 99, 0, false}, {4, 102, 0, false}},
+			met:   map[int]float64{1: 100, 4: 102},
+		},
+		{
+			name:  "price crosses either way",
+			rule:  Rule{Type: PriceCross, Level: 100},
+			ticks: []tick{{0, 101, 0, false}, {1, 99, 0, false}, {2, 98, 0, false}, {3, 100.5, 0, false}},
+			met:   map[int]float64{1: 99, 3: 100.5},
+		},
+		{
+			name:  "price starting at the level does not cross",
+			rule:  Rule{Type: PriceCross, Level: 100},
+			ticks: []tick{{0, 100, 0, false}, {1, 100, 0, false}},
+		},
+		{
+			name:  "percent move up from the low of the window",
+			rule:  Rule{Type: PercentMove, Percent: 2, Window: 60, Direction: "up"},
+			ticks: []tick{{0, 100, 0, false}, {10, 98, 0, false}, {20, 99, 0, false}, {30, 100, 0, false}, {40, 95, 0, false}},
+			met:   map[int]float64{3: 100.0 * 2 / 98},
+		},
+		{
+			name: "percent move ignores prices older than the window",
+			rule: Rule{Type: PercentMove, Percent: 2, Window: 60},
+			// The low of 98 is out of the window when 100 trades.
+			ticks: []tick{{0, 98, 0, false}, {30, 99, 0, false}, {61, 100, 0, false}},
+		},
+		{
+			name:  "percent move down from the high of the window",
+			rule:  Rule{Type: PercentMove, Percent: 5, Window: 60, Direction: "down"},
+			ticks: []tick{{0, 100, 0, false}, {10, 110, 0, false}, {20, 104, 0, false}, {30, 105, 0, false}},
+			met:   map[int]float64{2: -100.0 * 6 / 110},
+		},
+		{
+			name: "volume spike over the average of the windows before",
+			rule: Rule{Type: VolumeSpike, Factor: 3, Window: 10},
+			// Ten windows of volume 2, then 5 and 7 in the eleventh.
+			ticks: append(volumeBaseline(2), tick{100, 1, 5, false}, tick{105, 1, 2, false}),
+			met:   map[int]float64{11: 3.5},
+		},
+		{
+			name: "volume spike waits for the whole baseline",
+			rule: Rule{Type: VolumeSpike, Factor: 3, Window: 10},
+			// The first window has no windows before it.
+			ticks: []tick{{0, 1, 1, false}, {10, 1, 100, false}},
+		},
+		{
+			name: "volume spike counts windows without trades",
+			rule: Rule{Type: VolumeSpike, Factor: 3, Window: 10},
+			// Ten windows of volume 10 then four empty ones: the baseline averages 6.
+			ticks: append(volumeBaseline(10), tick{140, 1, 17, false}, tick{141, 1, 1, false}),
+			met:   map[int]float64{11: 3},
+		},
+		{
+			name: "spread from the last bid and ask",
+			rule: Rule{Type: SpreadWidening, Bps: 9.5, Window: 5},
+			ticks: []tick{
+				{0, 100, 0, true}, {1, 100.05, 0, false},
+				{2, 99.95, 0, true},
+				// The ask is 10 seconds older than the bid.
+				{12, 99.9, 0, true},
+			},
+			met: map[int]float64{2: 0.1 / 100 * 10000},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.rule.Symbol = "BTCUSDT"
+			condition := newCondition(c.rule)
+			for i, k := range c.ticks {
+				value, message, met := condition.evaluate(k.trade())
+				want, wantMet := c.met[i]
+				if met != wantMet {
+					t.Fatalf("tick %d: met %v, want %v (%s)", i, met, wantMet, message)
+				}
+				if met && fmt.Sprintf("%.6f", value) != fmt.Sprintf("%.6f", want) {
+					t.Errorf("tick %d: value %v, want %v", i, value, want)
+				}
+			}
+		})
+	}
+}
+
+// volumeBaseline returns a trade of quantity in each of the first ten windows of ten seconds.
+func volumeBaseline(quantity float64) []tick {
+	var ticks []tick
+	for i := 0; i < volumeBaselineWindows; i++ {
+		ticks = append(ticks, tick{float64(i * 10), 1, quantity, false})
+	}
+	return ticks
+}
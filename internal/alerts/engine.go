@@ -0,0 +1,345 @@
+package alerts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/sefikcan/read-time-trade/internal/trades"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// alertQueueSize bounds the alerts waiting for delivery. When webhooks fall that far behind,
+	// new alerts are dropped rather than holding up the trade stream.
+	alertQueueSize  = 1024
+	deliveryWorkers = 4
+	// persistInterval is how often the times of the last alerts are saved.
+	persistInterval = time.Second
+)
+
+// Alert is the body posted to the webhook of a rule. Value is what the rule measured: the price,
+// the percent move, the volume ratio or the spread in basis points; Threshold the setting it
+// reached. Times are unix milliseconds.
+type Alert struct {
+	Id        string   `json:"id"`
+	RuleId    string   `json:"ruleId"`
+	Symbol    string   `json:"symbol"`
+	Type      RuleType `json:"type"`
+	Message   string   `json:"message"`
+	Price     float64  `json:"price"`
+	Value     float64  `json:"value"`
+	Threshold float64  `json:"threshold"`
+	TradeTime int64    `json:"tradeTime"`
+	Time      int64    `json:"time"`
+	webhook   string
+}
+
+type ruleState struct {
+	rule      Rule
+	condition condition
+}
+
+// Engine evaluates the alert rules of a symbol against each of its trades and delivers the
+// alerts to the webhooks of the rules.
+type Engine struct {
+	log      logger.Logger
+	cooldown time.Duration
+	store    *store
+	notifier *notifier
+	alerts   chan Alert
+	// done is closed when Run returns.
+	done chan struct{}
+
+	// persistMu serialises saves, so that the last snapshot taken is the one saved last.
+	persistMu sync.Mutex
+
+	mu      sync.Mutex
+	rules   map[string]*ruleState
+	symbols map[string][]*ruleState
+	// dirty is set when the rules changed since they were last saved.
+	dirty bool
+}
+
+// NewEngine loads the stored rules.
+func NewEngine(log logger.Logger, cfg *config.Config) (*Engine, error) {
+	e := &Engine{
+		log:      log.Named("alerts"),
+		cooldown: cfg.Alerts.Cooldown * time.Second,
+		store:    newStore(cfg.Alerts.StorePath),
+		notifier: newNotifier(cfg.Alerts.Webhook),
+		alerts:   make(chan Alert, alertQueueSize),
+		done:     make(chan struct{}),
+		rules:    make(map[string]*ruleState),
+		symbols:  make(map[string][]*ruleState),
+	}
+
+	rules, err := e.store.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		e.add(rule)
+	}
+	e.log.Infow("Alert rules loaded", "rules", len(rules), "path", cfg.Alerts.StorePath)
+	return e, nil
+}
+
+// Add evaluates the rules of the symbol of a trade. It is called by the listener for every new
+// trade.
+func (e *Engine) Add(trade trades.Ticker) {
+	price, err := strconv.ParseFloat(trade.Price, 64)
+	if err != nil || price <= 0 {
+		return
+	}
+	quantity, err := strconv.ParseFloat(trade.Quantity, 64)
+	if err != nil || quantity < 0 {
+		return
+	}
+	t := tradeOf(price, quantity, trade)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	for _, state := range e.symbols[trade.Symbol] {
+		// Rules in their cooldown are evaluated all the same, to keep their state current.
+		value, message, met := state.condition.evaluate(t)
+		if !met || e.coolingDown(state.rule, now) {
+			continue
+		}
+		alert := Alert{
+			Id:        newId(),
+			RuleId:    state.rule.Id,
+			Symbol:    trade.Symbol,
+			Type:      state.rule.Type,
+			Message:   message,
+			Price:     price,
+			Value:     value,
+			Threshold: state.rule.threshold(),
+			TradeTime: trade.Time,
+			Time:      now.UnixMilli(),
+			webhook:   state.rule.Webhook,
+		}
+		select {
+		case e.alerts <- alert:
+			// A dropped alert does not start the cooldown, the next trade meeting the rule alerts.
+			state.rule.LastAlertAt = now.UnixMilli()
+			e.dirty = true
+		default:
+			e.log.Warnw("Dropping alert, the delivery queue is full", "rule", alert.RuleId, logger.FieldSymbol, alert.Symbol, "message", alert.Message)
+		}
+	}
+}
+
+func tradeOf(price, quantity float64, ticker trades.Ticker) trade {
+	return trade{price: price, quantity: quantity, at: time.UnixMilli(ticker.Time), buyerMaker: ticker.BuyerMaker}
+}
+
+func (e *Engine) coolingDown(rule Rule, now time.Time) bool {
+	cooldown := e.cooldown
+	if rule.Cooldown > 0 {
+		cooldown = time.Duration(rule.Cooldown) * time.Second
+	}
+	return rule.LastAlertAt != 0 && now.Sub(time.UnixMilli(rule.LastAlertAt)) < cooldown
+}
+
+// CheckWebhook refuses the webhook of a validated rule when alerts may not be posted to its host.
+func (e *Engine) CheckWebhook(ctx context.Context, webhook string) error {
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return err
+	}
+	if err := e.notifier.policy.check(ctx, u.Hostname()); err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	return nil
+}
+
+// Create stores a validated rule under a new id and starts evaluating it.
+func (e *Engine) Create(rule Rule) (Rule, error) {
+	rule.Id = newId()
+	rule.CreatedAt = time.Now().UnixMilli()
+	rule.LastAlertAt = 0
+
+	e.mu.Lock()
+	e.add(rule)
+	e.dirty = true
+	e.mu.Unlock()
+
+	if err := e.persist(); err != nil {
+		e.mu.Lock()
+		e.remove(rule.Id)
+		e.mu.Unlock()
+		return Rule{}, err
+	}
+	e.log.Infow("Alert rule created", "rule", rule.Id, logger.FieldSymbol, rule.Symbol, "type", rule.Type)
+	return rule, nil
+}
+
+// Delete removes a rule, and returns false when there is none with id.
+func (e *Engine) Delete(id string) (bool, error) {
+	e.mu.Lock()
+	ok := e.remove(id)
+	e.dirty = e.dirty || ok
+	e.mu.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+	e.log.Infow("Alert rule deleted", "rule", id)
+	return true, e.persist()
+}
+
+func (e *Engine) Get(id string) (Rule, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	state, ok := e.rules[id]
+	if !ok {
+		return Rule{}, false
+	}
+	return state.rule, true
+}
+
+// List returns all rules, oldest first.
+func (e *Engine) List() []Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.list()
+}
+
+func (e *Engine) list() []Rule {
+	rules := make([]Rule, 0, len(e.rules))
+	for _, state := range e.rules {
+		rules = append(rules, state.rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].CreatedAt != rules[j].CreatedAt {
+			return rules[i].CreatedAt < rules[j].CreatedAt
+		}
+		return rules[i].Id < rules[j].Id
+	})
+	return rules
+}
+
+func (e *Engine) add(rule Rule) {
+	state := &ruleState{rule: rule, condition: newCondition(rule)}
+	e.rules[rule.Id] = state
+	e.symbols[rule.Symbol] = append(e.symbols[rule.Symbol], state)
+}
+
+func (e *Engine) remove(id string) bool {
+	state, ok := e.rules[id]
+	if !ok {
+		return false
+	}
+	delete(e.rules, id)
+
+	states := e.symbols[state.rule.Symbol]
+	for i := range states {
+		if states[i] == state {
+			e.symbols[state.rule.Symbol] = append(states[:i:i], states[i+1:]...)
+			break
+		}
+	}
+	if len(e.symbols[state.rule.Symbol]) == 0 {
+		delete(e.symbols, state.rule.Symbol)
+	}
+	return true
+}
+
+// persist saves the rules when they changed. On failure they stay dirty, so the next save
+// retries.
+func (e *Engine) persist() error {
+	e.persistMu.Lock()
+	defer e.persistMu.Unlock()
+
+	e.mu.Lock()
+	if !e.dirty {
+		e.mu.Unlock()
+		return nil
+	}
+	rules := e.list()
+	e.dirty = false
+	e.mu.Unlock()
+
+	if err := e.store.save(rules); err != nil {
+		e.mu.Lock()
+		e.dirty = true
+		e.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Run delivers the alerts and saves the times of the last alerts until ctx is done. Alerts still
+// queued then are not delivered.
+func (e *Engine) Run(ctx context.Context) error {
+	defer close(e.done)
+
+	var wg sync.WaitGroup
+	for i := 0; i < deliveryWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.deliver(ctx)
+		}()
+	}
+
+	ticker := time.NewTicker(persistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return e.persist()
+		case <-ticker.C:
+			if err := e.persist(); err != nil {
+				e.log.Errorw("Saving alert rules failed", logger.FieldError, err)
+			}
+		}
+	}
+}
+
+// Close waits for Run to deliver the alerts in flight and save the rules, or for ctx to expire.
+func (e *Engine) Close(ctx context.Context) error {
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *Engine) deliver(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alert := <-e.alerts:
+			attempts, err := e.notifier.send(ctx, alert)
+			if err != nil {
+				if ctx.Err() == nil {
+					e.log.Errorw("Delivering alert failed", logger.FieldError, err, "alert", alert.Id, "rule", alert.RuleId, "attempts", attempts)
+				}
+				continue
+			}
+			e.log.Infow("Alert delivered", "alert", alert.Id, "rule", alert.RuleId, logger.FieldSymbol, alert.Symbol, "message", alert.Message, "attempts", attempts)
+		}
+	}
+}
+
+func newId() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
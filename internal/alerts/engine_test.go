@@ -0,0 +1,90 @@
+package alerts
+
+import (
+	"github.com/sefikcan/read-time-trade/internal/trades"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestEngine(t *testing.T) *Engine {
+	t.Helper()
+	cfg := &config.Config{
+		Logger: config.LoggerConfig{Level: "error", Encoding: "json"},
+		Alerts: config.AlertsConfig{
+			Enabled:   true,
+			StorePath: filepath.Join(t.TempDir(), "alerts.json"),
+			Cooldown:  300,
+			Webhook:   config.WebhookConfig{Secret: testSecret, Timeout: 1, MaxAttempts: 1},
+		},
+	}
+	log := logger.NewLogger(cfg)
+	log.InitLogger()
+	e, err := NewEngine(log, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func priceTrade(price float64) trades.Ticker {
+	return trades.Ticker{Symbol: "BTCUSDT", Price: strconv.FormatFloat(price, 'f', -1, 64), Quantity: "1", Time: time.Now().UnixMilli()}
+}
+
+// crossings alternates the price around 100, crossing it on every trade after the first.
+func crossings(e *Engine, n int) {
+	for i := 0; i <= n; i++ {
+		e.Add(priceTrade(99 + float64(i%2)*2))
+	}
+}
+
+func TestEngineCooldown(t *testing.T) {
+	e := newTestEngine(t)
+	rule, err := e.Create(Rule{Symbol: "BTCUSDT", Type: PriceCross, Level: 100, Webhook: "http://localhost/alerts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crossings(e, 3)
+	if len(e.alerts) != 1 {
+		t.Fatalf("%d alerts queued, want 1 within the cooldown", len(e.alerts))
+	}
+	if got, _ := e.Get(rule.Id); got.LastAlertAt == 0 {
+		t.Error("the alert did not start the cooldown")
+	}
+
+	// Rules are reloaded with the time of their last alert.
+	if err := e.persist(); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := e.store.load()
+	if err != nil || len(rules) != 1 || rules[0].LastAlertAt == 0 {
+		t.Errorf("stored %+v, %v, want the rule with its last alert", rules, err)
+	}
+}
+
+func TestEngineDroppedAlertsKeepNoCooldown(t *testing.T) {
+	e := newTestEngine(t)
+	rule, err := e.Create(Rule{Symbol: "BTCUSDT", Type: PriceCross, Level: 100, Webhook: "http://localhost/alerts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < alertQueueSize; i++ {
+		e.alerts <- Alert{}
+	}
+
+	crossings(e, 1)
+	if got, _ := e.Get(rule.Id); got.LastAlertAt != 0 {
+		t.Fatal("a dropped alert started the cooldown")
+	}
+
+	// Once the queue has room, the next crossing alerts.
+	<-e.alerts
+	crossings(e, 1)
+	if got, _ := e.Get(rule.Id); got.LastAlertAt == 0 {
+		t.Error("the queued alert did not start the cooldown")
+	}
+}
@@ -0,0 +1,67 @@
+package alerts
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+)
+
+type rulesResponse struct {
+	Rules []Rule `json:"rules"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type Handler struct {
+	engine *Engine
+}
+
+func NewHandler(engine *Engine) *Handler {
+	return &Handler{engine: engine}
+}
+
+// Create creates the alert rule of the request body. Id and times are set by the service.
+func (h *Handler) Create(c echo.Context) error {
+	var rule Rule
+	if err := c.Bind(&rule); err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: "invalid rule: " + err.Error()})
+	}
+	rule.Symbol = strings.ToUpper(rule.Symbol)
+	if err := rule.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: strings.ReplaceAll(err.Error(), "\n", "; ")})
+	}
+	if err := h.engine.CheckWebhook(c.Request().Context(), rule.Webhook); err != nil {
+		return c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+	}
+
+	created, err := h.engine.Create(rule)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse{Error: "saving the rule failed: " + err.Error()})
+	}
+	return c.JSON(http.StatusCreated, created)
+}
+
+func (h *Handler) List(c echo.Context) error {
+	return c.JSON(http.StatusOK, rulesResponse{Rules: h.engine.List()})
+}
+
+func (h *Handler) Get(c echo.Context) error {
+	rule, ok := h.engine.Get(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, errorResponse{Error: "no alert rule " + c.Param("id")})
+	}
+	return c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) Delete(c echo.Context) error {
+	ok, err := h.engine.Delete(c.Param("id"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, errorResponse{Error: "no alert rule " + c.Param("id")})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, errorResponse{Error: "saving the rules failed: " + err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,40 @@
+package alerts
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerCreateChecksTheWebhook(t *testing.T) {
+	cases := []struct {
+		webhook string
+		want    int
+	}{
+		{"https://93.184.216.34/alerts", http.StatusCreated},
+		{"http://127.0.0.1:8080/alerts", http.StatusBadRequest},
+		{"http://169.254.169.254/latest/meta-data", http.StatusBadRequest},
+		{"http://localhost/alerts", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		t.Run(c.webhook, func(t *testing.T) {
+			e := newTestEngine(t)
+			body := `{"symbol":"btcusdt","type":"price-cross","level":100,"webhook":"` + c.webhook + `"}`
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/alerts", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+
+			if err := NewHandler(e).Create(echo.New().NewContext(req, rec)); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != c.want {
+				t.Errorf("status %d, want %d: %s", rec.Code, c.want, rec.Body)
+			}
+			if rules := e.List(); (len(rules) == 1) != (c.want == http.StatusCreated) {
+				t.Errorf("%d rules stored", len(rules))
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type RuleType string
+
+const (
+	// PriceCross alerts when the price crosses Level, in Direction above or below.
+	PriceCross RuleType = "price-cross"
+	// PercentMove alerts when the price moved Percent from the lowest or highest price of the last
+	// Window seconds, in Direction up or down.
+	PercentMove RuleType = "percent-move"
+	// VolumeSpike alerts when the volume of the current Window seconds reaches Factor times the
+	// average volume of the windows before it.
+	VolumeSpike RuleType = "volume-spike"
+	// SpreadWidening alerts when the spread reaches Bps basis points of the mid price. The trade
+	// stream carries no quotes, so the spread is estimated from the last trade that hit the bid and
+	// the last trade that lifted the ask, when they are at most Window seconds apart.
+	SpreadWidening RuleType = "spread-widening"
+)
+
+var symbolPattern = regexp.MustCompile(`^[A-Z0-9]{2,20}$`)
+
+// Rule is an alert rule as created through the API and kept in the store. Window and Cooldown
+// are seconds, the times unix milliseconds.
+type Rule struct {
+	Id        string   `json:"id"`
+	Symbol    string   `json:"symbol"`
+	Type      RuleType `json:"type"`
+	Direction string   `json:"direction,omitempty"`
+	Level     float64  `json:"level,omitempty"`
+	Percent   float64  `json:"percent,omitempty"`
+	Factor    float64  `json:"factor,omitempty"`
+	Bps       float64  `json:"bps,omitempty"`
+	Window    int64    `json:"window,omitempty"`
+	// Cooldown is the least time between two alerts of the rule, the configured cooldown when 0.
+	Cooldown    int64  `json:"cooldown,omitempty"`
+	Webhook     string `json:"webhook"`
+	CreatedAt   int64  `json:"createdAt"`
+	LastAlertAt int64  `json:"lastAlertAt,omitempty"`
+}
+
+// Validate checks the settings of the rule type, and only those: a rule sets nothing it does
+// not use.
+func (r Rule) Validate() error {
+	var errs []error
+
+	if !symbolPattern.MatchString(r.Symbol) {
+		errs = append(errs, fmt.Errorf("symbol: must be 2 to 20 letters or digits, got %q", r.Symbol))
+	}
+	if r.Cooldown < 0 {
+		errs = append(errs, fmt.Errorf("cooldown: must not be negative"))
+	}
+	if u, err := url.Parse(r.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("webhook: must be an http or https url, got %q", r.Webhook))
+	}
+
+	var directions []string
+	var window, level, percent, factor, bps bool
+	switch r.Type {
+	case PriceCross:
+		directions, level = []string{"above", "below"}, true
+	case PercentMove:
+		directions, window, percent = []string{"up", "down"}, true, true
+	case VolumeSpike:
+		window, factor = true, true
+	case SpreadWidening:
+		window, bps = true, true
+	default:
+		errs = append(errs, fmt.Errorf("type: must be one of %s, %s, %s or %s, got %q", PriceCross, PercentMove, VolumeSpike, SpreadWidening, r.Type))
+		return errors.Join(errs...)
+	}
+
+	if r.Direction != "" && !contains(directions, r.Direction) {
+		if len(directions) == 0 {
+			errs = append(errs, fmt.Errorf("direction: not used by %s", r.Type))
+		} else {
+			errs = append(errs, fmt.Errorf("direction: must be %s or empty for either, got %q", strings.Join(directions, " or "), r.Direction))
+		}
+	}
+	errs = append(errs, validateSetting("level", r.Level, level, r.Type))
+	errs = append(errs, validateSetting("percent", r.Percent, percent, r.Type))
+	errs = append(errs, validateSetting("factor", r.Factor, factor, r.Type))
+	errs = append(errs, validateSetting("bps", r.Bps, bps, r.Type))
+	errs = append(errs, validateSetting("window", float64(r.Window), window, r.Type))
+	if factor && r.Factor > 0 && r.Factor <= 1 {
+		errs = append(errs, fmt.Errorf("factor: must be above 1"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// threshold returns the setting that makes the rule alert.
+func (r Rule) threshold() float64 {
+	switch r.Type {
+	case PriceCross:
+		return r.Level
+	case PercentMove:
+		return r.Percent
+	case VolumeSpike:
+		return r.Factor
+	default:
+		return r.Bps
+	}
+}
+
+// validateSetting checks that a setting is positive when the rule type uses it, and not set when
+// it does not.
+func validateSetting(field string, value float64, used bool, ruleType RuleType) error {
+	if used && value <= 0 {
+		return fmt.Errorf("%s: must be positive for %s", field, ruleType)
+	}
+	if !used && value != 0 {
+		return fmt.Errorf("%s: not used by %s", field, ruleType)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
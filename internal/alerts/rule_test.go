@@ -0,0 +1,70 @@
+package alerts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRuleValidate(t *testing.T) {
+	valid := func(ruleType RuleType) Rule {
+		rule := Rule{Symbol: "BTCUSDT", Type: ruleType, Webhook: "https://hooks.example.com/alerts"}
+		switch ruleType {
+		case PriceCross:
+			rule.Level = 30000
+		case PercentMove:
+			rule.Percent, rule.Window = 2, 300
+		case VolumeSpike:
+			rule.Factor, rule.Window = 3, 60
+		case SpreadWidening:
+			rule.Bps, rule.Window = 10, 5
+		}
+		return rule
+	}
+
+	cases := []struct {
+		name  string
+		rule  func() Rule
+		wants []string
+	}{
+		{"price cross", func() Rule { return valid(PriceCross) }, nil},
+		{"price cross above", func() Rule { r := valid(PriceCross); r.Direction = "above"; return r }, nil},
+		{"percent move down", func() Rule { r := valid(PercentMove); r.Direction = "down"; return r }, nil},
+		{"volume spike", func() Rule { return valid(VolumeSpike) }, nil},
+		{"spread widening with cooldown", func() Rule { r := valid(SpreadWidening); r.Cooldown = 60; return r }, nil},
+		{"lowercase symbol", func() Rule { r := valid(PriceCross); r.Symbol = "btcusdt"; return r }, []string{"symbol: must be"}},
+		{"negative cooldown", func() Rule { r := valid(PriceCross); r.Cooldown = -1; return r }, []string{"cooldown: must not be negative"}},
+		{"webhook without scheme", func() Rule { r := valid(PriceCross); r.Webhook = "hooks.example.com"; return r }, []string{"webhook: must be"}},
+		{"webhook of another scheme", func() Rule { r := valid(PriceCross); r.Webhook = "ftp://hooks.example.com"; return r }, []string{"webhook: must be"}},
+		{"unknown type", func() Rule { r := valid(PriceCross); r.Type = "price"; return r }, []string{"type: must be one of"}},
+		{"direction of another type", func() Rule { r := valid(PriceCross); r.Direction = "up"; return r }, []string{"direction: must be above or below"}},
+		{"direction of volume spike", func() Rule { r := valid(VolumeSpike); r.Direction = "up"; return r }, []string{"direction: not used by volume-spike"}},
+		{"missing level", func() Rule { r := valid(PriceCross); r.Level = 0; return r }, []string{"level: must be positive for price-cross"}},
+		{"setting of another type", func() Rule { r := valid(PriceCross); r.Window = 60; return r }, []string{"window: not used by price-cross"}},
+		{"negative percent", func() Rule { r := valid(PercentMove); r.Percent = -2; return r }, []string{"percent: must be positive"}},
+		{"factor of 1", func() Rule { r := valid(VolumeSpike); r.Factor = 1; return r }, []string{"factor: must be above 1"}},
+		{
+			"several errors",
+			func() Rule { return Rule{Symbol: "B", Type: SpreadWidening, Webhook: "x", Level: 1} },
+			[]string{"symbol: must be", "webhook: must be", "level: not used by spread-widening", "bps: must be positive", "window: must be positive"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.rule().Validate()
+			if len(c.wants) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("got no error, want %q", c.wants)
+			}
+			for _, want := range c.wants {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
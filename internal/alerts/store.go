@@ -0,0 +1,59 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// store keeps the rules in a JSON file. The file is replaced as a whole through a rename, so a
+// crash leaves either the old or the new rules. Saves must not run concurrently.
+type store struct {
+	path string
+}
+
+func newStore(path string) *store {
+	return &store{path: path}
+}
+
+// load returns the stored rules, none when the file does not exist yet.
+func (s *store) load() ([]Rule, error) {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (s *store) save(rules []Rule) error {
+	if rules == nil {
+		rules = []Rule{}
+	}
+	b, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
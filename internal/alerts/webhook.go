@@ -0,0 +1,149 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Webhook request headers. The signature is "sha256=" and the hex HMAC-SHA256 of the timestamp,
+// a dot and the body, keyed with the webhook secret. Receivers should reject stale timestamps
+// and deduplicate retries by the alert id.
+const (
+	HeaderAlertId   = "X-Alert-Id"
+	HeaderTimestamp = "X-Alert-Timestamp"
+	HeaderSignature = "X-Alert-Signature"
+
+	userAgent = "real-time-trade-alerts"
+)
+
+// notifier posts alerts to webhooks, retrying network errors, 429 and 5xx responses with
+// exponential backoff.
+type notifier struct {
+	client       *http.Client
+	policy       hostPolicy
+	secret       []byte
+	maxAttempts  int
+	retryBackoff time.Duration
+}
+
+// newNotifier dials webhooks directly, never through a proxy, and checks every address it dials
+// against the host policy. Redirects are not followed, as they could lead anywhere.
+func newNotifier(cfg config.WebhookConfig) *notifier {
+	policy := newHostPolicy(cfg.AllowedHosts)
+	dialer := &net.Dialer{Timeout: cfg.Timeout * time.Second, Control: policy.control}
+	return &notifier{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: cfg.Timeout * time.Second,
+				MaxIdleConns:        10,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+			Timeout: cfg.Timeout * time.Second,
+		},
+		policy:       policy,
+		secret:       []byte(cfg.Secret),
+		maxAttempts:  cfg.MaxAttempts,
+		retryBackoff: cfg.RetryBackoff * time.Second,
+	}
+}
+
+// webhookError is an unexpected response status of a webhook.
+type webhookError struct {
+	status int
+	body   string
+}
+
+func (e *webhookError) Error() string {
+	return fmt.Sprintf("webhook responded %d: %s", e.status, e.body)
+}
+
+func (e *webhookError) retryable() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= http.StatusInternalServerError
+}
+
+// send delivers alert and returns the number of attempts it took.
+func (n *notifier) send(ctx context.Context, alert Alert) (int, error) {
+	u, err := url.Parse(alert.webhook)
+	if err != nil {
+		return 0, err
+	}
+	// Rules stored before the allowed hosts changed may point elsewhere.
+	if err := n.policy.permits(u.Hostname()); err != nil {
+		return 0, err
+	}
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return 0, err
+	}
+
+	backoff := n.retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := n.post(ctx, alert, body)
+		if err == nil {
+			return attempt, nil
+		}
+		var status *webhookError
+		if (errors.As(err, &status) && !status.retryable()) || attempt >= n.maxAttempts {
+			return attempt, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (n *notifier) post(ctx context.Context, alert Alert, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, alert.webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	// Every attempt is signed anew, so that a retry is not rejected as stale.
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderAlertId, alert.Id)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, "sha256="+n.sign(timestamp, body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &webhookError{status: resp.StatusCode, body: string(bytes.TrimSpace(b))}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (n *notifier) sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, n.secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,213 @@
+package alerts
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "webhook-secret"
+
+// receiver is a webhook that verifies the signature of every request and responds with the next
+// of statuses, 200 once they ran out.
+type receiver struct {
+	t        *testing.T
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	alerts   []Alert
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*receiver, *httptest.Server) {
+	r := &receiver{t: t, statuses: statuses}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return r, server
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		r.t.Error(err)
+		return
+	}
+
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(req.Header.Get(HeaderTimestamp) + "."))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); !hmac.Equal([]byte(req.Header.Get(HeaderSignature)), []byte(want)) {
+		r.t.Errorf("signature %q, want %q", req.Header.Get(HeaderSignature), want)
+	}
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil || time.Since(time.Unix(timestamp, 0)) > time.Minute {
+		r.t.Errorf("stale or invalid timestamp %q", req.Header.Get(HeaderTimestamp))
+	}
+	var alert Alert
+	if err := json.Unmarshal(body, &alert); err != nil {
+		r.t.Errorf("body %s: %v", body, err)
+	}
+
+	r.mu.Lock()
+	r.requests = append(r.requests, req)
+	r.alerts = append(r.alerts, alert)
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	r.mu.Unlock()
+
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte("status " + strconv.Itoa(status)))
+}
+
+func testNotifier() *notifier {
+	return &notifier{
+		client:       &http.Client{Timeout: time.Second},
+		secret:       []byte(testSecret),
+		maxAttempts:  3,
+		retryBackoff: time.Millisecond,
+	}
+}
+
+func testAlert(webhook string) Alert {
+	return Alert{Id: "a1", RuleId: "r1", Symbol: "BTCUSDT", Type: PriceCross, Message: "BTCUSDT crossed above 100 at 101", Price: 101, Value: 101, Threshold: 100, webhook: webhook}
+}
+
+func TestNotifierSignsAlerts(t *testing.T) {
+	r, server := newReceiver(t)
+
+	attempts, err := testNotifier().send(context.Background(), testAlert(server.URL))
+	if err != nil || attempts != 1 {
+		t.Fatalf("got %d attempts, %v, want 1 attempt", attempts, err)
+	}
+	req := r.requests[0]
+	if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" || req.Header.Get(HeaderAlertId) != "a1" {
+		t.Errorf("unexpected request %s with headers %v", req.Method, req.Header)
+	}
+	if got, want := r.alerts[0], testAlert(""); got != want {
+		t.Errorf("received %+v, want %+v", got, want)
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+	cases := []struct {
+		name     string
+		statuses []int
+		attempts int
+		wantErr  bool
+	}{
+		{"until delivered", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, 3, false},
+		{"up to max attempts", []int{500, 502, 503, 504}, 3, true},
+		{"not on client errors", []int{http.StatusBadRequest}, 1, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, server := newReceiver(t, c.statuses...)
+
+			attempts, err := testNotifier().send(context.Background(), testAlert(server.URL))
+			if attempts != c.attempts || len(r.requests) != c.attempts {
+				t.Errorf("got %d attempts and %d requests, want %d", attempts, len(r.requests), c.attempts)
+			}
+			var status *webhookError
+			if c.wantErr != (err != nil) || (err != nil && !errors.As(err, &status)) {
+				t.Fatalf("got error %v, want one %v", err, c.wantErr)
+			}
+			// Every attempt is the same alert.
+			for _, alert := range r.alerts {
+				if alert.Id != "a1" {
+					t.Errorf("attempt with alert %q", alert.Id)
+				}
+			}
+		})
+	}
+}
+
+func TestNotifierStopsRetryingWhenCancelled(t *testing.T) {
+	_, server := newReceiver(t, 503, 503, 503)
+	n := testNotifier()
+	n.retryBackoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	attempts, err := n.send(ctx, testAlert(server.URL))
+	if err == nil || attempts != 1 {
+		t.Errorf("got %d attempts, %v, want a failed attempt", attempts, err)
+	}
+}
+
+func TestHostPolicyCheck(t *testing.T) {
+	cases := []struct {
+		name    string
+		allowed []string
+		host    string
+		ok      bool
+	}{
+		{"public address", nil, "93.184.216.34", true},
+		{"public ipv6 address", nil, "2606:4700::1111", true},
+		{"loopback", nil, "127.0.0.1", false},
+		{"loopback ipv6", nil, "::1", false},
+		{"host of a loopback address", nil, "localhost", false},
+		{"private", nil, "10.1.2.3", false},
+		{"link-local", nil, "169.254.169.254", false},
+		{"unspecified", nil, "0.0.0.0", false},
+		{"shared address space", nil, "100.64.0.1", false},
+		{"allowed host", []string{"hooks.example.com"}, "HOOKS.example.com", true},
+		{"allowed internal host", []string{"127.0.0.1"}, "127.0.0.1", true},
+		{"host not allowed", []string{"hooks.example.com"}, "93.184.216.34", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := newHostPolicy(c.allowed).check(context.Background(), c.host)
+			if (err == nil) != c.ok {
+				t.Errorf("check %s: %v, want allowed %v", c.host, err, c.ok)
+			}
+		})
+	}
+}
+
+// The notifier checks the address it dials, whatever the rule was checked against.
+func TestNotifierRefusesInternalAddresses(t *testing.T) {
+	r, server := newReceiver(t)
+	n := newNotifier(config.WebhookConfig{Secret: testSecret, Timeout: 1, MaxAttempts: 1})
+	if _, err := n.send(context.Background(), testAlert(server.URL)); err == nil {
+		t.Error("delivered to a loopback address")
+	}
+
+	allowed := newNotifier(config.WebhookConfig{Secret: testSecret, Timeout: 1, MaxAttempts: 1, AllowedHosts: []string{"127.0.0.1"}})
+	if _, err := allowed.send(context.Background(), testAlert(server.URL)); err != nil {
+		t.Errorf("allowed host: %v", err)
+	}
+	if _, err := allowed.send(context.Background(), testAlert("http://localhost/alerts")); err == nil {
+		t.Error("delivered to a host that is not allowed")
+	}
+	if len(r.requests) != 1 {
+		t.Errorf("%d requests, want 1", len(r.requests))
+	}
+}
+
+func TestNotifierDoesNotFollowRedirects(t *testing.T) {
+	target, targetServer := newReceiver(t)
+	redirect := httptest.NewServer(http.RedirectHandler(targetServer.URL, http.StatusFound))
+	t.Cleanup(redirect.Close)
+
+	n := newNotifier(config.WebhookConfig{Secret: testSecret, Timeout: 1, MaxAttempts: 3, AllowedHosts: []string{"127.0.0.1"}})
+	attempts, err := n.send(context.Background(), testAlert(redirect.URL))
+	var status *webhookError
+	if !errors.As(err, &status) || status.status != http.StatusFound || attempts != 1 {
+		t.Errorf("got %v after %d attempts, want the redirect once", err, attempts)
+	}
+	if len(target.requests) != 0 {
+		t.Error("followed the redirect")
+	}
+}
@@ -0,0 +1,118 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"github.com/sefikcan/read-time-trade/pkg/kafka"
+	"time"
+)
+
+// ConnectionState is the view of a trade listener the checks need.
+type ConnectionState interface {
+	Connected() bool
+	DisconnectedSince() time.Time
+	LastTrades() map[string]time.Time
+	RecorderErr() error
+}
+
+// ErrorRater reports the share of recently failed operations.
+type ErrorRater interface {
+	ErrorRate() float64
+}
+
+// ListenerAlive is down once the listener has been without a connection for longer than
+// maxDisconnected, i.e. it is stuck reconnecting and a restart may help.
+func ListenerAlive(listener ConnectionState, maxDisconnected time.Duration) Check {
+	return func(context.Context) Result {
+		if listener.Connected() {
+			return up(nil)
+		}
+
+		since := listener.DisconnectedSince()
+		details := map[string]interface{}{"disconnectedFor": time.Since(since).String()}
+		if maxDisconnected > 0 && time.Since(since) > maxDisconnected {
+			return down("exchange connection lost for too long", details)
+		}
+		return up(details)
+	}
+}
+
+// ExchangeConnection is down while the listener has no subscribed WebSocket connection.
+func ExchangeConnection(listener ConnectionState) Check {
+	return func(context.Context) Result {
+		if !listener.Connected() {
+			return down("not connected to the exchange", map[string]interface{}{
+				"disconnectedSince": listener.DisconnectedSince(),
+			})
+		}
+		return up(nil)
+	}
+}
+
+// TradeFreshness reports the age of the latest trade of every symbol. Quiet symbols are only
+// flagged as stale; the check is down when no symbol traded within maxAge.
+func TradeFreshness(listener ConnectionState, maxAge time.Duration) Check {
+	return func(context.Context) Result {
+		details := make(map[string]interface{})
+		fresh := 0
+		for symbol, at := range listener.LastTrades() {
+			if at.IsZero() {
+				details[symbol] = "no trades yet"
+				continue
+			}
+
+			age := time.Since(at)
+			if maxAge > 0 && age > maxAge {
+				details[symbol] = fmt.Sprintf("stale, last trade %s ago", age.Round(time.Millisecond))
+				continue
+			}
+			details[symbol] = age.Round(time.Millisecond).String()
+			fresh++
+		}
+
+		if maxAge > 0 && fresh == 0 && len(details) > 0 {
+			return down(fmt.Sprintf("no trades within %s", maxAge), details)
+		}
+		return up(details)
+	}
+}
+
+// KafkaBroker dials the first configured broker.
+func KafkaBroker(cfg *config.Config) Check {
+	return func(ctx context.Context) Result {
+		if len(cfg.Kafka.Brokers) == 0 {
+			return down("no kafka brokers configured", nil)
+		}
+
+		conn, err := kafka.NewKafkaConn(ctx, cfg)
+		if err != nil {
+			return down(err.Error(), map[string]interface{}{"broker": cfg.Kafka.Brokers[0]})
+		}
+		_ = conn.Close()
+		return up(map[string]interface{}{"broker": cfg.Kafka.Brokers[0]})
+	}
+}
+
+// ProducerErrors is down when the recent publish error rate exceeds maxErrorRate.
+func ProducerErrors(producer ErrorRater, maxErrorRate float64) Check {
+	return func(context.Context) Result {
+		rate := producer.ErrorRate()
+		details := map[string]interface{}{"errorRate": rate}
+		if rate > maxErrorRate {
+			return down(fmt.Sprintf("publish error rate %.2f above %.2f", rate, maxErrorRate), details)
+		}
+		return up(details)
+	}
+}
+
+// CaptureStorage is down when the last write to the capture file failed.
+func CaptureStorage(listener ConnectionState, path string) Check {
+	return func(context.Context) Result {
+		details := map[string]interface{}{"path": path}
+		if err := listener.RecorderErr(); err != nil {
+			return down(err.Error(), details)
+		}
+		return up(details)
+	}
+}
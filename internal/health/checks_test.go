@@ -0,0 +1,205 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sefikcan/read-time-trade/internal/trades"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"github.com/sefikcan/read-time-trade/pkg/exchangetest"
+	kafkaClient "github.com/sefikcan/read-time-trade/pkg/kafka"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/sefikcan/read-time-trade/pkg/metric"
+	"github.com/segmentio/kafka-go"
+	"net"
+	"testing"
+	"time"
+)
+
+const waitTimeout = 5 * time.Second
+
+// stubProducer publishes nothing and reports errorRate.
+type stubProducer struct {
+	errorRate float64
+}
+
+func (p *stubProducer) PublishMessage(context.Context, ...kafka.Message) error { return nil }
+
+func (p *stubProducer) ErrorRate() float64 { return p.errorRate }
+
+func (p *stubProducer) Stats() kafka.WriterStats { return kafka.WriterStats{} }
+
+func (p *stubProducer) Close() error { return nil }
+
+// stubState is a listener that only failed to record.
+type stubState struct {
+	recorderErr error
+}
+
+func (s stubState) Connected() bool                  { return true }
+func (s stubState) DisconnectedSince() time.Time     { return time.Time{} }
+func (s stubState) LastTrades() map[string]time.Time { return nil }
+func (s stubState) RecorderErr() error               { return s.recorderErr }
+
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// startListener streams the trades of the fake exchange until the test ends.
+func startListener(t *testing.T, exchange *exchangetest.Server, symbols ...string) trades.TradeListener {
+	t.Helper()
+	cfg := &config.Config{
+		Logger:   config.LoggerConfig{Level: "error", Encoding: "json"},
+		Exchange: config.ExchangeConfig{Url: exchange.URL()},
+		Kafka:    config.KafkaConfig{Format: kafkaClient.FormatJson, TopicStrategy: "shared"},
+		Metric:   config.MetricConfig{ServiceName: "health-test"},
+	}
+	log := logger.NewLogger(cfg)
+	log.InitLogger()
+	serializer, err := kafkaClient.NewSerializer(cfg.Kafka)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := metric.CreateMetrics(prometheus.NewRegistry(), cfg.Metric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := trades.NewTradeListener(log, cfg, &stubProducer{}, serializer, metrics, trades.DefaultFailurePolicy(), symbols)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = listener.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		stopCtx, stop := context.WithTimeout(context.Background(), waitTimeout)
+		defer stop()
+		_ = listener.Stop(stopCtx)
+	})
+	return listener
+}
+
+func TestListenerChecks(t *testing.T) {
+	exchange := exchangetest.NewServer(exchangetest.Options{Seed: 1, TradeInterval: 5 * time.Millisecond, StartPrice: 100, Volatility: 0.001})
+	t.Cleanup(exchange.Close)
+	listener := startListener(t, exchange, "btcusdt", "ethusdt")
+	ctx := context.Background()
+
+	eventually(t, "trades of both symbols", func() bool {
+		result := TradeFreshness(listener, time.Minute)(ctx)
+		return result.Status == StatusUp && result.Details["BTCUSDT"] != "no trades yet" && result.Details["ETHUSDT"] != "no trades yet"
+	})
+	if result := ListenerAlive(listener, time.Millisecond)(ctx); result.Status != StatusUp {
+		t.Errorf("liveness of a connected listener %+v", result)
+	}
+	if result := ExchangeConnection(listener)(ctx); result.Status != StatusUp {
+		t.Errorf("exchange connection of a connected listener %+v", result)
+	}
+
+	exchange.Close()
+	eventually(t, "the disconnect", func() bool { return !listener.Connected() })
+	time.Sleep(20 * time.Millisecond)
+
+	if result := ExchangeConnection(listener)(ctx); result.Status != StatusDown {
+		t.Errorf("exchange connection of a disconnected listener %+v", result)
+	}
+	if result := ListenerAlive(listener, time.Minute)(ctx); result.Status != StatusUp {
+		t.Errorf("liveness of a listener disconnected for less than the limit %+v", result)
+	}
+	if result := ListenerAlive(listener, 10*time.Millisecond)(ctx); result.Status != StatusDown {
+		t.Errorf("liveness of a listener disconnected for longer than the limit %+v", result)
+	}
+	if result := TradeFreshness(listener, 10*time.Millisecond)(ctx); result.Status != StatusDown {
+		t.Errorf("freshness without recent trades %+v", result)
+	}
+	if result := TradeFreshness(listener, 0)(ctx); result.Status != StatusUp {
+		t.Errorf("freshness without a limit %+v", result)
+	}
+}
+
+// A listener is not ready before the first trade of any symbol.
+func TestTradeFreshnessBeforeTheFirstTrades(t *testing.T) {
+	exchange := exchangetest.NewServer(exchangetest.Options{Seed: 1, TradeInterval: time.Hour})
+	t.Cleanup(exchange.Close)
+	listener := startListener(t, exchange, "btcusdt")
+
+	result := TradeFreshness(listener, time.Minute)(context.Background())
+	if result.Status != StatusDown || result.Details["BTCUSDT"] != "no trades yet" {
+		t.Errorf("freshness %+v", result)
+	}
+}
+
+func TestKafkaBroker(t *testing.T) {
+	broker, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = broker.Close() })
+	go func() {
+		for {
+			conn, err := broker.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = closed.Close()
+
+	cases := []struct {
+		name    string
+		brokers []string
+		want    Status
+	}{
+		{"reachable", []string{broker.Addr().String()}, StatusUp},
+		{"unreachable", []string{closed.Addr().String()}, StatusDown},
+		{"none configured", nil, StatusDown},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := &config.Config{Kafka: config.KafkaConfig{Brokers: c.brokers}}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if result := KafkaBroker(cfg)(ctx); result.Status != c.want {
+				t.Errorf("got %+v, want %s", result, c.want)
+			}
+		})
+	}
+}
+
+func TestProducerErrors(t *testing.T) {
+	cases := []struct {
+		rate float64
+		want Status
+	}{
+		{0, StatusUp},
+		{0.5, StatusUp},
+		{0.51, StatusDown},
+		{1, StatusDown},
+	}
+	for _, c := range cases {
+		result := ProducerErrors(&stubProducer{errorRate: c.rate}, 0.5)(context.Background())
+		if result.Status != c.want || result.Details["errorRate"] != c.rate {
+			t.Errorf("error rate %v: got %+v, want %s", c.rate, result, c.want)
+		}
+	}
+}
+
+func TestCaptureStorage(t *testing.T) {
+	if result := CaptureStorage(stubState{}, "capture.gz")(context.Background()); result.Status != StatusUp {
+		t.Errorf("without write errors %+v", result)
+	}
+	result := CaptureStorage(stubState{recorderErr: errors.New("disk full")}, "capture.gz")(context.Background())
+	if result.Status != StatusDown || result.Error != "disk full" || result.Details["path"] != "capture.gz" {
+		t.Errorf("after a write error %+v", result)
+	}
+}
@@ -0,0 +1,122 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// Result is the outcome of a single check. Details carry check specific data for operators.
+type Result struct {
+	Status  Status                 `json:"status"`
+	Error   string                 `json:"error,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Check inspects one dependency. It must return within the deadline of ctx.
+type Check func(ctx context.Context) Result
+
+// Report is the aggregated outcome of a probe: down as soon as any check is down.
+type Report struct {
+	Status    Status            `json:"status"`
+	CheckedAt time.Time         `json:"checkedAt"`
+	Checks    map[string]Result `json:"checks"`
+}
+
+// Health holds the liveness and readiness checks of the service.
+type Health struct {
+	timeout   time.Duration
+	liveness  map[string]Check
+	readiness map[string]Check
+}
+
+func NewHealth(timeout time.Duration) *Health {
+	return &Health{
+		timeout:   timeout,
+		liveness:  make(map[string]Check),
+		readiness: make(map[string]Check),
+	}
+}
+
+// AddLiveness registers a check whose failure means the process should be restarted.
+func (h *Health) AddLiveness(name string, check Check) {
+	h.liveness[name] = check
+}
+
+// AddReadiness registers a check whose failure means the process should not receive traffic.
+func (h *Health) AddReadiness(name string, check Check) {
+	h.readiness[name] = check
+}
+
+func (h *Health) Live(ctx context.Context) Report {
+	return h.run(ctx, h.liveness)
+}
+
+func (h *Health) Ready(ctx context.Context) Report {
+	return h.run(ctx, h.readiness)
+}
+
+func (h *Health) run(ctx context.Context, checks map[string]Check) Report {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	report := Report{
+		Status:    StatusUp,
+		CheckedAt: time.Now(),
+		Checks:    make(map[string]Result, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			result := check(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusUp {
+				report.Status = StatusDown
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// Handler serves the report of probe, with status 200 when it is up and 503 when it is down.
+func Handler(probe func(ctx context.Context) Report) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := probe(r.Context())
+		status := http.StatusOK
+		if report.Status != StatusUp {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(report)
+	}
+}
+
+func up(details map[string]interface{}) Result {
+	return Result{Status: StatusUp, Details: details}
+}
+
+func down(err string, details map[string]interface{}) Result {
+	return Result{Status: StatusDown, Error: err, Details: details}
+}
@@ -0,0 +1,81 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func constant(result Result) Check {
+	return func(context.Context) Result {
+		return result
+	}
+}
+
+func TestHandler(t *testing.T) {
+	cases := []struct {
+		name   string
+		checks map[string]Check
+		want   int
+	}{
+		{"no checks", nil, http.StatusOK},
+		{"all up", map[string]Check{"a": constant(up(nil)), "b": constant(up(nil))}, http.StatusOK},
+		{"one down", map[string]Check{"a": constant(up(nil)), "b": constant(down("broken", nil))}, http.StatusServiceUnavailable},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := NewHealth(time.Second)
+			for name, check := range c.checks {
+				h.AddReadiness(name, check)
+			}
+			rec := httptest.NewRecorder()
+			Handler(h.Ready).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/health/ready", nil))
+
+			if rec.Code != c.want {
+				t.Errorf("status %d, want %d", rec.Code, c.want)
+			}
+			var report Report
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatalf("body %s: %v", rec.Body, err)
+			}
+			if len(report.Checks) != len(c.checks) || (report.Status == StatusUp) != (c.want == http.StatusOK) {
+				t.Errorf("report %+v", report)
+			}
+		})
+	}
+}
+
+// Liveness and readiness run their own checks.
+func TestHealthProbes(t *testing.T) {
+	h := NewHealth(time.Second)
+	h.AddLiveness("live", constant(up(nil)))
+	h.AddReadiness("ready", constant(down("not yet", nil)))
+
+	if report := h.Live(context.Background()); report.Status != StatusUp || len(report.Checks) != 1 {
+		t.Errorf("liveness %+v", report)
+	}
+	report := h.Ready(context.Background())
+	if report.Status != StatusDown || report.Checks["ready"].Error != "not yet" {
+		t.Errorf("readiness %+v", report)
+	}
+}
+
+// A check is given the probe timeout as its deadline.
+func TestHealthTimeout(t *testing.T) {
+	h := NewHealth(20 * time.Millisecond)
+	h.AddReadiness("slow", func(ctx context.Context) Result {
+		<-ctx.Done()
+		return down(ctx.Err().Error(), nil)
+	})
+
+	start := time.Now()
+	if report := h.Ready(context.Background()); report.Status != StatusDown {
+		t.Errorf("readiness %+v, want down", report)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("probe took %s", elapsed)
+	}
+}
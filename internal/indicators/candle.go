@@ -0,0 +1,55 @@
+package indicators
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// Candle aggregates the trades of a symbol over one interval. Times are unix milliseconds, the
+// close time exclusive, and intervals align to the unix epoch.
+type Candle struct {
+	OpenTime  int64   `json:"openTime"`
+	CloseTime int64   `json:"closeTime"`
+	Open      float64 `json:"open"`
+	High      float64 `json:"high"`
+	Low       float64 `json:"low"`
+	Close     float64 `json:"close"`
+	Volume    float64 `json:"volume"`
+	Trades    int64   `json:"trades"`
+}
+
+func newCandle(interval time.Duration, price float64, at time.Time) *Candle {
+	openTime := at.Truncate(interval).UnixMilli()
+	return &Candle{
+		OpenTime:  openTime,
+		CloseTime: openTime + interval.Milliseconds(),
+		Open:      price,
+		High:      price,
+		Low:       price,
+		Close:     price,
+	}
+}
+
+func (c *Candle) add(price, quantity float64) {
+	c.High = math.Max(c.High, price)
+	c.Low = math.Min(c.Low, price)
+	c.Close = price
+	c.Volume += quantity
+	c.Trades++
+}
+
+// intervalLabel names an interval the way exchanges do, e.g. 1m, 15m, 4h or 1d.
+func intervalLabel(interval time.Duration) string {
+	const day = 24 * time.Hour
+	switch {
+	case interval%day == 0:
+		return strconv.FormatInt(int64(interval/day), 10) + "d"
+	case interval%time.Hour == 0:
+		return strconv.FormatInt(int64(interval/time.Hour), 10) + "h"
+	case interval%time.Minute == 0:
+		return strconv.FormatInt(int64(interval/time.Minute), 10) + "m"
+	default:
+		return strconv.FormatInt(int64(interval/time.Second), 10) + "s"
+	}
+}
@@ -0,0 +1,217 @@
+package indicators
+
+import (
+	"context"
+	"github.com/sefikcan/read-time-trade/internal/trades"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	kafkaClient "github.com/sefikcan/read-time-trade/pkg/kafka"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/segmentio/kafka-go"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// lateTradeDelay is how long after its close time a candle still takes trades, unless a later
+	// trade of the symbol finalizes it first.
+	lateTradeDelay = 2 * time.Second
+	expireInterval = time.Second
+	// maxPending bounds the values kept while publishing fails; the oldest are dropped first.
+	maxPending = 10000
+)
+
+// Engine builds the candles of every traded symbol for the configured intervals and publishes
+// the indicators of each finalized candle to the indicators stream.
+type Engine struct {
+	log        logger.Logger
+	cfg        config.IndicatorsConfig
+	producer   kafkaClient.Producer
+	serializer kafkaClient.Serializer
+	topics     *kafkaClient.TopicNamer
+	host       string
+	// done is closed when Run returns.
+	done chan struct{}
+
+	mu      sync.Mutex
+	symbols map[string][]*series
+	// pending are the finalized values not published yet.
+	pending []Values
+}
+
+func NewEngine(log logger.Logger, cfg *config.Config, producer kafkaClient.Producer, serializer kafkaClient.Serializer) *Engine {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return &Engine{
+		log:        log.Named("indicators"),
+		cfg:        cfg.Indicators,
+		producer:   producer,
+		serializer: serializer,
+		topics:     kafkaClient.NewTopicNamer(cfg.Kafka),
+		host:       host,
+		done:       make(chan struct{}),
+		symbols:    make(map[string][]*series),
+	}
+}
+
+// Add counts a trade into the candles of its symbol. It is called by the listener for every new
+// trade.
+func (e *Engine) Add(trade trades.Ticker) {
+	price, err := strconv.ParseFloat(trade.Price, 64)
+	if err != nil || price <= 0 {
+		e.log.Debugw("Ignoring trade without a valid price", logger.FieldSymbol, trade.Symbol, "price", trade.Price)
+		return
+	}
+	quantity, err := strconv.ParseFloat(trade.Quantity, 64)
+	if err != nil || quantity < 0 {
+		e.log.Debugw("Ignoring trade without a valid quantity", logger.FieldSymbol, trade.Symbol, "quantity", trade.Quantity)
+		return
+	}
+	at := time.UnixMilli(trade.Time)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	all, ok := e.symbols[trade.Symbol]
+	if !ok {
+		for _, interval := range e.intervals(trade.Symbol) {
+			all = append(all, newSeries(e.cfg, trade.Symbol, interval*time.Second))
+		}
+		e.symbols[trade.Symbol] = all
+	}
+	for _, s := range all {
+		late := s.late
+		if values, ok := s.add(price, quantity, at); ok {
+			e.pending = append(e.pending, values)
+		}
+		if s.late > late {
+			e.log.Debugw("Dropping late trade", logger.FieldSymbol, trade.Symbol, "interval", s.label, "time", trade.Time, "dropped", s.late)
+		}
+	}
+}
+
+// intervals returns the candle intervals of symbol in seconds.
+func (e *Engine) intervals(symbol string) []time.Duration {
+	if intervals, ok := e.cfg.Symbols[strings.ToLower(symbol)]; ok {
+		return intervals
+	}
+	return e.cfg.Intervals
+}
+
+// Latest returns the values of the last finalized candle of symbol for every interval, or only
+// for interval when it is not empty.
+func (e *Engine) Latest(symbol, interval string) []Values {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var latest []Values
+	for _, s := range e.symbols[strings.ToUpper(symbol)] {
+		if s.latest != nil && (interval == "" || interval == s.label) {
+			latest = append(latest, *s.latest)
+		}
+	}
+	return latest
+}
+
+// Run finalizes the candles of symbols without new trades and publishes the finalized values
+// until ctx is done.
+func (e *Engine) Run(ctx context.Context) error {
+	defer close(e.done)
+
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			if err := e.flush(ctx, now); err != nil && ctx.Err() == nil {
+				e.log.Errorw("Publishing indicators failed, retrying with the next ones", logger.FieldError, err)
+			}
+		}
+	}
+}
+
+// Close waits for Run to return, so that nothing is published after the Kafka producer closes, or for
+// ctx to expire.
+func (e *Engine) Close(ctx context.Context) error {
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// flush publishes the pending values. Values that fail to publish stay pending.
+func (e *Engine) flush(ctx context.Context, now time.Time) error {
+	pending := e.expire(now)
+	if err := e.publish(ctx, pending, now); err != nil {
+		e.requeue(pending)
+		return err
+	}
+	return nil
+}
+
+// expire finalizes the candles past their close time and takes all pending values.
+func (e *Engine) expire(now time.Time) []Values {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, all := range e.symbols {
+		for _, s := range all {
+			if values, ok := s.expire(now, lateTradeDelay); ok {
+				e.pending = append(e.pending, values)
+			}
+		}
+	}
+	pending := e.pending
+	e.pending = nil
+	return pending
+}
+
+// requeue puts values back ahead of those finalized since they were taken, keeping their order.
+func (e *Engine) requeue(values []Values) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.pending = append(values, e.pending...)
+	if dropped := len(e.pending) - maxPending; dropped > 0 {
+		e.log.Warnw("Dropping unpublished indicators", "dropped", dropped)
+		e.pending = e.pending[dropped:]
+	}
+}
+
+func (e *Engine) publish(ctx context.Context, pending []Values, now time.Time) error {
+	messages := make([]kafka.Message, 0, len(pending))
+	for _, values := range pending {
+		topic := e.topics.Topic(trades.ExchangeName, kafkaClient.StreamIndicators, values.Symbol)
+		value, err := e.serializer.Serialize(ctx, topic, values)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, kafka.Message{
+			Topic: topic,
+			Key:   []byte(values.Symbol),
+			Value: value,
+			Headers: kafkaClient.Provenance{
+				Exchange:      trades.ExchangeName,
+				Stream:        kafkaClient.StreamIndicators,
+				Format:        e.serializer.Format(),
+				SchemaVersion: valuesSchema.Version,
+				IngestHost:    e.host,
+				IngestTime:    now,
+			}.Headers(),
+		})
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return e.producer.PublishMessage(ctx, messages...)
+}
@@ -0,0 +1,124 @@
+package indicators
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/sefikcan/read-time-trade/internal/trades"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	kafkaClient "github.com/sefikcan/read-time-trade/pkg/kafka"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/segmentio/kafka-go"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var errBroker = errors.New("broker unavailable")
+
+// fakeProducer keeps the published messages, or fails while err is set.
+type fakeProducer struct {
+	err      error
+	messages []kafka.Message
+}
+
+func (p *fakeProducer) PublishMessage(_ context.Context, messages ...kafka.Message) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, messages...)
+	return nil
+}
+
+func (p *fakeProducer) ErrorRate() float64 { return 0 }
+
+func (p *fakeProducer) Stats() kafka.WriterStats { return kafka.WriterStats{} }
+
+func (p *fakeProducer) Close() error { return nil }
+
+func newTestEngine(t *testing.T, producer kafkaClient.Producer) *Engine {
+	t.Helper()
+	cfg := &config.Config{
+		Logger: config.LoggerConfig{Level: "error", Encoding: "json"},
+		Kafka:  config.KafkaConfig{Format: kafkaClient.FormatJson, TopicStrategy: "per-symbol"},
+		Indicators: config.IndicatorsConfig{
+			Intervals: []time.Duration{60},
+			Sma:       2,
+			Ema:       2,
+			Rsi:       2,
+			Atr:       2,
+			Macd:      config.MacdConfig{Fast: 2, Slow: 3, Signal: 2},
+			Bollinger: config.BollingerConfig{Period: 2, Deviations: 2},
+		},
+	}
+	log := logger.NewLogger(cfg)
+	log.InitLogger()
+	serializer, err := kafkaClient.NewSerializer(cfg.Kafka)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEngine(log, cfg, producer, serializer)
+}
+
+// Values that fail to publish are published with the next ones, in candle order.
+func TestEngineKeepsValuesWhenPublishingFails(t *testing.T) {
+	producer := &fakeProducer{err: errBroker}
+	e := newTestEngine(t, producer)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for minute := 0; minute < 3; minute++ {
+		at := start.Add(time.Duration(minute) * time.Minute)
+		e.Add(trades.Ticker{Symbol: "BTCUSDT", Price: strconv.Itoa(100 + minute), Quantity: "1", Time: at.UnixMilli()})
+	}
+	// The first two candles are finalized by the trades after them.
+	if err := e.flush(context.Background(), start.Add(2*time.Minute)); !errors.Is(err, errBroker) {
+		t.Fatalf("flush returned %v, want %v", err, errBroker)
+	}
+
+	// The third candle expires while the broker is still down.
+	if err := e.flush(context.Background(), start.Add(3*time.Minute+lateTradeDelay)); !errors.Is(err, errBroker) {
+		t.Fatalf("flush returned %v, want %v", err, errBroker)
+	}
+
+	producer.err = nil
+	if err := e.flush(context.Background(), start.Add(4*time.Minute)); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if len(producer.messages) != 3 {
+		t.Fatalf("published %d values, want 3", len(producer.messages))
+	}
+	for i, message := range producer.messages {
+		var values Values
+		if err := json.Unmarshal(message.Value, &values); err != nil {
+			t.Fatal(err)
+		}
+		if want := start.Add(time.Duration(i) * time.Minute).UnixMilli(); values.OpenTime != want {
+			t.Errorf("value %d opens at %d, want %d", i, values.OpenTime, want)
+		}
+	}
+
+	// Published values are not published again.
+	if err := e.flush(context.Background(), start.Add(5*time.Minute)); err != nil || len(producer.messages) != 3 {
+		t.Errorf("second flush published %d values, %v", len(producer.messages)-3, err)
+	}
+}
+
+// Requeued values go before the newer ones, and the oldest are dropped beyond maxPending.
+func TestEngineDropsOldestValuesBeyondMaxPending(t *testing.T) {
+	e := newTestEngine(t, &fakeProducer{})
+	values := make([]Values, maxPending+10)
+	for i := range values {
+		values[i].OpenTime = int64(i)
+	}
+	e.pending = append(e.pending, values[maxPending:]...)
+	e.requeue(values[:maxPending])
+
+	if len(e.pending) != maxPending {
+		t.Fatalf("%d pending values, want %d", len(e.pending), maxPending)
+	}
+	for i, v := range e.pending {
+		if want := int64(i + 10); v.OpenTime != want {
+			t.Fatalf("pending value %d opens at %d, want %d", i, v.OpenTime, want)
+		}
+	}
+}
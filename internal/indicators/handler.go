@@ -0,0 +1,40 @@
+package indicators
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+)
+
+type indicatorsResponse struct {
+	Symbol    string   `json:"symbol"`
+	Intervals []Values `json:"intervals"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type Handler struct {
+	engine *Engine
+}
+
+func NewHandler(engine *Engine) *Handler {
+	return &Handler{engine: engine}
+}
+
+// Get returns the indicators of the last finalized candle of the :symbol path parameter for every
+// interval, or only the one of the interval query parameter, such as 1m.
+func (h *Handler) Get(c echo.Context) error {
+	symbol := strings.ToUpper(c.Param("symbol"))
+	interval := c.QueryParam("interval")
+	latest := h.engine.Latest(symbol, interval)
+	if len(latest) == 0 {
+		message := "no finalized candle of " + symbol + " yet"
+		if interval != "" {
+			message = "no finalized " + interval + " candle of " + symbol + " yet"
+		}
+		return c.JSON(http.StatusNotFound, errorResponse{Error: message})
+	}
+	return c.JSON(http.StatusOK, indicatorsResponse{Symbol: symbol, Intervals: latest})
+}
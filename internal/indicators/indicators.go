@@ -0,0 +1,247 @@
+package indicators
+
+import "math"
+
+// The indicators below are updated once per finalized candle in constant time, keeping only
+// what the next update needs. Ready reports whether enough candles were seen for a value.
+
+// sma is the simple moving average of the last period values.
+type sma struct {
+	period int
+	values []float64
+	next   int
+	count  int
+	sum    float64
+}
+
+func newSma(period int) *sma {
+	return &sma{period: period, values: make([]float64, period)}
+}
+
+func (s *sma) update(value float64) {
+	if s.count == s.period {
+		s.sum -= s.values[s.next]
+	} else {
+		s.count++
+	}
+	s.values[s.next] = value
+	s.sum += value
+	s.next = (s.next + 1) % s.period
+}
+
+func (s *sma) ready() bool {
+	return s.count == s.period
+}
+
+func (s *sma) value() float64 {
+	return s.sum / float64(s.count)
+}
+
+// ema is the exponential moving average with alpha 2/(period+1), seeded with the simple average
+// of the first period values.
+type ema struct {
+	period  int
+	alpha   float64
+	count   int
+	current float64
+}
+
+func newEma(period int) *ema {
+	return &ema{period: period, alpha: 2 / float64(period+1)}
+}
+
+func (e *ema) update(value float64) {
+	e.count++
+	switch {
+	case e.count < e.period:
+		e.current += value
+	case e.count == e.period:
+		e.current = (e.current + value) / float64(e.period)
+	default:
+		e.current += e.alpha * (value - e.current)
+	}
+}
+
+func (e *ema) ready() bool {
+	return e.count >= e.period
+}
+
+func (e *ema) value() float64 {
+	return e.current
+}
+
+// wilder is Wilder's smoothing used by RSI and ATR: the simple average of the first period
+// values, then avg = (avg*(period-1) + value) / period.
+type wilder struct {
+	period  int
+	count   int
+	average float64
+}
+
+func (w *wilder) update(value float64) {
+	w.count++
+	if w.count <= w.period {
+		w.average += (value - w.average) / float64(w.count)
+		return
+	}
+	w.average = (w.average*float64(w.period-1) + value) / float64(w.period)
+}
+
+func (w *wilder) ready() bool {
+	return w.count >= w.period
+}
+
+// rsi is Wilder's relative strength index of the closes.
+type rsi struct {
+	gains     wilder
+	losses    wilder
+	previous  float64
+	hasClosed bool
+}
+
+func newRsi(period int) *rsi {
+	return &rsi{gains: wilder{period: period}, losses: wilder{period: period}}
+}
+
+func (r *rsi) update(close float64) {
+	if r.hasClosed {
+		change := close - r.previous
+		r.gains.update(math.Max(change, 0))
+		r.losses.update(math.Max(-change, 0))
+	}
+	r.previous = close
+	r.hasClosed = true
+}
+
+func (r *rsi) ready() bool {
+	return r.gains.ready()
+}
+
+func (r *rsi) value() float64 {
+	if r.losses.average == 0 {
+		if r.gains.average == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+r.gains.average/r.losses.average)
+}
+
+// macd is the difference of a fast and a slow EMA of the closes, with an EMA of that difference
+// as the signal line.
+type macd struct {
+	fast   *ema
+	slow   *ema
+	signal *ema
+}
+
+func newMacd(fast, slow, signal int) *macd {
+	return &macd{fast: newEma(fast), slow: newEma(slow), signal: newEma(signal)}
+}
+
+func (m *macd) update(close float64) {
+	m.fast.update(close)
+	m.slow.update(close)
+	if m.fast.ready() && m.slow.ready() {
+		m.signal.update(m.line())
+	}
+}
+
+func (m *macd) line() float64 {
+	return m.fast.value() - m.slow.value()
+}
+
+func (m *macd) ready() bool {
+	return m.signal.ready()
+}
+
+// bollinger are the bands deviations population standard deviations around the simple moving
+// average of the closes. The mean and the sum of squared deviations are kept by Welford's
+// method, sliding a close out of the window as the next one comes in, which unlike running sums
+// of the closes and their squares does not lose the deviation of prices far from zero to
+// rounding.
+type bollinger struct {
+	period     int
+	deviations float64
+	values     []float64
+	next       int
+	count      int
+	mean       float64
+	squares    float64
+}
+
+func newBollinger(period int, deviations float64) *bollinger {
+	return &bollinger{period: period, deviations: deviations, values: make([]float64, period)}
+}
+
+func (b *bollinger) update(close float64) {
+	if b.count == b.period {
+		old, mean := b.values[b.next], b.mean
+		b.mean += (close - old) / float64(b.count)
+		b.squares += (close - old) * (close - b.mean + old - mean)
+	} else {
+		b.count++
+		delta := close - b.mean
+		b.mean += delta / float64(b.count)
+		b.squares += delta * (close - b.mean)
+	}
+	b.values[b.next] = close
+	b.next = (b.next + 1) % b.period
+}
+
+func (b *bollinger) ready() bool {
+	return b.count == b.period
+}
+
+// bands returns the lower, middle and upper band.
+func (b *bollinger) bands() (float64, float64, float64) {
+	// Sliding can leave a flat window with a sum of squares a rounding error below zero.
+	deviation := math.Sqrt(math.Max(b.squares/float64(b.count), 0))
+	return b.mean - b.deviations*deviation, b.mean, b.mean + b.deviations*deviation
+}
+
+// atr is Wilder's average true range.
+type atr struct {
+	ranges    wilder
+	previous  float64
+	hasClosed bool
+}
+
+func newAtr(period int) *atr {
+	return &atr{ranges: wilder{period: period}}
+}
+
+func (a *atr) update(c Candle) {
+	trueRange := c.High - c.Low
+	if a.hasClosed {
+		trueRange = math.Max(trueRange, math.Max(math.Abs(c.High-a.previous), math.Abs(c.Low-a.previous)))
+	}
+	a.ranges.update(trueRange)
+	a.previous = c.Close
+	a.hasClosed = true
+}
+
+func (a *atr) ready() bool {
+	return a.ranges.ready()
+}
+
+// obv is the on-balance volume: the volume of every candle added when it closed higher and
+// subtracted when it closed lower than the previous one.
+type obv struct {
+	total     float64
+	previous  float64
+	hasClosed bool
+}
+
+func (o *obv) update(c Candle) {
+	if o.hasClosed {
+		switch {
+		case c.Close > o.previous:
+			o.total += c.Volume
+		case c.Close < o.previous:
+			o.total -= c.Volume
+		}
+	}
+	o.previous = c.Close
+	o.hasClosed = true
+}
@@ -0,0 +1,207 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+)
+
+// The reference values were computed from the textbook definitions over whole windows: SMA and
+// Bollinger over the last period closes, EMA and the Wilder averages of RSI and ATR seeded with
+// the simple average of their first period inputs.
+var (
+	closes = []float64{44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08, 45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64}
+	highs  = []float64{44.64, 44.44, 44.55, 44.06, 44.63, 45.18, 45.5, 45.87, 46.14, 46.43, 46.29, 46.48, 45.91, 46.63, 46.68, 46.45, 46.33, 46.76, 46.62, 46.09}
+	lows   = []float64{44.09, 43.8, 43.82, 43.36, 44.04, 44.5, 44.85, 45.13, 45.51, 45.83, 45.6, 45.7, 45.36, 45.99, 45.95, 45.75, 45.74, 46.08, 45.97, 45.35}
+	vols   = []float64{1000, 1037, 1074, 1111, 1148, 1185, 1222, 1259, 1296, 1033, 1070, 1107, 1144, 1181, 1218, 1255, 1292, 1029, 1066, 1103}
+)
+
+// nan marks the candles before an indicator is ready.
+var nan = math.NaN()
+
+const tolerance = 1e-9
+
+func candles() []Candle {
+	all := make([]Candle, len(closes))
+	for i := range closes {
+		all[i] = Candle{High: highs[i], Low: lows[i], Close: closes[i], Volume: vols[i]}
+	}
+	return all
+}
+
+// indicator adapts an indicator to the test: update feeds a candle, value returns the current
+// value and whether it is ready.
+type indicator struct {
+	update func(c Candle)
+	value  func() (float64, bool)
+}
+
+func TestIndicators(t *testing.T) {
+	cases := []struct {
+		name string
+		new  func() indicator
+		want []float64
+	}{
+		{
+			name: "sma 5",
+			new: func() indicator {
+				s := newSma(5)
+				return indicator{func(c Candle) { s.update(c.Close) }, func() (float64, bool) { return s.value(), s.ready() }}
+			},
+			want: []float64{nan, nan, nan, nan, 44.104, 44.202, 44.404, 44.658, 45.104, 45.454, 45.666, 45.852, 45.89, 45.978, 46.018, 46.04, 46.04, 46.2, 46.188, 46.06},
+		},
+		{
+			name: "ema 5",
+			new: func() indicator {
+				e := newEma(5)
+				return indicator{func(c Candle) { e.update(c.Close) }, func() (float64, bool) { return e.value(), e.ready() }}
+			},
+			want: []float64{nan, nan, nan, nan, 44.104, 44.346, 44.5973333333, 44.8715555556, 45.1943703704, 45.4895802469, 45.6230534979, 45.758702332, 45.709134888, 45.8994232586, 46.0262821724, 46.0175214483, 46.0216809655, 46.1511206437, 46.1740804291, 45.9960536194},
+		},
+		{
+			name: "rsi 5",
+			new: func() indicator {
+				r := newRsi(5)
+				return indicator{func(c Candle) { r.update(c.Close) }, func() (float64, bool) { return r.value(), r.ready() }}
+			},
+			want: []float64{nan, nan, nan, nan, nan, 61.8357487923, 67.1858774663, 72.8288907997, 78.8079470199, 81.6864676905, 72.0075513417, 74.7618931954, 54.6112017696, 70.4780395469, 70.4780395469, 57.380019674, 58.4150690109, 69.9643931931, 59.6161925641, 38.1084933925},
+		},
+		{
+			name: "macd 3 6 4 line",
+			new: func() indicator {
+				m := newMacd(3, 6, 4)
+				return indicator{func(c Candle) { m.update(c.Close) }, func() (float64, bool) { return m.line(), m.fast.ready() && m.slow.ready() }}
+			},
+			want: []float64{nan, nan, nan, nan, nan, 0.2479166667, 0.3114583333, 0.3582291667, 0.4137574405, 0.4259093325, 0.3286908178, 0.2770140886, 0.1289846727, 0.2012620709, 0.198323703, 0.1089423283, 0.0678857904, 0.1249533426, 0.086769848, -0.0635485212},
+		},
+		{
+			name: "macd 3 6 4 signal",
+			new: func() indicator {
+				m := newMacd(3, 6, 4)
+				return indicator{func(c Candle) { m.update(c.Close) }, func() (float64, bool) { return m.signal.value(), m.ready() }}
+			},
+			want: []float64{nan, nan, nan, nan, nan, nan, nan, nan, 0.3328404018, 0.3700679741, 0.3535171116, 0.3229159024, 0.2453434105, 0.2277108747, 0.215956006, 0.1731505349, 0.1310446371, 0.1286081193, 0.1118728108, 0.041704278},
+		},
+		{
+			name: "bollinger 5 2 lower",
+			new: func() indicator {
+				b := newBollinger(5, 2)
+				return indicator{func(c Candle) { b.update(c.Close) }, func() (float64, bool) {
+					lower, _, _ := b.bands()
+					return lower, b.ready()
+				}}
+			},
+			want: []float64{nan, nan, nan, nan, 43.5724964723, 43.4138477304, 43.3585068149, 43.3894638358, 44.0780487341, 44.5345566902, 44.9545395303, 45.3856267589, 45.5594247438, 45.5330460698, 45.5118142633, 45.5486345555, 45.5486345555, 45.8827619191, 45.8793513324, 45.5469697865},
+		},
+		{
+			name: "bollinger 5 2 middle",
+			new: func() indicator {
+				b := newBollinger(5, 2)
+				return indicator{func(c Candle) { b.update(c.Close) }, func() (float64, bool) {
+					_, middle, _ := b.bands()
+					return middle, b.ready()
+				}}
+			},
+			want: []float64{nan, nan, nan, nan, 44.104, 44.202, 44.404, 44.658, 45.104, 45.454, 45.666, 45.852, 45.89, 45.978, 46.018, 46.04, 46.04, 46.2, 46.188, 46.06},
+		},
+		{
+			name: "bollinger 5 2 upper",
+			new: func() indicator {
+				b := newBollinger(5, 2)
+				return indicator{func(c Candle) { b.update(c.Close) }, func() (float64, bool) {
+					_, _, upper := b.bands()
+					return upper, b.ready()
+				}}
+			},
+			want: []float64{nan, nan, nan, nan, 44.6355035277, 44.9901522696, 45.4494931851, 45.9265361642, 46.1299512659, 46.3734433098, 46.3774604697, 46.3183732411, 46.2205752562, 46.4229539302, 46.5241857367, 46.5313654445, 46.5313654445, 46.5172380809, 46.4966486676, 46.5730302135},
+		},
+		{
+			name: "atr 5",
+			new: func() indicator {
+				a := newAtr(5)
+				return indicator{a.update, func() (float64, bool) { return a.ranges.average, a.ready() }}
+			},
+			want: []float64{nan, nan, nan, nan, 0.746, 0.7668, 0.74744, 0.751952, 0.7455616, 0.71644928, 0.711159424, 0.7249275392, 0.7139420314, 0.7751536251, 0.7661229001, 0.7528983201, 0.720318656, 0.7222549248, 0.7078039399, 0.7402431519},
+		},
+		{
+			name: "obv",
+			new: func() indicator {
+				o := &obv{}
+				return indicator{o.update, func() (float64, bool) { return o.total, true }}
+			},
+			want: []float64{0, -1037, 37, -1074, 74, 1259, 2481, 3740, 5036, 6069, 4999, 6106, 4962, 6143, 6143, 4888, 6180, 7209, 6143, 5040},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ind := c.new()
+			for i, candle := range candles() {
+				ind.update(candle)
+				got, ready := ind.value()
+				if math.IsNaN(c.want[i]) {
+					if ready {
+						t.Fatalf("candle %d: ready with %v, want not ready", i, got)
+					}
+					continue
+				}
+				if !ready {
+					t.Fatalf("candle %d: not ready, want %v", i, c.want[i])
+				}
+				if math.Abs(got-c.want[i]) > tolerance {
+					t.Fatalf("candle %d: got %v, want %v", i, got, c.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRsiWithoutLosses(t *testing.T) {
+	cases := []struct {
+		name   string
+		closes []float64
+		want   float64
+	}{
+		{"rising", []float64{1, 2, 3, 4}, 100},
+		{"flat", []float64{5, 5, 5, 5}, 50},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := newRsi(3)
+			for _, close := range c.closes {
+				r.update(close)
+			}
+			if !r.ready() || r.value() != c.want {
+				t.Errorf("got %v (ready %v), want %v", r.value(), r.ready(), c.want)
+			}
+		})
+	}
+}
+
+// A flat series has no deviation, however far its prices are from zero.
+func TestBollingerFlatSeries(t *testing.T) {
+	for _, price := range []float64{0.1, 30000.1} {
+		b := newBollinger(20, 2)
+		for i := 0; i < 50; i++ {
+			b.update(price)
+		}
+		lower, middle, upper := b.bands()
+		if math.Abs(lower-price) > tolerance || math.Abs(middle-price) > tolerance || math.Abs(upper-price) > tolerance {
+			t.Errorf("bands %v %v %v, want all %v", lower, middle, upper, price)
+		}
+	}
+}
+
+// The bands of prices far from zero are those of the same moves near zero, shifted.
+func TestBollingerShiftedSeries(t *testing.T) {
+	near, far := newBollinger(5, 2), newBollinger(5, 2)
+	for i := 0; i < 50; i++ {
+		move := float64(i%7) / 10
+		near.update(1 + move)
+		far.update(30000 + move)
+	}
+	nearLower, _, nearUpper := near.bands()
+	farLower, _, farUpper := far.bands()
+	if math.Abs((farUpper-farLower)-(nearUpper-nearLower)) > tolerance {
+		t.Errorf("band width %v far from zero, %v near it", farUpper-farLower, nearUpper-nearLower)
+	}
+}
@@ -0,0 +1,187 @@
+package indicators
+
+import (
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	kafkaClient "github.com/sefikcan/read-time-trade/pkg/kafka"
+	"math"
+	"time"
+)
+
+// Values are the indicators of a symbol as of a finalized candle. An indicator is null in JSON
+// until enough candles were seen for it, and NaN in Avro and Protobuf.
+type Values struct {
+	Symbol   string `json:"symbol"`
+	Interval string `json:"interval"`
+	Candle
+	Sma             *float64 `json:"sma"`
+	Ema             *float64 `json:"ema"`
+	Rsi             *float64 `json:"rsi"`
+	Macd            *float64 `json:"macd"`
+	MacdSignal      *float64 `json:"macdSignal"`
+	MacdHistogram   *float64 `json:"macdHistogram"`
+	BollingerLower  *float64 `json:"bollingerLower"`
+	BollingerMiddle *float64 `json:"bollingerMiddle"`
+	BollingerUpper  *float64 `json:"bollingerUpper"`
+	Atr             *float64 `json:"atr"`
+	Obv             float64  `json:"obv"`
+}
+
+var valuesSchema = &kafkaClient.Schema{
+	Namespace: "realtimetrade",
+	Name:      "Indicators",
+	Version:   1,
+	Fields: []kafkaClient.SchemaField{
+		{Name: "symbol", Type: kafkaClient.FieldString},
+		{Name: "interval", Type: kafkaClient.FieldString},
+		{Name: "openTime", Type: kafkaClient.FieldLong},
+		{Name: "closeTime", Type: kafkaClient.FieldLong},
+		{Name: "open", Type: kafkaClient.FieldDouble},
+		{Name: "high", Type: kafkaClient.FieldDouble},
+		{Name: "low", Type: kafkaClient.FieldDouble},
+		{Name: "close", Type: kafkaClient.FieldDouble},
+		{Name: "volume", Type: kafkaClient.FieldDouble},
+		{Name: "trades", Type: kafkaClient.FieldLong},
+		{Name: "sma", Type: kafkaClient.FieldDouble},
+		{Name: "ema", Type: kafkaClient.FieldDouble},
+		{Name: "rsi", Type: kafkaClient.FieldDouble},
+		{Name: "macd", Type: kafkaClient.FieldDouble},
+		{Name: "macdSignal", Type: kafkaClient.FieldDouble},
+		{Name: "macdHistogram", Type: kafkaClient.FieldDouble},
+		{Name: "bollingerLower", Type: kafkaClient.FieldDouble},
+		{Name: "bollingerMiddle", Type: kafkaClient.FieldDouble},
+		{Name: "bollingerUpper", Type: kafkaClient.FieldDouble},
+		{Name: "atr", Type: kafkaClient.FieldDouble},
+		{Name: "obv", Type: kafkaClient.FieldDouble},
+	},
+}
+
+func (v Values) Schema() *kafkaClient.Schema {
+	return valuesSchema
+}
+
+func (v Values) Values() []interface{} {
+	return []interface{}{
+		v.Symbol, v.Interval, v.OpenTime, v.CloseTime, v.Open, v.High, v.Low, v.Close, v.Volume, v.Trades,
+		orNaN(v.Sma), orNaN(v.Ema), orNaN(v.Rsi), orNaN(v.Macd), orNaN(v.MacdSignal), orNaN(v.MacdHistogram),
+		orNaN(v.BollingerLower), orNaN(v.BollingerMiddle), orNaN(v.BollingerUpper), orNaN(v.Atr), v.Obv,
+	}
+}
+
+func orNaN(value *float64) float64 {
+	if value == nil {
+		return math.NaN()
+	}
+	return *value
+}
+
+// series builds the candles of one symbol and interval and updates its indicators with every
+// candle it finalizes.
+type series struct {
+	symbol   string
+	interval time.Duration
+	label    string
+
+	// candle is the open candle, nil until the next trade after one was finalized.
+	candle *Candle
+	// closedUntil is the close time of the last finalized candle; older trades are late.
+	closedUntil int64
+	latest      *Values
+	// late counts the dropped trades.
+	late int64
+
+	sma       *sma
+	ema       *ema
+	rsi       *rsi
+	macd      *macd
+	bollinger *bollinger
+	atr       *atr
+	obv       obv
+}
+
+func newSeries(cfg config.IndicatorsConfig, symbol string, interval time.Duration) *series {
+	return &series{
+		symbol:    symbol,
+		interval:  interval,
+		label:     intervalLabel(interval),
+		sma:       newSma(cfg.Sma),
+		ema:       newEma(cfg.Ema),
+		rsi:       newRsi(cfg.Rsi),
+		macd:      newMacd(cfg.Macd.Fast, cfg.Macd.Slow, cfg.Macd.Signal),
+		bollinger: newBollinger(cfg.Bollinger.Period, cfg.Bollinger.Deviations),
+		atr:       newAtr(cfg.Atr),
+	}
+}
+
+// add counts a trade into the open candle. When the trade opens a new interval, the open candle
+// is finalized first and its values returned. Intervals without trades get no candle.
+//
+// Trades older than the open candle are late and dropped, also when their interval never had a
+// candle: opening one now would finalize the candles out of order.
+func (s *series) add(price, quantity float64, at time.Time) (Values, bool) {
+	if at.UnixMilli() < s.closedUntil || (s.candle != nil && at.UnixMilli() < s.candle.OpenTime) {
+		s.late++
+		return Values{}, false
+	}
+
+	var values Values
+	var finalized bool
+	if s.candle != nil && at.UnixMilli() >= s.candle.CloseTime {
+		values, finalized = s.finalize(), true
+	}
+	if s.candle == nil {
+		s.candle = newCandle(s.interval, price, at)
+	}
+	s.candle.add(price, quantity)
+	return values, finalized
+}
+
+// expire finalizes the open candle once now is past its close time by delay, the time allowed
+// for late trades.
+func (s *series) expire(now time.Time, delay time.Duration) (Values, bool) {
+	if s.candle == nil || now.Add(-delay).UnixMilli() < s.candle.CloseTime {
+		return Values{}, false
+	}
+	return s.finalize(), true
+}
+
+func (s *series) finalize() Values {
+	c := *s.candle
+	s.candle = nil
+	s.closedUntil = c.CloseTime
+
+	s.sma.update(c.Close)
+	s.ema.update(c.Close)
+	s.rsi.update(c.Close)
+	s.macd.update(c.Close)
+	s.bollinger.update(c.Close)
+	s.atr.update(c)
+	s.obv.update(c)
+
+	values := Values{Symbol: s.symbol, Interval: s.label, Candle: c, Obv: s.obv.total}
+	if s.sma.ready() {
+		values.Sma = float(s.sma.value())
+	}
+	if s.ema.ready() {
+		values.Ema = float(s.ema.value())
+	}
+	if s.rsi.ready() {
+		values.Rsi = float(s.rsi.value())
+	}
+	if s.macd.ready() {
+		line, signal := s.macd.line(), s.macd.signal.value()
+		values.Macd, values.MacdSignal, values.MacdHistogram = float(line), float(signal), float(line-signal)
+	}
+	if s.bollinger.ready() {
+		lower, middle, upper := s.bollinger.bands()
+		values.BollingerLower, values.BollingerMiddle, values.BollingerUpper = float(lower), float(middle), float(upper)
+	}
+	if s.atr.ready() {
+		values.Atr = float(s.atr.ranges.average)
+	}
+	s.latest = &values
+	return values
+}
+
+func float(value float64) *float64 {
+	return &value
+}
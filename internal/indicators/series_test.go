@@ -0,0 +1,47 @@
+package indicators
+
+import (
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"testing"
+	"time"
+)
+
+// Trades older than the open candle are dropped, whether their interval was finalized or never
+// had a candle.
+func TestSeriesDropsLateTrades(t *testing.T) {
+	cfg := config.IndicatorsConfig{
+		Sma:       2,
+		Ema:       2,
+		Rsi:       2,
+		Atr:       2,
+		Macd:      config.MacdConfig{Fast: 2, Slow: 3, Signal: 2},
+		Bollinger: config.BollingerConfig{Period: 2, Deviations: 2},
+	}
+	s := newSeries(cfg, "BTCUSDT", time.Minute)
+	start := time.Unix(1700000040, 0)
+
+	s.add(100, 1, start)
+	// Opens the candle of the third minute and finalizes the first one.
+	if values, ok := s.add(103, 1, start.Add(2*time.Minute)); !ok || values.Candle.Close != 100 {
+		t.Fatalf("finalized %+v, %v", values, ok)
+	}
+	cases := []struct {
+		name string
+		at   time.Duration
+	}{
+		{"finalized interval", 30 * time.Second},
+		{"interval without a candle", time.Minute + 30*time.Second},
+	}
+	for _, c := range cases {
+		if _, ok := s.add(1, 100, start.Add(c.at)); ok {
+			t.Errorf("%s: late trade finalized a candle", c.name)
+		}
+	}
+
+	if s.late != 2 {
+		t.Errorf("%d dropped trades, want 2", s.late)
+	}
+	if s.candle.OpenTime != start.Add(2*time.Minute).UnixMilli() || s.candle.Low != 103 || s.candle.Trades != 1 {
+		t.Errorf("open candle %+v took a late trade", s.candle)
+	}
+}
@@ -0,0 +1,216 @@
+package indicators
+
+import (
+	"context"
+	"errors"
+	"github.com/sefikcan/read-time-trade/internal/trades"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	kafkaClient "github.com/sefikcan/read-time-trade/pkg/kafka"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/segmentio/kafka-go"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SymbolCandle is a finalized candle of a symbol, as published to the candles stream.
+type SymbolCandle struct {
+	Symbol   string `json:"symbol"`
+	Interval string `json:"interval"`
+	Candle
+}
+
+var candleSchema = &kafkaClient.Schema{
+	Namespace: "realtimetrade",
+	Name:      "Candle",
+	Version:   1,
+	Fields: []kafkaClient.SchemaField{
+		{Name: "symbol", Type: kafkaClient.FieldString},
+		{Name: "interval", Type: kafkaClient.FieldString},
+		{Name: "openTime", Type: kafkaClient.FieldLong},
+		{Name: "closeTime", Type: kafkaClient.FieldLong},
+		{Name: "open", Type: kafkaClient.FieldDouble},
+		{Name: "high", Type: kafkaClient.FieldDouble},
+		{Name: "low", Type: kafkaClient.FieldDouble},
+		{Name: "close", Type: kafkaClient.FieldDouble},
+		{Name: "volume", Type: kafkaClient.FieldDouble},
+		{Name: "trades", Type: kafkaClient.FieldLong},
+	},
+}
+
+func (c SymbolCandle) Schema() *kafkaClient.Schema {
+	return candleSchema
+}
+
+func (c SymbolCandle) Values() []interface{} {
+	return []interface{}{c.Symbol, c.Interval, c.OpenTime, c.CloseTime, c.Open, c.High, c.Low, c.Close, c.Volume, c.Trades}
+}
+
+// CandleStream builds the candles stream from the trades topics, as the processor of a
+// transactional pipeline. Every partition keeps time by its own trades: the first trade after an
+// interval finalizes the candles of the interval, never the wall clock, so consuming the same
+// trades again always gives the same candles. Trades older than the open interval are dropped.
+type CandleStream struct {
+	log          logger.Logger
+	interval     time.Duration
+	label        string
+	deserializer kafkaClient.Deserializer
+	serializer   kafkaClient.Serializer
+	topics       *kafkaClient.TopicNamer
+	host         string
+
+	partitions map[partitionKey]*openInterval
+	// late counts the dropped trades.
+	late int64
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// openInterval holds the candles of the open interval of a partition.
+type openInterval struct {
+	openTime int64
+	// offset is the offset of the trade that opened the interval, from which it is rebuilt.
+	offset  int64
+	candles map[string]*Candle
+}
+
+func NewCandleStream(log logger.Logger, cfg *config.Config, serializer kafkaClient.Serializer, deserializer kafkaClient.Deserializer) *CandleStream {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	interval := cfg.Candles.Interval * time.Second
+
+	return &CandleStream{
+		log:          log.Named("candles"),
+		interval:     interval,
+		label:        intervalLabel(interval),
+		deserializer: deserializer,
+		serializer:   serializer,
+		topics:       kafkaClient.NewTopicNamer(cfg.Kafka),
+		host:         host,
+		partitions:   make(map[partitionKey]*openInterval),
+	}
+}
+
+// Topics returns the pattern of the trades topics the stream consumes.
+func (s *CandleStream) Topics() string {
+	return s.topics.Pattern(trades.ExchangeName, kafkaClient.StreamTrades)
+}
+
+func (s *CandleStream) Process(ctx context.Context, message kafka.Message) ([]kafka.Message, error) {
+	var trade trades.Ticker
+	if err := s.deserializer.Deserialize(ctx, message.Value, &trade); err != nil {
+		if !errors.Is(err, kafkaClient.ErrMalformedValue) {
+			return nil, err
+		}
+		s.log.Warnw("Skipping a trade that cannot be decoded", "topic", message.Topic, "partition", message.Partition, "offset", message.Offset, "error", err)
+		return nil, nil
+	}
+	price, err := strconv.ParseFloat(trade.Price, 64)
+	if err != nil || price <= 0 {
+		s.log.Debugw("Ignoring trade without a valid price", logger.FieldSymbol, trade.Symbol, "price", trade.Price)
+		return nil, nil
+	}
+	quantity, err := strconv.ParseFloat(trade.Quantity, 64)
+	if err != nil || quantity < 0 {
+		s.log.Debugw("Ignoring trade without a valid quantity", logger.FieldSymbol, trade.Symbol, "quantity", trade.Quantity)
+		return nil, nil
+	}
+	at := time.UnixMilli(trade.Time)
+	openTime := at.Truncate(s.interval).UnixMilli()
+
+	key := partitionKey{topic: message.Topic, partition: int32(message.Partition)}
+	open := s.partitions[key]
+	var finalized []kafka.Message
+	switch {
+	case open == nil:
+	case openTime < open.openTime:
+		s.late++
+		s.log.Debugw("Dropping late trade", logger.FieldSymbol, trade.Symbol, "time", trade.Time, "dropped", s.late)
+		return nil, nil
+	case openTime > open.openTime:
+		if finalized, err = s.finalize(ctx, open); err != nil {
+			return nil, err
+		}
+		open = nil
+	}
+
+	if open == nil {
+		open = &openInterval{openTime: openTime, offset: message.Offset, candles: make(map[string]*Candle)}
+		s.partitions[key] = open
+	}
+	candle, ok := open.candles[trade.Symbol]
+	if !ok {
+		candle = newCandle(s.interval, price, at)
+		open.candles[trade.Symbol] = candle
+	}
+	candle.add(price, quantity)
+	return finalized, nil
+}
+
+// finalize returns the messages of the candles of an interval, by symbol.
+func (s *CandleStream) finalize(ctx context.Context, open *openInterval) ([]kafka.Message, error) {
+	symbols := make([]string, 0, len(open.candles))
+	for symbol := range open.candles {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	messages := make([]kafka.Message, 0, len(symbols))
+	for _, symbol := range symbols {
+		candle := SymbolCandle{Symbol: symbol, Interval: s.label, Candle: *open.candles[symbol]}
+		topic := s.topics.Topic(trades.ExchangeName, kafkaClient.StreamCandles, symbol)
+		value, err := s.serializer.Serialize(ctx, topic, candle)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, kafka.Message{
+			Topic: topic,
+			Key:   []byte(symbol),
+			Value: value,
+			Headers: kafkaClient.Provenance{
+				Exchange:      trades.ExchangeName,
+				Stream:        kafkaClient.StreamCandles,
+				Format:        s.serializer.Format(),
+				SchemaVersion: candleSchema.Version,
+				IngestHost:    s.host,
+			}.Headers(),
+		})
+	}
+	return messages, nil
+}
+
+func (s *CandleStream) Snapshot() interface{} {
+	partitions := make(map[partitionKey]*openInterval, len(s.partitions))
+	for key, open := range s.partitions {
+		candles := make(map[string]*Candle, len(open.candles))
+		for symbol, candle := range open.candles {
+			c := *candle
+			candles[symbol] = &c
+		}
+		partitions[key] = &openInterval{openTime: open.openTime, offset: open.offset, candles: candles}
+	}
+	return partitions
+}
+
+func (s *CandleStream) Restore(snapshot interface{}) {
+	s.partitions = snapshot.(map[partitionKey]*openInterval)
+}
+
+// Resume commits the offset of the trade that opened the interval of a partition, whose candles
+// are not published yet.
+func (s *CandleStream) Resume(topic string, partition int32, next int64) int64 {
+	if open, ok := s.partitions[partitionKey{topic: topic, partition: partition}]; ok {
+		return open.offset
+	}
+	return next
+}
+
+func (s *CandleStream) Reset(topic string, partition int32) {
+	delete(s.partitions, partitionKey{topic: topic, partition: partition})
+}
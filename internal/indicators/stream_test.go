@@ -0,0 +1,157 @@
+package indicators
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/sefikcan/read-time-trade/internal/trades"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	kafkaClient "github.com/sefikcan/read-time-trade/pkg/kafka"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/segmentio/kafka-go"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var streamStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestCandleStream(t *testing.T) *CandleStream {
+	t.Helper()
+	cfg := &config.Config{
+		Logger:  config.LoggerConfig{Level: "error", Encoding: "json"},
+		Kafka:   config.KafkaConfig{Format: kafkaClient.FormatJson, TopicStrategy: "shared"},
+		Candles: config.CandlesConfig{Enabled: true, Interval: 60},
+	}
+	log := logger.NewLogger(cfg)
+	log.InitLogger()
+	serializer, err := kafkaClient.NewSerializer(cfg.Kafka)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deserializer, err := kafkaClient.NewDeserializer(cfg.Kafka)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewCandleStream(log, cfg, serializer, deserializer)
+}
+
+// tradeMessage is a trade of the shared trades topic at seconds after streamStart.
+func tradeMessage(t *testing.T, offset int64, symbol string, price, quantity float64, seconds int) kafka.Message {
+	t.Helper()
+	value, err := json.Marshal(trades.Ticker{
+		Symbol:   symbol,
+		Price:    strconv.FormatFloat(price, 'f', -1, 64),
+		Quantity: strconv.FormatFloat(quantity, 'f', -1, 64),
+		Time:     streamStart.Add(time.Duration(seconds) * time.Second).UnixMilli(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kafka.Message{Topic: "trades", Partition: 0, Offset: offset, Value: value}
+}
+
+func process(t *testing.T, s *CandleStream, messages ...kafka.Message) []SymbolCandle {
+	t.Helper()
+	var candles []SymbolCandle
+	for _, message := range messages {
+		out, err := s.Process(context.Background(), message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range out {
+			var candle SymbolCandle
+			if err := json.Unmarshal(m.Value, &candle); err != nil {
+				t.Fatal(err)
+			}
+			if m.Topic != "candles" || string(m.Key) != candle.Symbol {
+				t.Errorf("candle of %s published to %s with key %s", candle.Symbol, m.Topic, m.Key)
+			}
+			candles = append(candles, candle)
+		}
+	}
+	return candles
+}
+
+func TestCandleStream(t *testing.T) {
+	s := newTestCandleStream(t)
+	open := streamStart.UnixMilli()
+
+	candles := process(t, s,
+		tradeMessage(t, 0, "ETHUSDT", 2000, 1, 5),
+		tradeMessage(t, 1, "BTCUSDT", 30000, 0.5, 10),
+		tradeMessage(t, 2, "BTCUSDT", 30100, 0.25, 20),
+		tradeMessage(t, 3, "BTCUSDT", 29900, 0.25, 59),
+	)
+	if len(candles) != 0 {
+		t.Fatalf("finalized %v before the interval ended", candles)
+	}
+	if got := s.Resume("trades", 0, 4); got != 0 {
+		t.Errorf("resumes from %d, want the first trade of the interval", got)
+	}
+
+	// The first trade of the next interval finalizes the candles of every symbol.
+	candles = process(t, s, tradeMessage(t, 4, "ETHUSDT", 2010, 2, 61))
+	want := []SymbolCandle{
+		{Symbol: "BTCUSDT", Interval: "1m", Candle: Candle{OpenTime: open, CloseTime: open + 60000, Open: 30000, High: 30100, Low: 29900, Close: 29900, Volume: 1, Trades: 3}},
+		{Symbol: "ETHUSDT", Interval: "1m", Candle: Candle{OpenTime: open, CloseTime: open + 60000, Open: 2000, High: 2000, Low: 2000, Close: 2000, Volume: 1, Trades: 1}},
+	}
+	if !reflect.DeepEqual(candles, want) {
+		t.Errorf("finalized %+v, want %+v", candles, want)
+	}
+	if got := s.Resume("trades", 0, 5); got != 4 {
+		t.Errorf("resumes from %d, want 4", got)
+	}
+
+	// Trades of a finalized interval are dropped.
+	if candles := process(t, s, tradeMessage(t, 5, "BTCUSDT", 1, 1, 30)); len(candles) != 0 || s.late != 1 {
+		t.Errorf("late trade gave %v and %d dropped trades", candles, s.late)
+	}
+	if got := s.partitions[partitionKey{"trades", 0}].candles["BTCUSDT"]; got != nil {
+		t.Errorf("late trade opened %+v", got)
+	}
+}
+
+func TestCandleStreamRollsBack(t *testing.T) {
+	s := newTestCandleStream(t)
+	process(t, s, tradeMessage(t, 0, "BTCUSDT", 30000, 1, 0))
+
+	snapshot := s.Snapshot()
+	process(t, s, tradeMessage(t, 1, "BTCUSDT", 31000, 1, 10), tradeMessage(t, 2, "BTCUSDT", 32000, 1, 70))
+	s.Restore(snapshot)
+
+	candle := s.partitions[partitionKey{"trades", 0}].candles["BTCUSDT"]
+	if candle == nil || candle.Trades != 1 || candle.High != 30000 || s.Resume("trades", 0, 1) != 0 {
+		t.Errorf("restored %+v, want the candle of the first trade", candle)
+	}
+
+	s.Reset("trades", 0)
+	if got := s.Resume("trades", 0, 1); got != 1 {
+		t.Errorf("reset partition resumes from %d, want 1", got)
+	}
+}
+
+// Consuming the same trades again, from where a candle opened, gives the same candles.
+func TestCandleStreamIsDeterministic(t *testing.T) {
+	var messages []kafka.Message
+	for i := 0; i < 40; i++ {
+		messages = append(messages, tradeMessage(t, int64(i), []string{"BTCUSDT", "ETHUSDT"}[i%2], float64(100+i%7), 1, i*7))
+	}
+
+	whole := process(t, newTestCandleStream(t), messages...)
+
+	first := newTestCandleStream(t)
+	candles := process(t, first, messages[:23]...)
+	resume := first.Resume("trades", 0, 23)
+	candles = append(candles, process(t, newTestCandleStream(t), messages[resume:]...)...)
+	if !reflect.DeepEqual(candles, whole) {
+		t.Errorf("restarted from %d gave %+v, want %+v", resume, candles, whole)
+	}
+}
+
+func TestCandleStreamTopics(t *testing.T) {
+	s := newTestCandleStream(t)
+	if got := s.Topics(); got != "^trades$" {
+		t.Errorf("consumes %q, want ^trades$", got)
+	}
+}
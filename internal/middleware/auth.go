@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+)
+
+const bearerPrefix = "Bearer "
+
+// BearerToken answers 401 to requests without token in their Authorization header.
+func BearerToken(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			given, ok := strings.CutPrefix(header, bearerPrefix)
+			if !ok || token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "missing or invalid bearer token"})
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBearerToken(t *testing.T) {
+	cases := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"valid token", "s3cret", "Bearer s3cret", http.StatusOK},
+		{"no header", "s3cret", "", http.StatusUnauthorized},
+		{"wrong token", "s3cret", "Bearer guess", http.StatusUnauthorized},
+		{"other scheme", "s3cret", "Basic s3cret", http.StatusUnauthorized},
+		{"no token configured", "", "Bearer ", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			e := echo.New()
+			e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, BearerToken(c.token))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if c.header != "" {
+				req.Header.Set(echo.HeaderAuthorization, c.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != c.want {
+				t.Errorf("status %d, want %d", rec.Code, c.want)
+			}
+			if c.want == http.StatusUnauthorized && rec.Header().Get(echo.HeaderWWWAuthenticate) != "Bearer" {
+				t.Errorf("no WWW-Authenticate challenge")
+			}
+		})
+	}
+}
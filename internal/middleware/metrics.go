@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/labstack/echo/v4"
 	"github.com/sefikcan/read-time-trade/pkg/metric"
+	"net/http"
 	"time"
 )
 
@@ -12,14 +13,7 @@ func (mw *MiddlewareManager) MetricsMiddleware(metrics metric.Metrics) echo.Midd
 		return func(c echo.Context) error {
 			start := time.Now()
 			err := next(c)
-			var status int
-			if err != nil {
-				var HTTPError *echo.HTTPError
-				errors.As(err, &HTTPError)
-				status = HTTPError.Code
-			} else {
-				status = c.Response().Status
-			}
+			status := responseStatus(c, err)
 
 			metrics.ObserveResponseTime(status, c.Request().Method, c.Path(), time.Since(start).Seconds())
 			metrics.IncreaseHits(status, c.Request().Method, c.Path())
@@ -27,3 +21,17 @@ func (mw *MiddlewareManager) MetricsMiddleware(metrics metric.Metrics) echo.Midd
 		}
 	}
 }
+
+// responseStatus returns the status code the error handler will answer with for err, or the
+// written status when the handler succeeded.
+func responseStatus(c echo.Context, err error) int {
+	if err == nil {
+		return c.Response().Status
+	}
+
+	var httpError *echo.HTTPError
+	if errors.As(err, &httpError) {
+		return httpError.Code
+	}
+	return http.StatusInternalServerError
+}
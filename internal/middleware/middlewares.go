@@ -13,6 +13,6 @@ type MiddlewareManager struct {
 func NewMiddlewareManager(cfg *config.Config, logger logger.Logger) *MiddlewareManager {
 	return &MiddlewareManager{
 		cfg:    cfg,
-		logger: logger,
+		logger: logger.Named("http"),
 	}
 }
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"golang.org/x/time/rate"
+	"strings"
+	"sync/atomic"
+)
+
+// RateLimiter limits the API requests of every client IP. Its limit can be changed while serving;
+// a change starts every client with a full burst again.
+type RateLimiter struct {
+	store atomic.Pointer[middleware.RateLimiterMemoryStore]
+}
+
+func NewRateLimiter(cfg config.RateLimitConfig) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetLimit(cfg)
+	return l
+}
+
+// SetLimit replaces the limit. A rate of 0 lifts it.
+func (l *RateLimiter) SetLimit(cfg config.RateLimitConfig) {
+	if cfg.Rate <= 0 {
+		l.store.Store(nil)
+		return
+	}
+	l.store.Store(middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+		Rate:  rate.Limit(cfg.Rate),
+		Burst: cfg.Burst,
+	}))
+}
+
+// Allow implements middleware.RateLimiterStore.
+func (l *RateLimiter) Allow(identifier string) (bool, error) {
+	store := l.store.Load()
+	if store == nil {
+		return true, nil
+	}
+	return store.Allow(identifier)
+}
+
+// Middleware answers 429 to clients over the limit. Probes and metrics are never limited.
+func (l *RateLimiter) Middleware() echo.MiddlewareFunc {
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Skipper: func(c echo.Context) bool {
+			path := c.Request().URL.Path
+			return strings.HasPrefix(path, "/api/v1/health") || path == "/metrics"
+		},
+		Store: l,
+	})
+}
@@ -2,10 +2,11 @@ package middleware
 
 import (
 	"github.com/labstack/echo/v4"
-	"github.com/sefikcan/read-time-trade/pkg/util"
 	"time"
 )
 
+// RequestLoggerMiddleware logs every handled request. The request id and trace id are taken from
+// the request context, which the RequestID and tracing middlewares further down the chain fill.
 func (mw *MiddlewareManager) RequestLoggerMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		start := time.Now()
@@ -13,12 +14,13 @@ func (mw *MiddlewareManager) RequestLoggerMiddleware(next echo.HandlerFunc) echo
 
 		req := c.Request()
 		res := c.Response()
-		status := res.Status
-		size := res.Size
-		s := time.Since(start).String()
-		requestId := util.GetRequestId(c)
-
-		mw.logger.Infof("RequestId: %s, Method: %s, Url: %s, Status: %v, Size: %v, Time: %s", requestId, req.Method, req.URL, status, size, s)
+		mw.logger.InfoCtx(req.Context(), "Request handled",
+			"method", req.Method,
+			"url", req.URL.String(),
+			"status", res.Status,
+			"size", res.Size,
+			"latency", time.Since(start).String(),
+		)
 
 		return err
 	}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/sefikcan/read-time-trade/pkg/tracing"
+	"github.com/sefikcan/read-time-trade/pkg/util"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// TracingMiddleware continues the W3C or B3 trace of the caller, or starts a new one, with a
+// server span named after the matched route. The request id is stored in the request context as
+// well, so it must run after the RequestID middleware.
+func (mw *MiddlewareManager) TracingMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := tracing.HTTPPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+		route := c.Path()
+		ctx, span := tracing.Tracer().Start(ctx, req.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", req.Method),
+				attribute.String("http.route", route),
+				attribute.String("http.target", req.URL.RequestURI()),
+				attribute.String("user_agent.original", req.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		c.SetRequest(req.WithContext(logger.ContextWithRequestId(ctx, util.GetRequestId(c))))
+		err := next(c)
+
+		status := responseStatus(c, err)
+		span.SetAttributes(
+			attribute.Int("http.status_code", status),
+			attribute.String("http.request_id", util.GetRequestId(c)),
+		)
+		if err != nil {
+			span.RecordError(err)
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+
+		return err
+	}
+}
@@ -1,28 +1,29 @@
 package server
 
 import (
+	"context"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/sefikcan/read-time-trade/internal/admin"
+	"github.com/sefikcan/read-time-trade/internal/alerts"
+	appHealth "github.com/sefikcan/read-time-trade/internal/health"
+	"github.com/sefikcan/read-time-trade/internal/indicators"
 	mw "github.com/sefikcan/read-time-trade/internal/middleware"
+	"github.com/sefikcan/read-time-trade/internal/stats"
+	"github.com/sefikcan/read-time-trade/pkg/config"
 	"github.com/sefikcan/read-time-trade/pkg/metric"
-	"github.com/sefikcan/read-time-trade/pkg/util"
 	echoSwagger "github.com/swaggo/echo-swagger"
 	"net/http"
+	"time"
 )
 
 func (s *Server) MapHandlers(e *echo.Echo) error {
-	metrics, err := metric.CreateMetrics(s.cfg.Metric.Url, s.cfg.Metric.ServiceName)
-	if err != nil {
-		s.logger.Errorf("CreateMetrics error: %s", err)
-	}
-	s.logger.Infof("Metrics available URL: %s, ServiceName: %s", s.cfg.Metric.Url, s.cfg.Metric.ServiceName)
-
 	middlewareManager := mw.NewMiddlewareManager(s.cfg, s.logger)
 	e.Use(middlewareManager.RequestLoggerMiddleware)
 
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"*"},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderXRequestID},
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderXRequestID, echo.HeaderAuthorization},
 	}))
 	e.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{
 		StackSize:         1 << 10, //1kb
@@ -30,18 +31,71 @@ func (s *Server) MapHandlers(e *echo.Echo) error {
 		DisableStackAll:   true,
 	}))
 	e.Use(middleware.RequestID())
-	e.Use(middlewareManager.MetricsMiddleware(metrics))
+	e.Use(s.rateLimiter.Middleware())
+	e.Use(middlewareManager.TracingMiddleware)
+	e.Use(middlewareManager.MetricsMiddleware(s.metrics))
 	e.Use(middleware.Secure())
 	e.Use(middleware.BodyLimit("2M"))
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
+	if s.cfg.Metric.ServeOnMain {
+		e.GET("/metrics", metric.NewHandler(s.registry))
+	}
 
 	v1 := e.Group("/api/v1")
 	health := v1.Group("/health")
 
 	health.GET("", func(c echo.Context) error {
-		s.logger.Infof("Health check RequestID: %s", util.GetRequestId(c))
+		s.logger.InfoCtx(c.Request().Context(), "Health check")
 		return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
 	})
 
+	if s.cfg.Server.AdminToken != "" {
+		logLevel := admin.NewLogLevelHandler(s.logger)
+		adminGroup := v1.Group("/admin", mw.BearerToken(s.cfg.Server.AdminToken))
+		adminGroup.GET("/log-level", logLevel.Get)
+		adminGroup.PUT("/log-level", logLevel.Put)
+	}
+
+	if s.stats != nil {
+		v1.GET("/stats/:symbol", stats.NewHandler(s.stats).Get)
+	}
+	if s.indicators != nil {
+		v1.GET("/indicators/:symbol", indicators.NewHandler(s.indicators).Get)
+	}
+	if s.alerts != nil {
+		handler := alerts.NewHandler(s.alerts)
+		alertsGroup := v1.Group("/alerts", mw.BearerToken(s.cfg.Alerts.Token))
+		alertsGroup.POST("", handler.Create)
+		alertsGroup.GET("", handler.List)
+		alertsGroup.GET("/:id", handler.Get)
+		alertsGroup.DELETE("/:id", handler.Delete)
+	}
+
+	s.probes.Store(s.healthChecks(s.cfg.Health))
+	health.GET("/live", echo.WrapHandler(appHealth.Handler(func(ctx context.Context) appHealth.Report {
+		return s.probes.Load().Live(ctx)
+	})))
+	health.GET("/ready", echo.WrapHandler(appHealth.Handler(func(ctx context.Context) appHealth.Report {
+		return s.probes.Load().Ready(ctx)
+	})))
+
 	return nil
 }
+
+// healthChecks builds the probes with the thresholds of cfg. Reloads replace them with new ones.
+func (s *Server) healthChecks(cfg config.HealthConfig) *appHealth.Health {
+	probes := appHealth.NewHealth(cfg.Timeout * time.Second)
+
+	if s.cfg.Capture.ReplayPath == "" {
+		probes.AddLiveness("listener", appHealth.ListenerAlive(s.tradeListener, cfg.MaxDisconnected*time.Second))
+		probes.AddReadiness("exchange", appHealth.ExchangeConnection(s.tradeListener))
+		probes.AddReadiness("trades", appHealth.TradeFreshness(s.tradeListener, cfg.MaxTradeAge*time.Second))
+	}
+	probes.AddReadiness("kafka", appHealth.KafkaBroker(s.cfg))
+	probes.AddReadiness("producer", appHealth.ProducerErrors(s.kafkaProducer, cfg.MaxErrorRate))
+	if s.cfg.Capture.RecordPath != "" {
+		probes.AddReadiness("storage", appHealth.CaptureStorage(s.tradeListener, s.cfg.Capture.RecordPath))
+	}
+
+	return probes
+}
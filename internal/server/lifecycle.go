@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"golang.org/x/sync/errgroup"
+	"time"
+)
+
+// component is a long running part of the service. run blocks until ctx is cancelled or the
+// component fails; stop releases its resources and must return within the given ctx.
+type component struct {
+	name string
+	run  func(ctx context.Context) error
+	stop func(ctx context.Context) error
+}
+
+// ComponentError reports which component failed to run or stop.
+type ComponentError struct {
+	Component string
+	Err       error
+}
+
+func (e *ComponentError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Component, e.Err)
+}
+
+func (e *ComponentError) Unwrap() error {
+	return e.Err
+}
+
+// lifecycle runs components concurrently. The first failure or the cancellation of the parent
+// context stops every component in reverse registration order within shutdownTimeout.
+type lifecycle struct {
+	logger          logger.Logger
+	shutdownTimeout time.Duration
+	components      []component
+}
+
+func newLifecycle(logger logger.Logger, shutdownTimeout time.Duration) *lifecycle {
+	return &lifecycle{
+		logger:          logger,
+		shutdownTimeout: shutdownTimeout,
+	}
+}
+
+func (lc *lifecycle) add(c component) {
+	lc.components = append(lc.components, c)
+}
+
+func (lc *lifecycle) run(ctx context.Context) error {
+	g, gctx := errgroup.WithContext(ctx)
+
+	for _, c := range lc.components {
+		c := c
+		g.Go(func() error {
+			lc.logger.Infof("Starting %s", c.name)
+			if err := c.run(gctx); err != nil && !errors.Is(err, context.Canceled) {
+				lc.logger.Errorf("%s failed: %s", c.name, err)
+				return &ComponentError{Component: c.name, Err: err}
+			}
+			lc.logger.Infof("%s finished", c.name)
+			return nil
+		})
+	}
+
+	g.Go(func() error {
+		<-gctx.Done()
+		return lc.shutdown()
+	})
+
+	return g.Wait()
+}
+
+func (lc *lifecycle) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), lc.shutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(lc.components) - 1; i >= 0; i-- {
+		c := lc.components[i]
+		if c.stop == nil {
+			continue
+		}
+
+		lc.logger.Infof("Stopping %s", c.name)
+		if err := c.stop(ctx); err != nil {
+			lc.logger.Errorf("%s failed to stop: %s", c.name, err)
+			errs = append(errs, &ComponentError{Component: c.name, Err: err})
+		}
+	}
+
+	return errors.Join(errs...)
+}
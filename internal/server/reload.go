@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"github.com/sefikcan/read-time-trade/internal/trades"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	appLogger "github.com/sefikcan/read-time-trade/pkg/logger"
+	"strings"
+)
+
+// liveSettings are applied to the running service on reload. Changes to any other setting, such
+// as ports or brokers, need a restart and are only reported.
+var liveSettings = []string{
+	"tickers",
+	"logger.level",
+	"logger.components",
+	"failurePolicy",
+	"health",
+	"server.rateLimit",
+}
+
+const (
+	reloadApplied   = "applied"
+	reloadPartial   = "partial"
+	reloadUnchanged = "unchanged"
+	reloadInvalid   = "invalid"
+)
+
+func (s *Server) configComponent() component {
+	return component{
+		name: "config watcher",
+		run: func(ctx context.Context) error {
+			return config.Watch(ctx, s.loader, s.reload)
+		},
+	}
+}
+
+// reload applies the live settings that differ between next and the running configuration and
+// reports the others. Reloads are called one at a time by the watcher.
+func (s *Server) reload(next *config.Config, err error) {
+	if err != nil {
+		s.logger.Errorw("Configuration reload rejected, keeping the running configuration", appLogger.FieldError, err)
+		s.metrics.IncreaseConfigReloads(reloadInvalid)
+		return
+	}
+
+	changed := config.Diff(s.running, next)
+	if len(changed) == 0 {
+		s.metrics.IncreaseConfigReloads(reloadUnchanged)
+		return
+	}
+
+	applied := *s.running
+	var live, restart []string
+	for _, setting := range changed {
+		if !isLiveSetting(setting) {
+			restart = append(restart, setting)
+			s.metrics.IncreaseRestartRequired(setting)
+			continue
+		}
+		if err := s.apply(setting, next); err != nil {
+			s.logger.Errorw("Configuration setting could not be applied", "setting", setting, appLogger.FieldError, err)
+			restart = append(restart, setting)
+			s.metrics.IncreaseRestartRequired(setting)
+			continue
+		}
+		live = append(live, setting)
+		copySetting(&applied, next, setting)
+	}
+	s.running = &applied
+
+	if len(restart) > 0 {
+		s.logger.Warnw("Configuration changes need a restart and were not applied", "settings", restart, "applied", live)
+		s.metrics.IncreaseConfigReloads(reloadPartial)
+		return
+	}
+	s.logger.Infow("Configuration reloaded", "applied", live)
+	s.metrics.IncreaseConfigReloads(reloadApplied)
+}
+
+// apply changes the running service for a single live setting of next.
+func (s *Server) apply(setting string, next *config.Config) error {
+	switch {
+	case setting == "tickers":
+		return s.tradeListener.SetSymbols(next.Tickers)
+	case setting == "logger.level":
+		level, err := appLogger.ParseLevel(next.Logger.Level)
+		if err != nil {
+			return err
+		}
+		s.logger.Levels().SetLevel(level)
+	case setting == "logger.components":
+		return s.applyComponentLevels(s.running.Logger.Components, next.Logger.Components)
+	case strings.HasPrefix(setting, "failurePolicy."):
+		// The policy is rebuilt from all of its settings, so a change of several settings
+		// applies them together.
+		policy, err := trades.NewFailurePolicy(next.FailurePolicy)
+		if err != nil {
+			return err
+		}
+		s.tradeListener.SetPolicy(policy)
+	case strings.HasPrefix(setting, "health."):
+		s.probes.Store(s.healthChecks(next.Health))
+	case strings.HasPrefix(setting, "server.rateLimit."):
+		s.rateLimiter.SetLimit(next.Server.RateLimit)
+	}
+	return nil
+}
+
+// applyComponentLevels only touches the components whose configured level changed, so levels set
+// at runtime through the admin endpoint survive reloads that do not concern them.
+func (s *Server) applyComponentLevels(old, next map[string]string) error {
+	levels := s.logger.Levels()
+	for component := range old {
+		if _, ok := next[component]; !ok {
+			levels.ResetComponentLevel(component)
+		}
+	}
+	for component, text := range next {
+		if old[component] == text {
+			continue
+		}
+		level, err := appLogger.ParseLevel(text)
+		if err != nil {
+			return err
+		}
+		levels.SetComponentLevel(component, level)
+	}
+	return nil
+}
+
+func isLiveSetting(setting string) bool {
+	for _, live := range liveSettings {
+		if setting == live || strings.HasPrefix(setting, live+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// copySetting copies an applied live setting from next into running.
+func copySetting(running *config.Config, next *config.Config, setting string) {
+	switch {
+	case setting == "tickers":
+		running.Tickers = next.Tickers
+	case setting == "logger.level":
+		running.Logger.Level = next.Logger.Level
+	case setting == "logger.components":
+		running.Logger.Components = next.Logger.Components
+	case strings.HasPrefix(setting, "failurePolicy."):
+		running.FailurePolicy = next.FailurePolicy
+	case strings.HasPrefix(setting, "health."):
+		running.Health = next.Health
+	case strings.HasPrefix(setting, "server.rateLimit."):
+		running.Server.RateLimit = next.Server.RateLimit
+	}
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"errors"
+	"github.com/sefikcan/read-time-trade/internal/trades"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/sefikcan/read-time-trade/pkg/metric"
+	"go.uber.org/zap/zapcore"
+	"reflect"
+	"testing"
+)
+
+// reloadMetrics records the reload metrics; the other metrics are not used by a reload.
+type reloadMetrics struct {
+	metric.Metrics
+	reloads         []string
+	restartRequired []string
+}
+
+func (m *reloadMetrics) IncreaseConfigReloads(result string) { m.reloads = append(m.reloads, result) }
+
+func (m *reloadMetrics) IncreaseRestartRequired(setting string) {
+	m.restartRequired = append(m.restartRequired, setting)
+}
+
+// symbolsListener records the symbols and policy it is given.
+type symbolsListener struct {
+	trades.TradeListener
+	symbols []string
+	policy  *trades.FailurePolicy
+}
+
+func (l *symbolsListener) SetSymbols(symbols []string) error {
+	l.symbols = symbols
+	return nil
+}
+
+func (l *symbolsListener) SetPolicy(policy trades.FailurePolicy) { l.policy = &policy }
+
+func newReloadServer(t *testing.T) (*Server, *reloadMetrics, *symbolsListener) {
+	t.Helper()
+	loader, err := config.NewLoader([]string{"--secrets-dir", t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loader.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Logger = config.LoggerConfig{Level: "info", Encoding: "json"}
+	log := logger.NewLogger(cfg)
+	log.InitLogger()
+
+	s := NewServer(cfg, loader, log)
+	metrics, listener := &reloadMetrics{}, &symbolsListener{}
+	s.metrics, s.tradeListener = metrics, listener
+	return s, metrics, listener
+}
+
+// A live setting is applied and kept in the running configuration; a restart-only setting is
+// reported and the running configuration keeps its old value.
+func TestReload(t *testing.T) {
+	s, metrics, listener := newReloadServer(t)
+	started := *s.cfg
+
+	next := started
+	next.Server.Port = "6000"
+	next.Server.RateLimit = config.RateLimitConfig{Rate: 1, Burst: 1}
+	next.Logger.Level = "debug"
+	next.Tickers = []string{"btcusdt", "solusdt"}
+	s.reload(&next, nil)
+
+	if got := s.logger.Levels().Level(""); got != zapcore.DebugLevel {
+		t.Errorf("level %s, want debug", got)
+	}
+	if !reflect.DeepEqual(listener.symbols, next.Tickers) {
+		t.Errorf("listener symbols %v, want %v", listener.symbols, next.Tickers)
+	}
+	if allowed, _ := s.rateLimiter.Allow("client"); !allowed {
+		t.Error("first request over the new limit refused")
+	}
+	if allowed, _ := s.rateLimiter.Allow("client"); allowed {
+		t.Error("second request over the new limit of one allowed")
+	}
+	if s.running.Server.Port != started.Server.Port {
+		t.Errorf("running port %s, want the port of the start %s", s.running.Server.Port, started.Server.Port)
+	}
+	if s.running.Logger.Level != "debug" || !reflect.DeepEqual(s.running.Tickers, next.Tickers) || s.running.Server.RateLimit != next.Server.RateLimit {
+		t.Errorf("running configuration without the applied settings %+v", s.running)
+	}
+	if s.cfg.Logger.Level != "info" {
+		t.Error("reload changed the configuration of the start")
+	}
+	if !reflect.DeepEqual(metrics.restartRequired, []string{"server.port"}) || !reflect.DeepEqual(metrics.reloads, []string{reloadPartial}) {
+		t.Errorf("metrics restart %v, reloads %v", metrics.restartRequired, metrics.reloads)
+	}
+
+	// The port still differs from the running configuration and is reported again.
+	s.reload(&next, nil)
+	if !reflect.DeepEqual(metrics.reloads, []string{reloadPartial, reloadPartial}) {
+		t.Errorf("reloads %v", metrics.reloads)
+	}
+}
+
+func TestReloadResults(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(c *config.Config)
+		err    error
+		want   string
+	}{
+		{"unchanged", func(c *config.Config) {}, nil, reloadUnchanged},
+		{"invalid", func(c *config.Config) { c.Logger.Level = "debug" }, errors.New("invalid"), reloadInvalid},
+		{"live only", func(c *config.Config) { c.FailurePolicy.MaxRetries++ }, nil, reloadApplied},
+		{"unparsable live setting", func(c *config.Config) { c.Logger.Level = "verbose" }, nil, reloadPartial},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, metrics, listener := newReloadServer(t)
+			running := s.running
+			next := *s.cfg
+			c.change(&next)
+			s.reload(&next, c.err)
+
+			if !reflect.DeepEqual(metrics.reloads, []string{c.want}) {
+				t.Errorf("reloads %v, want %s", metrics.reloads, c.want)
+			}
+			switch c.want {
+			case reloadApplied:
+				if listener.policy == nil || s.running.FailurePolicy != next.FailurePolicy {
+					t.Errorf("failure policy not applied: %+v", s.running.FailurePolicy)
+				}
+			case reloadPartial:
+				if s.running.Logger.Level != running.Logger.Level || s.logger.Levels().Level("") != zapcore.InfoLevel {
+					t.Errorf("level %s applied", s.running.Logger.Level)
+				}
+			default:
+				if s.running != running {
+					t.Error("running configuration replaced")
+				}
+			}
+		})
+	}
+}
+
+func TestIsLiveSetting(t *testing.T) {
+	cases := map[string]bool{
+		"tickers":                  true,
+		"logger.level":             true,
+		"logger.components":        true,
+		"failurePolicy.maxRetries": true,
+		"health.maxTradeAge":       true,
+		"server.rateLimit.rate":    true,
+		"server.port":              false,
+		"kafka.brokers":            false,
+		"logger.encoding":          false,
+		"tickersx":                 false,
+		"healthy":                  false,
+	}
+	for setting, want := range cases {
+		if got := isLiveSetting(setting); got != want {
+			t.Errorf("isLiveSetting(%q) = %v, want %v", setting, got, want)
+		}
+	}
+}
+
+// copySetting only copies the section of the setting it is given.
+func TestCopySetting(t *testing.T) {
+	next := &config.Config{
+		Tickers:       []string{"solusdt"},
+		Logger:        config.LoggerConfig{Level: "debug", Encoding: "console", Components: map[string]string{"listener": "warn"}},
+		FailurePolicy: config.FailurePolicyConfig{MaxRetries: 7},
+		Health:        config.HealthConfig{MaxTradeAge: 30},
+		Server:        config.ServerConfig{Port: "6000", RateLimit: config.RateLimitConfig{Rate: 5, Burst: 10}},
+	}
+	cases := []struct {
+		setting string
+		want    config.Config
+	}{
+		{"tickers", config.Config{Tickers: next.Tickers}},
+		{"logger.level", config.Config{Logger: config.LoggerConfig{Level: "debug"}}},
+		{"logger.components", config.Config{Logger: config.LoggerConfig{Components: next.Logger.Components}}},
+		{"failurePolicy.maxRetries", config.Config{FailurePolicy: next.FailurePolicy}},
+		{"health.maxTradeAge", config.Config{Health: next.Health}},
+		{"server.rateLimit.burst", config.Config{Server: config.ServerConfig{RateLimit: next.Server.RateLimit}}},
+		{"server.port", config.Config{}},
+	}
+	for _, c := range cases {
+		running := config.Config{}
+		copySetting(&running, next, c.setting)
+		if !reflect.DeepEqual(running, c.want) {
+			t.Errorf("copySetting(%q) = %+v, want %+v", c.setting, running, c.want)
+		}
+	}
+}
@@ -2,35 +2,169 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sefikcan/read-time-trade/internal/alerts"
+	appHealth "github.com/sefikcan/read-time-trade/internal/health"
+	"github.com/sefikcan/read-time-trade/internal/indicators"
+	mw "github.com/sefikcan/read-time-trade/internal/middleware"
+	"github.com/sefikcan/read-time-trade/internal/stats"
 	"github.com/sefikcan/read-time-trade/internal/trades"
 	"github.com/sefikcan/read-time-trade/pkg/config"
 	"github.com/sefikcan/read-time-trade/pkg/kafka"
 	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/sefikcan/read-time-trade/pkg/metric"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 type Server struct {
-	echo   *echo.Echo
-	cfg    *config.Config
-	logger logger.Logger
+	echo          *echo.Echo
+	cfg           *config.Config
+	loader        *config.Loader
+	logger        logger.Logger
+	registry      *prometheus.Registry
+	metrics       metric.Metrics
+	kafkaProducer kafka.Producer
+	tradeListener trades.TradeListener
+	stats         *stats.Service
+	indicators    *indicators.Engine
+	alerts        *alerts.Engine
+	probes        atomic.Pointer[appHealth.Health]
+	rateLimiter   *mw.RateLimiter
+	// running is cfg with the settings applied by reloads since startup.
+	running *config.Config
 }
 
-func NewServer(cfg *config.Config, logger logger.Logger) *Server {
+func NewServer(cfg *config.Config, loader *config.Loader, logger logger.Logger) *Server {
 	return &Server{
-		echo:   echo.New(),
-		cfg:    cfg,
-		logger: logger,
+		echo:        echo.New(),
+		cfg:         cfg,
+		loader:      loader,
+		logger:      logger,
+		registry:    metric.NewRegistry(),
+		rateLimiter: mw.NewRateLimiter(cfg.Server.RateLimit),
+		running:     cfg,
 	}
 }
 
+// Run starts the HTTP API, metrics server, Kafka producer and trade listener together and
+// blocks until SIGINT/SIGTERM or the first component failure, then shuts everything down
+// within CtxTimeout.
 func (s *Server) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	policy, err := trades.NewFailurePolicy(s.cfg.FailurePolicy)
+	if err != nil {
+		return err
+	}
+
+	metrics, err := metric.CreateMetrics(s.registry, s.cfg.Metric)
+	if err != nil {
+		return err
+	}
+	s.logger.Infof("Metrics available URL: %s, ServiceName: %s", s.cfg.Metric.Url, s.cfg.Metric.ServiceName)
+
+	kafkaProducer, err := s.newProducer()
+	if err != nil {
+		return err
+	}
+	if err = s.registry.Register(metric.NewWriterStatsCollector(s.cfg.Metric.ServiceName, kafkaProducer.Stats)); err != nil {
+		return err
+	}
+
+	serializer, err := kafka.NewSerializer(s.cfg.Kafka)
+	if err != nil {
+		return err
+	}
+
+	tradeListener := trades.NewTradeListener(s.logger, s.cfg, kafkaProducer, serializer, metrics, policy, s.cfg.Tickers)
+	s.metrics = metrics
+	s.kafkaProducer = kafkaProducer
+	s.tradeListener = tradeListener
+	if s.cfg.Stats.Enabled {
+		s.stats = stats.NewService(s.logger, s.cfg, kafkaProducer, serializer)
+		tradeListener.OnTrade(s.stats.Add)
+	}
+	if s.cfg.Indicators.Enabled {
+		s.indicators = indicators.NewEngine(s.logger, s.cfg, kafkaProducer, serializer)
+		tradeListener.OnTrade(s.indicators.Add)
+	}
+	if s.cfg.Alerts.Enabled {
+		if s.alerts, err = alerts.NewEngine(s.logger, s.cfg); err != nil {
+			return err
+		}
+		tradeListener.OnTrade(s.alerts.Add)
+	}
+	var candles *kafka.Pipeline
+	if s.cfg.Candles.Enabled {
+		if candles, err = s.newCandlesPipeline(serializer); err != nil {
+			return err
+		}
+	}
+
+	if err := s.MapHandlers(s.echo); err != nil {
+		return err
+	}
+
+	lc := newLifecycle(s.logger, s.cfg.Server.CtxTimeout*time.Second)
+	// The producer is added first so that it stops last, after every component publishing
+	// through it has stopped.
+	lc.add(component{
+		name: "kafka producer",
+		run:  blockUntilDone,
+		stop: func(context.Context) error {
+			return kafkaProducer.Close()
+		},
+	})
+	if s.cfg.Metric.Url != "" {
+		lc.add(s.metricsComponent())
+	}
+	if s.cfg.Server.DebugPort != "" {
+		lc.add(s.debugComponent())
+	}
+	lc.add(s.httpComponent())
+	if s.stats != nil {
+		lc.add(component{name: "stats publisher", run: s.stats.Run, stop: s.stats.Close})
+	}
+	if s.indicators != nil {
+		lc.add(component{name: "indicators publisher", run: s.indicators.Run, stop: s.indicators.Close})
+	}
+	if s.alerts != nil {
+		lc.add(component{name: "alert notifier", run: s.alerts.Run, stop: s.alerts.Close})
+	}
+	if candles != nil {
+		lc.add(component{name: "candles pipeline", run: candles.Run, stop: candles.Close})
+	}
+	lc.add(s.configComponent())
+	lc.add(component{
+		name: "trade listener",
+		run: func(ctx context.Context) error {
+			if s.cfg.Capture.ReplayPath != "" {
+				return tradeListener.Replay(ctx, s.cfg.Capture.ReplayPath, s.cfg.Capture.ReplaySpeed)
+			}
+			return tradeListener.Start(ctx)
+		},
+		stop: tradeListener.Stop,
+	})
+
+	err = lc.run(ctx)
+	if err != nil {
+		s.logger.Errorf("Server exited with error: %s", err)
+		return err
+	}
+	s.logger.Info("Server exited properly")
+	return nil
+}
+
+func (s *Server) httpComponent() component {
 	server := &http.Server{
 		Addr:           fmt.Sprintf("%s:%s", s.cfg.Server.Host, s.cfg.Server.Port),
 		ReadTimeout:    time.Second * s.cfg.Server.ReadTimeout,
@@ -38,44 +172,71 @@ func (s *Server) Run() error {
 		MaxHeaderBytes: s.cfg.Server.MaxHeaderBytes,
 	}
 
-	go func() {
-		s.logger.Infof("Server is listening on PORT: %s", s.cfg.Server.Port)
-		if err := s.echo.StartServer(server); err != nil {
-			s.logger.Fatalf("Error starting server: ", err)
-		}
-	}()
+	return component{
+		name: "http server",
+		run: func(context.Context) error {
+			s.logger.Infof("Server is listening on PORT: %s", s.cfg.Server.Port)
+			return ignoreServerClosed(s.echo.StartServer(server))
+		},
+		stop: server.Shutdown,
+	}
+}
 
-	go func() {
-		s.logger.Infof("Starting Debug Server on PORT: %s", s.cfg.Server.Port)
-		if err := http.ListenAndServe(s.cfg.Server.Port, http.DefaultServeMux); err != nil {
-			s.logger.Errorf("Error ListenAndServe: %s", err)
-		}
-	}()
+func (s *Server) metricsComponent() component {
+	router := metric.NewRouter(s.registry)
 
-	kafkaProducer := kafka.NewProducer(s.logger, s.cfg.Kafka.Brokers)
-	defer kafkaProducer.Close()
+	return component{
+		name: "metrics server",
+		run: func(context.Context) error {
+			s.logger.Infof("Metrics server is running on: %s", s.cfg.Metric.Url)
+			return ignoreServerClosed(router.Start(s.cfg.Metric.Url))
+		},
+		stop: router.Shutdown,
+	}
+}
 
-	topics := strings.Split(s.cfg.Tickers.Tickers, ",")
-	for i, topic := range topics {
-		topics[i] = strings.Trim(strings.Trim(topic, "\\"), "\"")
+func (s *Server) debugComponent() component {
+	server := &http.Server{
+		Addr:    fmt.Sprintf("%s:%s", s.cfg.Server.Host, s.cfg.Server.DebugPort),
+		Handler: http.DefaultServeMux,
 	}
 
-	tradeListener := trades.NewTradeListener(s.logger, s.cfg, kafkaProducer)
-	err := tradeListener.SubscribeAndListen(topics)
-	if err != nil {
-		s.logger.Fatal(err)
+	return component{
+		name: "debug server",
+		run: func(context.Context) error {
+			s.logger.Infof("Starting Debug Server on PORT: %s", s.cfg.Server.DebugPort)
+			return ignoreServerClosed(server.ListenAndServe())
+		},
+		stop: server.Shutdown,
 	}
+}
 
-	if err := s.MapHandlers(s.echo); err != nil {
-		return err
+func blockUntilDone(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func ignoreServerClosed(err error) error {
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
 	}
+	return err
+}
 
-	// gracefull shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
-	<-quit
-	ctx, shutdown := context.WithTimeout(context.Background(), s.cfg.Server.CtxTimeout*time.Second)
-	defer shutdown()
-	s.logger.Info("Server exited properly")
-	return s.echo.Server.Shutdown(ctx)
+func (s *Server) newProducer() (kafka.Producer, error) {
+	if s.cfg.Kafka.Delivery == "idempotent" {
+		return kafka.NewIdempotentProducer(s.logger, s.cfg.Kafka)
+	}
+	return kafka.NewProducer(s.logger, s.cfg.Kafka)
+}
+
+// newCandlesPipeline derives the candles stream from the trades topics in transactions of its
+// own client.
+func (s *Server) newCandlesPipeline(serializer kafka.Serializer) (*kafka.Pipeline, error) {
+	deserializer, err := kafka.NewDeserializer(s.cfg.Kafka)
+	if err != nil {
+		return nil, err
+	}
+	stream := indicators.NewCandleStream(s.logger, s.cfg, serializer, deserializer)
+	return kafka.NewPipeline(s.logger, s.cfg.Kafka, kafka.StreamCandles, stream.Topics(), stream)
 }
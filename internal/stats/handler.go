@@ -0,0 +1,35 @@
+package stats
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type statsResponse struct {
+	Symbol  string        `json:"symbol"`
+	Windows []WindowStats `json:"windows"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// Get returns the rolling statistics of the :symbol path parameter for every window.
+func (h *Handler) Get(c echo.Context) error {
+	symbol := strings.ToUpper(c.Param("symbol"))
+	windows, ok := h.service.Snapshot(symbol, time.Now())
+	if !ok {
+		return c.JSON(http.StatusNotFound, errorResponse{Error: "no trades of " + symbol + " seen yet"})
+	}
+	return c.JSON(http.StatusOK, statsResponse{Symbol: symbol, Windows: windows})
+}
@@ -0,0 +1,232 @@
+package stats
+
+import (
+	"context"
+	"github.com/sefikcan/read-time-trade/internal/trades"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	kafkaClient "github.com/sefikcan/read-time-trade/pkg/kafka"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/segmentio/kafka-go"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WindowStats are the rolling statistics of a symbol over one window. Volatility is the realized
+// volatility of the window, the square root of the summed squared log returns between bucket
+// closes, not annualized.
+type WindowStats struct {
+	Symbol     string  `json:"symbol"`
+	Window     string  `json:"window"`
+	Time       int64   `json:"time"`
+	Trades     int64   `json:"trades"`
+	Volume     float64 `json:"volume"`
+	Vwap       float64 `json:"vwap"`
+	Twap       float64 `json:"twap"`
+	High       float64 `json:"high"`
+	Low        float64 `json:"low"`
+	Volatility float64 `json:"volatility"`
+}
+
+var windowStatsSchema = &kafkaClient.Schema{
+	Namespace: "realtimetrade",
+	Name:      "WindowStats",
+	Version:   1,
+	Fields: []kafkaClient.SchemaField{
+		{Name: "symbol", Type: kafkaClient.FieldString},
+		{Name: "window", Type: kafkaClient.FieldString},
+		{Name: "time", Type: kafkaClient.FieldLong},
+		{Name: "trades", Type: kafkaClient.FieldLong},
+		{Name: "volume", Type: kafkaClient.FieldDouble},
+		{Name: "vwap", Type: kafkaClient.FieldDouble},
+		{Name: "twap", Type: kafkaClient.FieldDouble},
+		{Name: "high", Type: kafkaClient.FieldDouble},
+		{Name: "low", Type: kafkaClient.FieldDouble},
+		{Name: "volatility", Type: kafkaClient.FieldDouble},
+	},
+}
+
+func (s WindowStats) Schema() *kafkaClient.Schema {
+	return windowStatsSchema
+}
+
+func (s WindowStats) Values() []interface{} {
+	return []interface{}{s.Symbol, s.Window, s.Time, s.Trades, s.Volume, s.Vwap, s.Twap, s.High, s.Low, s.Volatility}
+}
+
+// Service keeps the rolling statistics of every traded symbol and publishes them to the stats
+// stream every PublishInterval. While a capture is replayed the windows end at the latest trade
+// rather than the wall clock, which would find the replayed trades outside of every window.
+type Service struct {
+	log        logger.Logger
+	cfg        config.StatsConfig
+	producer   kafkaClient.Producer
+	serializer kafkaClient.Serializer
+	topics     *kafkaClient.TopicNamer
+	host       string
+	replay     bool
+	// done is closed when Run returns.
+	done chan struct{}
+
+	mu      sync.Mutex
+	symbols map[string][]*window
+	// latest is the time of the latest trade of any symbol.
+	latest time.Time
+}
+
+func NewService(log logger.Logger, cfg *config.Config, producer kafkaClient.Producer, serializer kafkaClient.Serializer) *Service {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return &Service{
+		log:        log.Named("stats"),
+		cfg:        cfg.Stats,
+		producer:   producer,
+		serializer: serializer,
+		topics:     kafkaClient.NewTopicNamer(cfg.Kafka),
+		host:       host,
+		replay:     cfg.Capture.ReplayPath != "",
+		done:       make(chan struct{}),
+		symbols:    make(map[string][]*window),
+	}
+}
+
+// Add counts a trade into every window of its symbol. It is called by the listener for every new
+// trade.
+func (s *Service) Add(trade trades.Ticker) {
+	price, err := strconv.ParseFloat(trade.Price, 64)
+	if err != nil || price <= 0 {
+		s.log.Debugw("Ignoring trade without a valid price", logger.FieldSymbol, trade.Symbol, "price", trade.Price)
+		return
+	}
+	quantity, err := strconv.ParseFloat(trade.Quantity, 64)
+	if err != nil || quantity < 0 {
+		s.log.Debugw("Ignoring trade without a valid quantity", logger.FieldSymbol, trade.Symbol, "quantity", trade.Quantity)
+		return
+	}
+	at := time.UnixMilli(trade.Time)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	windows, ok := s.symbols[trade.Symbol]
+	if !ok {
+		for _, length := range s.cfg.Windows {
+			windows = append(windows, newWindow(length*time.Second))
+		}
+		s.symbols[trade.Symbol] = windows
+	}
+	for _, w := range windows {
+		w.add(price, quantity, at)
+	}
+	if at.After(s.latest) {
+		s.latest = at
+	}
+}
+
+// endTime returns the time the windows end at for a snapshot taken at now.
+func (s *Service) endTime(now time.Time) time.Time {
+	if s.replay {
+		return s.latest
+	}
+	return now
+}
+
+// Snapshot returns the statistics of symbol for every window at now, or false when no trade of
+// symbol was seen yet.
+func (s *Service) Snapshot(symbol string, now time.Time) ([]WindowStats, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	windows, ok := s.symbols[strings.ToUpper(symbol)]
+	if !ok {
+		return nil, false
+	}
+	return s.snapshot(strings.ToUpper(symbol), windows, s.endTime(now)), true
+}
+
+func (s *Service) snapshot(symbol string, windows []*window, now time.Time) []WindowStats {
+	snapshot := make([]WindowStats, 0, len(windows))
+	for _, w := range windows {
+		stats := w.snapshot(now)
+		stats.Symbol = symbol
+		stats.Time = now.UnixMilli()
+		snapshot = append(snapshot, stats)
+	}
+	return snapshot
+}
+
+// Run publishes the statistics of all symbols every PublishInterval until ctx is done.
+func (s *Service) Run(ctx context.Context) error {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.cfg.PublishInterval * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			if err := s.publish(ctx, now); err != nil && ctx.Err() == nil {
+				s.log.Errorw("Publishing statistics failed", logger.FieldError, err)
+			}
+		}
+	}
+}
+
+// Close waits for Run to return, so that nothing is published after the Kafka producer closes, or for
+// ctx to expire.
+func (s *Service) Close(ctx context.Context) error {
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Service) publish(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	symbols := make([]string, 0, len(s.symbols))
+	for symbol := range s.symbols {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	var snapshots []WindowStats
+	for _, symbol := range symbols {
+		snapshots = append(snapshots, s.snapshot(symbol, s.symbols[symbol], s.endTime(now))...)
+	}
+	s.mu.Unlock()
+
+	messages := make([]kafka.Message, 0, len(snapshots))
+	for _, stats := range snapshots {
+		topic := s.topics.Topic(trades.ExchangeName, kafkaClient.StreamStats, stats.Symbol)
+		value, err := s.serializer.Serialize(ctx, topic, stats)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, kafka.Message{
+			Topic: topic,
+			Key:   []byte(stats.Symbol),
+			Value: value,
+			Headers: kafkaClient.Provenance{
+				Exchange:      trades.ExchangeName,
+				Stream:        kafkaClient.StreamStats,
+				Format:        s.serializer.Format(),
+				SchemaVersion: windowStatsSchema.Version,
+				IngestHost:    s.host,
+				IngestTime:    now,
+			}.Headers(),
+		})
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return s.producer.PublishMessage(ctx, messages...)
+}
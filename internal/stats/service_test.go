@@ -0,0 +1,82 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"github.com/sefikcan/read-time-trade/internal/trades"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestService(replayPath string) *Service {
+	cfg := &config.Config{
+		Logger:  config.LoggerConfig{Level: "error", Encoding: "json"},
+		Stats:   config.StatsConfig{Enabled: true, Windows: []time.Duration{60}, PublishInterval: 5},
+		Capture: config.CaptureConfig{ReplayPath: replayPath},
+	}
+	log := logger.NewLogger(cfg)
+	log.InitLogger()
+	return NewService(log, cfg, nil, nil)
+}
+
+func addTrades(s *Service, start time.Time, prices ...float64) {
+	for i, price := range prices {
+		s.Add(trades.Ticker{
+			Symbol:   "BTCUSDT",
+			Price:    strconv.FormatFloat(price, 'f', -1, 64),
+			Quantity: "1",
+			Time:     start.Add(time.Duration(i) * time.Second).UnixMilli(),
+		})
+	}
+}
+
+// Replayed trades are past: the windows end at the latest of them, not at the wall clock.
+func TestServiceSnapshotOfAReplay(t *testing.T) {
+	s := newTestService("capture.gz")
+	addTrades(s, windowStart, 100, 101, 102)
+
+	windows, ok := s.Snapshot("btcusdt", time.Now())
+	if !ok || len(windows) != 1 {
+		t.Fatalf("snapshot %+v, %v", windows, ok)
+	}
+	if got := windows[0]; got.Trades != 3 || got.High != 102 || got.Time != windowStart.Add(2*time.Second).UnixMilli() {
+		t.Errorf("replay snapshot %+v, want the 3 trades at the time of the last", got)
+	}
+}
+
+func TestServiceSnapshotOfLiveTrades(t *testing.T) {
+	s := newTestService("")
+	now := time.Now()
+	addTrades(s, now.Add(-90*time.Second), 100)
+	addTrades(s, now.Add(-2*time.Second), 101, 102)
+
+	windows, _ := s.Snapshot("BTCUSDT", now)
+	if got := windows[0]; got.Trades != 2 || got.Low != 101 || got.Time != now.UnixMilli() {
+		t.Errorf("live snapshot %+v, want the 2 trades of the last minute", got)
+	}
+}
+
+// Close waits for Run to return, so the producer is not closed under a publish.
+func TestServiceClose(t *testing.T) {
+	s := newTestService("")
+	ctx, cancel := context.WithCancel(context.Background())
+	returned := make(chan error, 1)
+	go func() { returned <- s.Run(ctx) }()
+
+	expired, stop := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer stop()
+	if err := s.Close(expired); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("close of a running service: %v", err)
+	}
+
+	cancel()
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("close after run: %v", err)
+	}
+	if err := <-returned; err != nil {
+		t.Errorf("run: %v", err)
+	}
+}
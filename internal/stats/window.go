@@ -0,0 +1,110 @@
+package stats
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// bucketsPerWindow sets the resolution of a window: a 1m window keeps 1/6s buckets, a 24h window
+// 4m buckets. TWAP and volatility are sampled at this resolution.
+const bucketsPerWindow = 360
+
+// bucket aggregates the trades of one interval of a window. index numbers the interval since
+// the unix epoch, so a slot of the ring can tell whether it holds a current interval.
+type bucket struct {
+	index    int64
+	count    int64
+	volume   float64
+	notional float64
+	high     float64
+	low      float64
+	close    float64
+}
+
+// window keeps the trades of the last length as a ring of buckets, so that adding a trade and
+// taking a snapshot cost the same whatever the trade rate.
+type window struct {
+	length     time.Duration
+	resolution time.Duration
+	buckets    []bucket
+}
+
+func newWindow(length time.Duration) *window {
+	return &window{
+		length:     length,
+		resolution: length / bucketsPerWindow,
+		buckets:    make([]bucket, bucketsPerWindow),
+	}
+}
+
+func (w *window) add(price, quantity float64, at time.Time) {
+	index := at.UnixNano() / int64(w.resolution)
+	b := &w.buckets[index%bucketsPerWindow]
+	if b.index != index {
+		if b.index > index {
+			// Older than the window.
+			return
+		}
+		*b = bucket{index: index, high: price, low: price}
+	}
+
+	b.count++
+	b.volume += quantity
+	b.notional += price * quantity
+	b.high = math.Max(b.high, price)
+	b.low = math.Min(b.low, price)
+	b.close = price
+}
+
+// snapshot computes the statistics of the buckets within length of now.
+func (w *window) snapshot(now time.Time) WindowStats {
+	stats := WindowStats{Window: windowLabel(w.length)}
+
+	current := now.UnixNano() / int64(w.resolution)
+	var notional, closes, squaredReturns float64
+	var sampled int64
+	var last float64
+	for index := current - bucketsPerWindow + 1; index <= current; index++ {
+		b := w.buckets[index%bucketsPerWindow]
+		if b.index == index {
+			if stats.Trades == 0 {
+				stats.High, stats.Low = b.high, b.low
+			} else {
+				squaredReturns += math.Pow(math.Log(b.close/last), 2)
+			}
+			stats.Trades += b.count
+			stats.Volume += b.volume
+			notional += b.notional
+			stats.High = math.Max(stats.High, b.high)
+			stats.Low = math.Min(stats.Low, b.low)
+			last = b.close
+		}
+		// From the first trade on, every interval is sampled at its latest price for the TWAP.
+		if stats.Trades > 0 {
+			closes += last
+			sampled++
+		}
+	}
+
+	if stats.Volume > 0 {
+		stats.Vwap = notional / stats.Volume
+	}
+	if sampled > 0 {
+		stats.Twap = closes / float64(sampled)
+	}
+	stats.Volatility = math.Sqrt(squaredReturns)
+	return stats
+}
+
+// windowLabel names a window the way it is configured, e.g. 1m, 5m, 1h or 24h.
+func windowLabel(length time.Duration) string {
+	switch {
+	case length%time.Hour == 0:
+		return strconv.FormatInt(int64(length/time.Hour), 10) + "h"
+	case length%time.Minute == 0:
+		return strconv.FormatInt(int64(length/time.Minute), 10) + "m"
+	default:
+		return strconv.FormatInt(int64(length/time.Second), 10) + "s"
+	}
+}
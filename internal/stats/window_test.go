@@ -0,0 +1,111 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const tolerance = 1e-9
+
+// windowStart is a whole second, so a 6m window has a bucket of every second from it.
+var windowStart = time.Unix(1700000000, 0)
+
+type windowTrade struct {
+	price, quantity float64
+	at              time.Duration
+}
+
+func TestWindow(t *testing.T) {
+	trades := []windowTrade{
+		{100, 1, 0},
+		{102, 2, 500 * time.Millisecond},
+		{101, 1, 2 * time.Second},
+		{99, 4, 3 * time.Second},
+	}
+	cases := []struct {
+		name   string
+		trades []windowTrade
+		at     time.Duration
+		want   WindowStats
+	}{
+		{
+			// Buckets close at 102, 101 and 99; the TWAP samples 102, 102, 101 and 99.
+			name:   "all trades",
+			trades: trades,
+			at:     3 * time.Second,
+			want:   WindowStats{Trades: 4, Volume: 8, Vwap: 801.0 / 8, Twap: 101, High: 102, Low: 99, Volatility: 0.02229561423043237},
+		},
+		{
+			name:   "before the trades",
+			trades: trades,
+			at:     -time.Second,
+			want:   WindowStats{},
+		},
+		{
+			// The bucket of the first two trades left the window.
+			name:   "evicted",
+			trades: trades,
+			at:     360 * time.Second,
+			want:   WindowStats{Trades: 2, Volume: 5, Vwap: 497.0 / 5, Twap: (101 + 358*99) / 359.0, High: 101, Low: 99, Volatility: 0.020000666706669543},
+		},
+		{
+			name:   "all evicted",
+			trades: trades,
+			at:     363 * time.Second,
+			want:   WindowStats{},
+		},
+		{
+			// The trade at 360s takes the slot of the bucket of the first two trades.
+			name:   "rollover",
+			trades: append(append([]windowTrade{}, trades...), windowTrade{110, 1, 360 * time.Second}),
+			at:     360 * time.Second,
+			want:   WindowStats{Trades: 3, Volume: 6, Vwap: 607.0 / 6, Twap: (101 + 357*99 + 110) / 359.0, High: 110, Low: 99, Volatility: 0.10724208562124457},
+		},
+		{
+			// A trade older than the bucket in its slot is dropped.
+			name:   "older than the window",
+			trades: append(append([]windowTrade{}, trades...), windowTrade{110, 1, 360 * time.Second}, windowTrade{1, 100, 0}),
+			at:     360 * time.Second,
+			want:   WindowStats{Trades: 3, Volume: 6, Vwap: 607.0 / 6, Twap: (101 + 357*99 + 110) / 359.0, High: 110, Low: 99, Volatility: 0.10724208562124457},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := newWindow(6 * time.Minute)
+			for _, trade := range c.trades {
+				w.add(trade.price, trade.quantity, windowStart.Add(trade.at))
+			}
+			got := w.snapshot(windowStart.Add(c.at))
+			c.want.Window = "6m"
+			if !statsEqual(got, c.want) {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func statsEqual(a, b WindowStats) bool {
+	floats := [][2]float64{{a.Volume, b.Volume}, {a.Vwap, b.Vwap}, {a.Twap, b.Twap}, {a.High, b.High}, {a.Low, b.Low}, {a.Volatility, b.Volatility}}
+	for _, f := range floats {
+		if math.Abs(f[0]-f[1]) > tolerance {
+			return false
+		}
+	}
+	return a.Symbol == b.Symbol && a.Window == b.Window && a.Time == b.Time && a.Trades == b.Trades
+}
+
+func TestWindowLabel(t *testing.T) {
+	cases := map[time.Duration]string{
+		time.Minute:      "1m",
+		5 * time.Minute:  "5m",
+		time.Hour:        "1h",
+		24 * time.Hour:   "24h",
+		90 * time.Second: "90s",
+	}
+	for length, want := range cases {
+		if got := windowLabel(length); got != want {
+			t.Errorf("windowLabel(%v) = %s, want %s", length, got, want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package trades
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// NewDialer builds the WebSocket dialer for the exchange connection from the exchange settings.
+func NewDialer(cfg config.ExchangeConfig) (*websocket.Dialer, error) {
+	dialer := &websocket.Dialer{
+		Proxy:             http.ProxyFromEnvironment,
+		HandshakeTimeout:  cfg.HandshakeTimeout * time.Second,
+		ReadBufferSize:    cfg.ReadBufferSize,
+		WriteBufferSize:   cfg.WriteBufferSize,
+		EnableCompression: cfg.Compression,
+	}
+
+	if cfg.ProxyUrl != "" {
+		proxyUrl, err := url.Parse(cfg.ProxyUrl)
+		if err != nil {
+			return nil, fmt.Errorf("parse proxy url: %w", err)
+		}
+		dialer.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	if cfg.CaBundle != "" {
+		pem, err := os.ReadFile(cfg.CaBundle)
+		if err != nil {
+			return nil, fmt.Errorf("read ca bundle: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca bundle %s contains no certificates", cfg.CaBundle)
+		}
+		dialer.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return dialer, nil
+}
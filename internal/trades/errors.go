@@ -0,0 +1,125 @@
+package trades
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"time"
+)
+
+// ErrorClass groups trade pipeline failures that share a failure policy.
+type ErrorClass string
+
+const (
+	ConnectionError ErrorClass = "connection"
+	SubscribeError  ErrorClass = "subscribe"
+	DecodeError     ErrorClass = "decode"
+	PublishError    ErrorClass = "publish"
+)
+
+// Error is a trade pipeline failure tagged with its class.
+type Error struct {
+	Class  ErrorClass
+	Symbol string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Symbol != "" {
+		return fmt.Sprintf("%s error for %s: %s", e.Class, e.Symbol, e.Err)
+	}
+	return fmt.Sprintf("%s error: %s", e.Class, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ClassOf returns the class of the first trade pipeline error in err's chain, or an empty class.
+func ClassOf(err error) ErrorClass {
+	var tradeErr *Error
+	if errors.As(err, &tradeErr) {
+		return tradeErr.Class
+	}
+	return ""
+}
+
+// FailureAction is what the listener does when an error of a class occurs.
+type FailureAction string
+
+const (
+	// Retry reconnects (connection, subscribe) or re-publishes (publish) up to MaxRetries times
+	// and escalates afterwards. Decode errors cannot be retried and are skipped instead.
+	Retry FailureAction = "retry"
+	// Skip drops the affected frame or message, counts it and carries on. Connection and
+	// subscribe errors reconnect without a retry limit.
+	Skip FailureAction = "skip"
+	// Escalate stops the listener and returns the error to its caller.
+	Escalate FailureAction = "escalate"
+)
+
+// FailurePolicy maps every error class to an action.
+type FailurePolicy struct {
+	actions      map[ErrorClass]FailureAction
+	MaxRetries   int
+	RetryBackoff time.Duration
+}
+
+func DefaultFailurePolicy() FailurePolicy {
+	return FailurePolicy{
+		actions: map[ErrorClass]FailureAction{
+			ConnectionError: Retry,
+			SubscribeError:  Retry,
+			DecodeError:     Skip,
+			PublishError:    Skip,
+		},
+		MaxRetries:   5,
+		RetryBackoff: time.Second,
+	}
+}
+
+// NewFailurePolicy builds a policy from configuration. Empty settings keep the defaults.
+func NewFailurePolicy(cfg config.FailurePolicyConfig) (FailurePolicy, error) {
+	policy := DefaultFailurePolicy()
+
+	settings := map[ErrorClass]string{
+		ConnectionError: cfg.Connection,
+		SubscribeError:  cfg.Subscribe,
+		DecodeError:     cfg.Decode,
+		PublishError:    cfg.Publish,
+	}
+	var errs []error
+	for class, setting := range settings {
+		switch action := FailureAction(setting); action {
+		case "":
+		case Retry, Skip, Escalate:
+			policy.actions[class] = action
+		default:
+			errs = append(errs, fmt.Errorf("failurePolicy.%s: unknown action %q", class, setting))
+		}
+	}
+
+	if cfg.MaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("failurePolicy.maxRetries: must not be negative"))
+	} else if cfg.MaxRetries > 0 {
+		policy.MaxRetries = cfg.MaxRetries
+	}
+	if cfg.RetryBackoff < 0 {
+		errs = append(errs, fmt.Errorf("failurePolicy.retryBackoff: must not be negative"))
+	} else if cfg.RetryBackoff > 0 {
+		policy.RetryBackoff = cfg.RetryBackoff * time.Second
+	}
+
+	return policy, errors.Join(errs...)
+}
+
+func (p FailurePolicy) Action(class ErrorClass) FailureAction {
+	action, ok := p.actions[class]
+	if !ok {
+		return Escalate
+	}
+	if class == DecodeError && action == Retry {
+		return Skip
+	}
+	return action
+}
@@ -2,36 +2,137 @@ package trades
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/websocket"
+	"github.com/sefikcan/read-time-trade/pkg/capture"
 	"github.com/sefikcan/read-time-trade/pkg/config"
 	kafkaClient "github.com/sefikcan/read-time-trade/pkg/kafka"
 	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/sefikcan/read-time-trade/pkg/metric"
+	"github.com/sefikcan/read-time-trade/pkg/tracing"
 	"github.com/segmentio/kafka-go"
-	"net/url"
-	"strconv"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// TradeListener streams aggregated trades for a fixed set of symbols into Kafka.
+// Every listener owns its own exchange connection, so several can run side by side.
 type TradeListener interface {
-	GetConnection() (*websocket.Conn, error)
-	CloseConnection()
-	CreateConnection() (*websocket.Conn, error)
-	UnSubscribeAndClose(conn *websocket.Conn, tradeTopics []string) error
-	SubscribeAndListen(topics []string)
+	// Start connects, subscribes and reads trades until ctx is cancelled, Stop is called
+	// or an error escalates according to the failure policy.
+	Start(ctx context.Context) error
+	// Stop unsubscribes, closes the connection and waits for Start to return and in-flight
+	// Kafka messages to drain, or for ctx to expire.
+	Stop(ctx context.Context) error
+	// Replay feeds a recorded capture through the trade pipeline instead of a live connection.
+	Replay(ctx context.Context, path string, speed float64) error
+	// Skipped reports how many errors of a class were skipped so far.
+	Skipped(class ErrorClass) uint64
+	// Connected reports whether the listener currently holds a subscribed connection.
+	Connected() bool
+	// DisconnectedSince returns when the listener last lost or has not yet had a connection.
+	DisconnectedSince() time.Time
+	// LastTrades returns the receive time of the latest trade per subscribed symbol.
+	LastTrades() map[string]time.Time
+	// RecorderErr returns the last error writing the capture file, if recording.
+	RecorderErr() error
+	// SetSymbols changes the streamed symbols. On a live connection the added streams are
+	// subscribed and the removed ones unsubscribed right away.
+	SetSymbols(symbols []string) error
+	// SetPolicy replaces the failure policy for errors handled from now on.
+	SetPolicy(policy FailurePolicy)
+	// OnTrade registers fn to be called with every new trade before it is published. fn runs on
+	// the read loop and must return quickly.
+	OnTrade(fn func(trade Ticker))
 }
 
 type tradeListener struct {
 	log           logger.Logger
 	cfg           *config.Config
 	kafkaProducer kafkaClient.Producer
+	serializer    kafkaClient.Serializer
+	topics        *kafkaClient.TopicNamer
+	host          string
+	metrics       metric.Metrics
+	sampledLog    logger.Logger
+
+	mu          sync.Mutex
+	writeMu     sync.Mutex
+	subscribeMu sync.Mutex
+	policy      FailurePolicy
+	streams     []string
+	tradeLogs   map[string]logger.Logger
+	observers   []func(trade Ticker)
+	conn        *websocket.Conn
+	stopping    bool
+	escalated   error
+	done        chan struct{}
+	publishers  *publishers
+	recorder    *capture.Writer
+
+	connected         bool
+	disconnectedSince time.Time
+	lastTrades        map[string]time.Time
+	lastAggTradeIds   map[string]int64
+	recorderErr       error
+
+	skipped map[ErrorClass]*atomic.Uint64
 }
 
-func NewTradeListener(log logger.Logger, cfg *config.Config, kafkaProducer kafkaClient.Producer) *tradeListener {
+func NewTradeListener(log logger.Logger, cfg *config.Config, kafkaProducer kafkaClient.Producer, serializer kafkaClient.Serializer, metrics metric.Metrics, policy FailurePolicy, symbols []string) *tradeListener {
+	log = log.Named("listener").With(logger.FieldExchange, ExchangeName)
+	sampledLog := log.Sampled()
+
+	streams := make([]string, 0, len(symbols))
+	lastTrades := make(map[string]time.Time, len(symbols))
+	tradeLogs := make(map[string]logger.Logger, len(symbols))
+	for _, symbol := range symbols {
+		streams = append(streams, streamName(symbol))
+		lastTrades[strings.ToUpper(symbol)] = time.Time{}
+		tradeLogs[strings.ToUpper(symbol)] = sampledLog.Named(strings.ToLower(symbol))
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
 	return &tradeListener{
-		log:           log,
-		cfg:           cfg,
-		kafkaProducer: kafkaProducer,
+		log:               log,
+		cfg:               cfg,
+		kafkaProducer:     kafkaProducer,
+		serializer:        serializer,
+		topics:            kafkaClient.NewTopicNamer(cfg.Kafka),
+		host:              host,
+		metrics:           metrics,
+		policy:            policy,
+		streams:           streams,
+		tradeLogs:         tradeLogs,
+		sampledLog:        sampledLog,
+		disconnectedSince: time.Now(),
+		lastTrades:        lastTrades,
+		lastAggTradeIds:   make(map[string]int64, len(symbols)),
+		publishers:        newPublishers(),
+		skipped: map[ErrorClass]*atomic.Uint64{
+			ConnectionError: {},
+			SubscribeError:  {},
+			DecodeError:     {},
+			PublishError:    {},
+		},
 	}
 }
 
@@ -41,151 +142,792 @@ type RequestParams struct {
 	Params []string `json:"params"`
 }
 
-var conn *websocket.Conn
+// streamMessage is any frame of the stream: an aggTrade event or a response to a request.
+// EventTime and Ignore are declared so that "E" and "M" are not matched case-insensitively onto
+// EventType and BuyerMaker.
+type streamMessage struct {
+	Ticker
+	EventType  string           `json:"e"`
+	EventTime  int64            `json:"E"`
+	BuyerMaker bool             `json:"m"`
+	Ignore     bool             `json:"M"`
+	AggTradeId int64            `json:"a"`
+	Id         *int             `json:"id"`
+	Error      *exchangeFailure `json:"error"`
+}
+
+type exchangeFailure struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// source tells where and when a frame was received, for the provenance headers of its trade.
+type source struct {
+	connectionId string
+	receivedAt   time.Time
+}
 
 const (
 	subscribeId   = 1
 	unSubscribeId = 2
+
+	ExchangeName       = "binance"
+	aggTradeEvent      = "aggTrade"
+	defaultExchangeUrl = "wss://stream.binance.com:9443/ws"
+	closeGracePeriod   = time.Second
 )
 
-func (l *tradeListener) GetConnection() (*websocket.Conn, error) {
-	if conn != nil {
-		return conn, nil
+var ErrListenerRunning = errors.New("trade listener is already running")
+
+func (l *tradeListener) Start(ctx context.Context) error {
+	l.mu.Lock()
+	if l.done != nil {
+		l.mu.Unlock()
+		return ErrListenerRunning
 	}
+	done := make(chan struct{})
+	l.done = done
+	l.stopping = false
+	l.escalated = nil
+	l.mu.Unlock()
 
-	u := url.URL{Scheme: "wss", Host: "stream.binance.com:9443", Path: "/ws"}
-	l.log.Infof("Connecting to %s", u.String())
-	c, resp, err := websocket.DefaultDialer.Dial(u.String(), nil)
-	if err != nil {
-		l.log.Infof("Handshake failed with status %d", resp.StatusCode)
-		l.log.Fatal("Dial:", err)
+	defer func() {
+		l.mu.Lock()
+		l.conn = nil
+		l.done = nil
+		l.recorder = nil
+		l.mu.Unlock()
+		close(done)
+	}()
+
+	if l.cfg.Capture.RecordPath != "" {
+		recorder, err := capture.NewWriter(l.cfg.Capture.RecordPath)
+		if err != nil {
+			return err
+		}
+		l.log.Infow("Recording raw frames", "path", l.cfg.Capture.RecordPath)
+		l.recorder = recorder
+		defer func(recorder *capture.Writer) {
+			err := recorder.Close()
+			if err != nil {
+				l.log.Errorw("Failed to close capture file", "path", l.cfg.Capture.RecordPath, logger.FieldError, err)
+			}
+		}(recorder)
 	}
 
-	return c, nil
+	go func() {
+		select {
+		case <-ctx.Done():
+			stopCtx, cancel := context.WithTimeout(context.Background(), closeGracePeriod)
+			defer cancel()
+			if err := l.shutdown(stopCtx); err != nil {
+				l.log.Errorw("Failed to stop trade listener", logger.FieldError, err)
+			}
+		case <-done:
+		}
+	}()
+
+	retries := 0
+	for {
+		healthy, err := l.session(ctx)
+		if l.isStopping() || ctx.Err() != nil {
+			return l.escalatedErr()
+		}
+		if escalated := l.escalatedErr(); escalated != nil {
+			return escalated
+		}
+		if healthy {
+			retries = 0
+		}
+
+		class := ClassOf(err)
+		l.metrics.IncreasePipelineErrors(string(class))
+		policy := l.currentPolicy()
+		switch policy.Action(class) {
+		case Retry:
+			if retries >= policy.MaxRetries {
+				return fmt.Errorf("giving up after %d retries: %w", retries, err)
+			}
+			retries++
+			l.log.Warnw("Reconnecting", logger.FieldError, err, "class", class, "attempt", retries, "maxRetries", policy.MaxRetries)
+		case Skip:
+			l.log.Warnw("Reconnecting", logger.FieldError, err, "class", class, "skipped", l.skip(class))
+		default:
+			return err
+		}
+
+		timer := time.NewTimer(policy.RetryBackoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		l.metrics.IncreaseReconnects()
+	}
 }
 
-func (l *tradeListener) CloseConnections() {
-	err := conn.Close()
+// session runs a single connection from dial to the first error. healthy reports whether any
+// trade was received on it, which resets the retry budget.
+func (l *tradeListener) session(ctx context.Context) (healthy bool, err error) {
+	conn, err := l.connect(ctx)
 	if err != nil {
-		l.log.Fatal(err)
+		return false, &Error{Class: ConnectionError, Err: err}
 	}
-}
+	defer func(conn *websocket.Conn) {
+		_ = conn.Close()
+	}(conn)
+
+	l.mu.Lock()
+	l.conn = conn
+	stopped := l.stopping
+	l.mu.Unlock()
+	if stopped {
+		return false, nil
+	}
+
+	conn.SetPongHandler(func(appData string) error {
+		l.log.Debugw("Received pong", "appData", appData)
+		pingFrame := []byte{1, 2, 3, 4, 5}
+		return l.write(conn, websocket.PingMessage, pingFrame)
+	})
 
-func (l *tradeListener) CreateConnection() (*websocket.Conn, error) {
-	connection, err := l.GetConnection()
+	streams, err := l.subscribe(conn)
 	if err != nil {
-		l.log.Fatalf("Failed to get connection %s", err.Error())
-		return nil, err
+		return false, &Error{Class: SubscribeError, Err: err}
 	}
+	connectionId := newConnectionId()
+	l.log.Infow("Listening to trades", logger.FieldStream, streams, logger.FieldConnectionId, connectionId)
+
+	l.setConnected(true)
+	defer l.setConnected(false)
+
+	for {
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			return healthy, &Error{Class: ConnectionError, Err: err}
+		}
 
-	return connection, nil
+		receivedAt := time.Now()
+		if l.recorder != nil {
+			err = l.recorder.Write(capture.Frame{ReceivedAt: receivedAt, Payload: payload})
+			if err != nil {
+				l.log.Errorw("Failed to record frame", logger.FieldError, err)
+			}
+			l.mu.Lock()
+			l.recorderErr = err
+			l.mu.Unlock()
+		}
+
+		trade, err := l.receive(ctx, payload, source{connectionId: connectionId, receivedAt: receivedAt})
+		if err != nil {
+			if err = l.handleFailure(err); err != nil {
+				return healthy, err
+			}
+		}
+		if trade {
+			healthy = true
+		}
+	}
 }
 
-func (l *tradeListener) UnSubscribeAndClose(conn *websocket.Conn, tradeTopics []string) error {
-	message := struct {
-		Id     int      `json:"id"`
-		Method string   `json:"method"`
-		Params []string `json:"params"`
-	}{
-		Id:     unSubscribeId,
-		Method: "UNSUBSCRIBE",
-		Params: tradeTopics,
+func (l *tradeListener) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	done := l.done
+	l.mu.Unlock()
+
+	if done != nil {
+		if err := l.shutdown(ctx); err != nil {
+			return err
+		}
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 
-	b, err := json.Marshal(message)
-	if err != nil {
-		l.log.Fatal("Failed to JSON Encode trade topics")
-		return err
+	return l.drainPublishers(ctx)
+}
+
+func (l *tradeListener) Connected() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.connected
+}
+
+func (l *tradeListener) DisconnectedSince() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.disconnectedSince
+}
+
+func (l *tradeListener) LastTrades() map[string]time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lastTrades := make(map[string]time.Time, len(l.lastTrades))
+	for symbol, at := range l.lastTrades {
+		lastTrades[symbol] = at
 	}
+	return lastTrades
+}
 
-	err = conn.WriteMessage(websocket.TextMessage, b)
+func (l *tradeListener) RecorderErr() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	return nil
+	return l.recorderErr
 }
 
-func (l *tradeListener) SubscribeAndListen(topics []string) error {
-	conn, err := l.GetConnection()
-	if err != nil {
-		l.log.Fatalf("Failed to get connection %s", err.Error())
-		return err
+func (l *tradeListener) setConnected(connected bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.connected == connected {
+		return
 	}
+	if connected {
+		l.metrics.AddActiveSubscriptions(len(l.streams))
+	} else {
+		l.metrics.AddActiveSubscriptions(-len(l.streams))
+		l.disconnectedSince = time.Now()
+	}
+	l.connected = connected
+}
 
-	conn.SetPongHandler(func(appData string) error {
-		l.log.Info("Received pong:", appData)
-		pingFrame := []byte{1, 2, 3, 4, 5}
-		err := conn.WriteMessage(websocket.PingMessage, pingFrame)
-		if err != nil {
-			l.log.Fatal(err)
+func (l *tradeListener) SetSymbols(symbols []string) error {
+	l.subscribeMu.Lock()
+	defer l.subscribeMu.Unlock()
+
+	l.mu.Lock()
+	wanted := make(map[string]bool, len(symbols))
+	streams := make([]string, 0, len(symbols))
+	var added []string
+	for _, symbol := range symbols {
+		stream := streamName(symbol)
+		wanted[stream] = true
+		streams = append(streams, stream)
+		if _, ok := l.lastTrades[strings.ToUpper(symbol)]; !ok {
+			added = append(added, stream)
+			l.lastTrades[strings.ToUpper(symbol)] = time.Time{}
+			l.tradeLogs[strings.ToUpper(symbol)] = l.sampledLog.Named(strings.ToLower(symbol))
 		}
+	}
+	var removed []string
+	for _, stream := range l.streams {
+		if !wanted[stream] {
+			removed = append(removed, stream)
+			symbol := strings.ToUpper(strings.TrimSuffix(stream, "@"+aggTradeEvent))
+			delete(l.lastTrades, symbol)
+			delete(l.lastAggTradeIds, symbol)
+			delete(l.tradeLogs, symbol)
+		}
+	}
+	if l.connected {
+		l.metrics.AddActiveSubscriptions(len(streams) - len(l.streams))
+	}
+	l.streams = streams
+	conn := l.conn
+	l.mu.Unlock()
+
+	l.log.Infow("Symbols changed", "added", added, "removed", removed)
+	if conn == nil {
 		return nil
-	})
+	}
 
-	tradeTopics := make([]string, 0, len(topics))
-	for _, topic := range topics {
-		tradeTopics = append(tradeTopics, topic+"@"+"aggTrade")
+	var errs []error
+	if len(added) > 0 {
+		if err := l.send(conn, subscribeId, "SUBSCRIBE", added); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(removed) > 0 {
+		if err := l.send(conn, unSubscribeId, "UNSUBSCRIBE", removed); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	l.log.Info("Listening to trades for ", tradeTopics)
+	return errors.Join(errs...)
+}
 
-	message := RequestParams{
-		Id:     subscribeId,
-		Method: "SUBSCRIBE",
-		Params: tradeTopics,
+func (l *tradeListener) SetPolicy(policy FailurePolicy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.policy = policy
+}
+
+func (l *tradeListener) OnTrade(fn func(trade Ticker)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.observers = append(l.observers, fn)
+}
+
+func (l *tradeListener) currentPolicy() FailurePolicy {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.policy
+}
+
+func (l *tradeListener) currentStreams() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.streams
+}
+
+func (l *tradeListener) Skipped(class ErrorClass) uint64 {
+	counter, ok := l.skipped[class]
+	if !ok {
+		return 0
 	}
+	return counter.Load()
+}
 
-	b, err := json.Marshal(message)
-	if err != nil {
-		l.log.Fatal("Failed to JSON Encode trade topics")
+// shutdown unsubscribes and closes the current connection. The read loop notices the closed
+// connection and returns from Start.
+func (l *tradeListener) shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	if l.stopping {
+		l.mu.Unlock()
+		return nil
+	}
+	l.stopping = true
+	conn := l.conn
+	l.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetWriteDeadline(deadline)
+	}
+
+	var errs []error
+	if err := l.send(conn, unSubscribeId, "UNSUBSCRIBE", l.currentStreams()); err != nil {
+		errs = append(errs, err)
+	}
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := l.write(conn, websocket.CloseMessage, closeMessage); err != nil {
+		errs = append(errs, err)
+	}
+	if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// handleFailure applies the failure policy to err. It returns nil when the error was skipped
+// and the error itself when it has to end the current session.
+func (l *tradeListener) handleFailure(err error) error {
+	class := ClassOf(err)
+	l.metrics.IncreasePipelineErrors(string(class))
+	switch l.currentPolicy().Action(class) {
+	case Skip:
+		l.log.Warnw("Skipping failure", logger.FieldError, err, "class", class, "skipped", l.skip(class))
+		return nil
+	case Escalate:
+		l.escalate(err)
+		return err
+	default:
 		return err
 	}
+}
+
+func (l *tradeListener) skip(class ErrorClass) uint64 {
+	counter, ok := l.skipped[class]
+	if !ok {
+		return 0
+	}
+	return counter.Add(1)
+}
+
+// escalate records the first escalated error and closes the connection so that Start returns it.
+func (l *tradeListener) escalate(err error) {
+	l.mu.Lock()
+	if l.escalated == nil {
+		l.escalated = err
+	}
+	conn := l.conn
+	l.mu.Unlock()
+
+	l.log.Errorw("Escalating failure", logger.FieldError, err, "class", ClassOf(err))
+	if conn != nil {
+		_ = conn.Close()
+	}
+}
 
-	err = conn.WriteMessage(websocket.TextMessage, b)
+func (l *tradeListener) escalatedErr() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.escalated
+}
+
+func (l *tradeListener) isStopping() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.stopping
+}
+
+func (l *tradeListener) connect(ctx context.Context) (*websocket.Conn, error) {
+	endpoint := l.cfg.Exchange.Url
+	if endpoint == "" {
+		endpoint = defaultExchangeUrl
+	}
+
+	dialer, err := NewDialer(l.cfg.Exchange)
 	if err != nil {
-		l.log.Fatal("Failed to subscribe to topics " + err.Error())
-		return err
+		return nil, err
 	}
 
-	defer func(conn *websocket.Conn, tradeTopics []string) {
-		err := l.UnSubscribeAndClose(conn, tradeTopics)
-		if err != nil {
-			l.log.Fatal(err)
+	type dialResult struct {
+		conn *websocket.Conn
+		resp *http.Response
+		err  error
+	}
+
+	// The dialer only honours ctx deadlines during the handshake, so cancellation is handled here
+	// and a connection completing after it is closed straight away.
+	l.log.Infow("Connecting", "url", endpoint)
+	result := make(chan dialResult, 1)
+	go func() {
+		conn, resp, err := dialer.DialContext(ctx, endpoint, nil)
+		result <- dialResult{conn: conn, resp: resp, err: err}
+	}()
+
+	select {
+	case r := <-result:
+		if r.err != nil {
+			if r.resp != nil {
+				l.log.Warnw("Handshake failed", "url", endpoint, "status", r.resp.StatusCode)
+			}
+			return nil, r.err
 		}
-	}(conn, tradeTopics)
-	defer func(conn *websocket.Conn) {
-		err := conn.Close()
+		return r.conn, nil
+	case <-ctx.Done():
+		go func() {
+			if r := <-result; r.conn != nil {
+				_ = r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// subscribe subscribes conn to the current streams and returns them. It is serialised with
+// SetSymbols, so that a concurrent symbol change is either included or applied afterwards.
+func (l *tradeListener) subscribe(conn *websocket.Conn) ([]string, error) {
+	l.subscribeMu.Lock()
+	defer l.subscribeMu.Unlock()
+
+	streams := l.currentStreams()
+	return streams, l.send(conn, subscribeId, "SUBSCRIBE", streams)
+}
+
+func (l *tradeListener) send(conn *websocket.Conn, id int, method string, streams []string) error {
+	b, err := json.Marshal(RequestParams{
+		Id:     id,
+		Method: method,
+		Params: streams,
+	})
+	if err != nil {
+		return err
+	}
+
+	return l.write(conn, websocket.TextMessage, b)
+}
+
+func (l *tradeListener) write(conn *websocket.Conn, messageType int, data []byte) error {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	return conn.WriteMessage(messageType, data)
+}
+
+// Replay feeds a recorded capture through the same decoding and publishing path as a live
+// connection. A speed of 1 keeps the original pacing, higher values accelerate it and 0 (or
+// less) replays as fast as possible.
+func (l *tradeListener) Replay(ctx context.Context, path string, speed float64) error {
+	reader, err := capture.NewReader(path)
+	if err != nil {
+		return err
+	}
+	defer func(reader *capture.Reader) {
+		err := reader.Close()
 		if err != nil {
-			l.log.Fatal(err)
+			l.log.Errorw("Failed to close capture file", "path", path, logger.FieldError, err)
 		}
-	}(conn)
+	}(reader)
 
+	// A capture starts its own sequence of aggregate trade ids, which a previous replay or
+	// session must not make look like duplicates.
+	l.mu.Lock()
+	l.escalated = nil
+	l.lastAggTradeIds = make(map[string]int64, len(l.lastTrades))
+	l.mu.Unlock()
+
+	l.log.Infow("Replaying capture", "path", path, "speed", speed)
+	// Captures do not record the connections, so replayed trades are attributed to the file.
+	connectionId := "replay:" + filepath.Base(path)
+
+	var previous time.Time
+	frames := 0
 	for {
-		_, payload, err := conn.ReadMessage()
-		if err != nil {
-			l.log.Fatal(err)
-			return err
+		frame, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
 		}
-
-		trade := Ticker{}
-		err = json.Unmarshal(payload, &trade)
 		if err != nil {
-			l.log.Fatal(err)
 			return err
 		}
-		l.log.Info(trade.Symbol, trade.Price, trade.Quantity)
 
-		go func() {
-			bytes, err := json.Marshal(trade)
-			if err != nil {
-				l.log.Fatalf("Error marshalling ticker data: %s", err.Error())
+		if speed > 0 && !previous.IsZero() {
+			if gap := frame.ReceivedAt.Sub(previous); gap > 0 {
+				timer := time.NewTimer(time.Duration(float64(gap) / speed))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
 			}
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		previous = frame.ReceivedAt
 
-			err = l.kafkaProducer.PublishMessage(context.Background(), kafka.Message{
-				Key:   []byte(trade.Symbol + "-" + strconv.Itoa(int(trade.Time))),
-				Value: bytes,
-				Topic: "trades-" + strings.ToLower(trade.Symbol),
-			})
-			if err != nil {
-				l.log.Fatal(err)
+		if _, err = l.receive(ctx, frame.Payload, source{connectionId: connectionId, receivedAt: frame.ReceivedAt}); err != nil {
+			if err = l.handleFailure(err); err != nil {
+				return fmt.Errorf("frame %d of %s: %w", frames, path, err)
 			}
-		}()
+		}
+		if escalated := l.escalatedErr(); escalated != nil {
+			return escalated
+		}
+		frames++
+	}
+
+	l.log.Infow("Replay finished", "path", path, "frames", frames)
+	return nil
+}
+
+// receive traces a single frame received at receivedAt through decoding, deduplication and
+// publishing. It reports whether the frame was a new trade.
+func (l *tradeListener) receive(ctx context.Context, payload []byte, src source) (bool, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "exchange.receive",
+		trace.WithTimestamp(src.receivedAt),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.Int("frame.size", len(payload))),
+	)
+	defer span.End()
+
+	trade, err := l.handleMessage(ctx, payload, src)
+	if err != nil {
+		tracing.RecordError(span, err)
+	}
+	return trade, err
+}
+
+// handleMessage decodes a frame and publishes it when it is a trade not seen before. Responses to
+// SUBSCRIBE/UNSUBSCRIBE requests are only checked for errors.
+func (l *tradeListener) handleMessage(ctx context.Context, payload []byte, src source) (bool, error) {
+	_, decodeSpan := tracing.Tracer().Start(ctx, "trade.decode")
+	message := streamMessage{}
+	err := json.Unmarshal(payload, &message)
+	if err != nil {
+		err = &Error{Class: DecodeError, Err: err}
+		tracing.RecordError(decodeSpan, err)
+		decodeSpan.End()
+		return false, err
+	}
+	decodeSpan.End()
+
+	if message.Id != nil {
+		if message.Error != nil {
+			return false, &Error{Class: SubscribeError, Err: fmt.Errorf("request %d rejected with code %d: %s", *message.Id, message.Error.Code, message.Error.Msg)}
+		}
+		return false, nil
+	}
+
+	if message.EventType != aggTradeEvent || message.Symbol == "" {
+		return false, &Error{Class: DecodeError, Err: fmt.Errorf("unexpected %q event", message.EventType)}
+	}
+
+	trade := message.Ticker
+	trade.BuyerMaker = message.BuyerMaker
+	_, dedupSpan := tracing.Tracer().Start(ctx, "trade.dedup", trace.WithAttributes(
+		attribute.String("trade.symbol", trade.Symbol),
+		attribute.Int64("trade.aggregate_id", message.AggTradeId),
+	))
+	subscribed, duplicate := l.admit(trade.Symbol, message.AggTradeId)
+	dedupSpan.SetAttributes(attribute.Bool("trade.subscribed", subscribed), attribute.Bool("trade.duplicate", duplicate))
+	dedupSpan.End()
+	if !subscribed {
+		// Frames of a symbol just removed by SetSymbols can arrive until the exchange confirms
+		// the UNSUBSCRIBE.
+		l.log.DebugCtx(ctx, "Dropping trade of an unsubscribed symbol", logger.FieldSymbol, trade.Symbol, "aggTradeId", message.AggTradeId)
+		return false, nil
+	}
+	if duplicate {
+		l.tradeLog(trade.Symbol).DebugCtx(ctx, "Dropping duplicate trade", logger.FieldSymbol, trade.Symbol, "aggTradeId", message.AggTradeId)
+		return false, nil
+	}
+
+	l.tradeLog(trade.Symbol).DebugCtx(ctx, "Trade received",
+		logger.FieldSymbol, trade.Symbol,
+		logger.FieldStream, streamName(trade.Symbol),
+		"aggTradeId", message.AggTradeId,
+		"price", trade.Price,
+		"quantity", trade.Quantity,
+	)
+
+	l.mu.Lock()
+	if _, ok := l.lastTrades[trade.Symbol]; ok {
+		l.lastTrades[trade.Symbol] = time.Now()
+	}
+	observers := l.observers
+	l.mu.Unlock()
+
+	for _, observe := range observers {
+		observe(trade)
+	}
+
+	l.metrics.IncreaseTradesReceived(trade.Symbol)
+	l.metrics.ObserveIngestLatency(trade.Symbol, src.receivedAt.Sub(time.UnixMilli(trade.Time)).Seconds())
+
+	l.enqueue(ctx, trade, src)
+
+	return true, nil
+}
+
+// tradeLog returns the sampled logger of symbol, named listener.<symbol> so that its level can be
+// raised on its own.
+func (l *tradeListener) tradeLog(symbol string) logger.Logger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if tradeLog, ok := l.tradeLogs[symbol]; ok {
+		return tradeLog
+	}
+	return l.log
+}
+
+// newConnectionId returns a random id identifying an exchange connection in logs and headers.
+func newConnectionId() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// streamName returns the aggregated trade stream of symbol.
+func streamName(symbol string) string {
+	return strings.ToLower(symbol) + "@" + aggTradeEvent
+}
+
+// admit reports whether symbol is subscribed and whether the aggregate trade id was already seen
+// for it, as happens when frames are redelivered after a reconnect. Frames without an id are never
+// duplicates.
+func (l *tradeListener) admit(symbol string, aggTradeId int64) (subscribed, duplicate bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.lastTrades[symbol]; !ok {
+		return false, false
+	}
+	if aggTradeId == 0 {
+		return true, false
+	}
+	if aggTradeId <= l.lastAggTradeIds[symbol] {
+		return true, true
+	}
+	l.lastAggTradeIds[symbol] = aggTradeId
+	return true, false
+}
+
+// publish publishes a trade, retrying by the failure policy. drain is done when the Stop draining
+// the publishers ran out of time, which ends the publish and its retries.
+func (l *tradeListener) publish(ctx, drain context.Context, trade Ticker, src source) {
+	// Keyed by symbol and published by the single publisher of the symbol, so the trades of a
+	// symbol stay in order on one partition of any topic.
+	message := kafka.Message{
+		Key:   []byte(trade.Symbol),
+		Topic: l.topics.Topic(ExchangeName, kafkaClient.StreamTrades, trade.Symbol),
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "kafka.publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", message.Topic),
+			attribute.String("trade.symbol", trade.Symbol),
+		),
+	)
+	defer span.End()
+
+	bytes, err := l.serializer.Serialize(ctx, message.Topic, trade)
+	if err != nil {
+		err = &Error{Class: PublishError, Symbol: trade.Symbol, Err: err}
+		tracing.RecordError(span, err)
+		_ = l.handleFailure(err)
+		return
+	}
+	message.Value = bytes
+	message.Headers = kafkaClient.Provenance{
+		Exchange:      ExchangeName,
+		Stream:        kafkaClient.StreamTrades,
+		Format:        l.serializer.Format(),
+		SchemaVersion: trade.Schema().Version,
+		IngestHost:    l.host,
+		IngestTime:    src.receivedAt,
+		ConnectionId:  src.connectionId,
+	}.Headers()
+	otel.GetTextMapPropagator().Inject(ctx, kafkaClient.HeaderCarrier{Headers: &message.Headers})
+
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		err = l.kafkaProducer.PublishMessage(ctx, message)
+		if err == nil {
+			l.metrics.ObservePublishLatency(trade.Symbol, time.Since(start).Seconds())
+			l.metrics.IncreaseTradesPublished(trade.Symbol)
+			return
+		}
+
+		publishErr := &Error{Class: PublishError, Symbol: trade.Symbol, Err: err}
+		span.AddEvent("publish failed", trace.WithAttributes(attribute.Int("attempt", attempt+1)))
+		tracing.RecordError(span, publishErr)
+		policy := l.currentPolicy()
+		if policy.Action(PublishError) != Retry {
+			_ = l.handleFailure(publishErr)
+			return
+		}
+		l.metrics.IncreasePipelineErrors(string(PublishError))
+		// Once the listener stops, the trades it received are retried until the Stop draining the
+		// publishers runs out of time, whatever the retry limit.
+		if l.escalatedErr() != nil || (attempt >= policy.MaxRetries && !l.isStopping()) {
+			l.escalate(fmt.Errorf("giving up after %d retries: %w", attempt, publishErr))
+			return
+		}
+
+		l.log.WarnCtx(ctx, "Retrying publish",
+			logger.FieldSymbol, trade.Symbol,
+			logger.FieldTopic, message.Topic,
+			logger.FieldError, err,
+			"attempt", attempt+1,
+			"maxRetries", policy.MaxRetries,
+		)
+		select {
+		case <-drain.Done():
+			l.escalate(fmt.Errorf("giving up after %d retries, stopped: %w", attempt, publishErr))
+			return
+		case <-time.After(policy.RetryBackoff):
+		}
 	}
 }
@@ -0,0 +1,578 @@
+package trades
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"github.com/sefikcan/read-time-trade/pkg/exchangetest"
+	kafkaClient "github.com/sefikcan/read-time-trade/pkg/kafka"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/segmentio/kafka-go"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitTimeout bounds every wait for the listener, so a broken test fails instead of hanging.
+const waitTimeout = 5 * time.Second
+
+// fakeProducer keeps the published messages. fail, when set, decides whether a publish fails.
+type fakeProducer struct {
+	mu       sync.Mutex
+	messages []kafka.Message
+	fail     func(message kafka.Message) error
+}
+
+func (p *fakeProducer) PublishMessage(_ context.Context, messages ...kafka.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, message := range messages {
+		if p.fail != nil {
+			if err := p.fail(message); err != nil {
+				return err
+			}
+		}
+		p.messages = append(p.messages, message)
+	}
+	return nil
+}
+
+func (p *fakeProducer) ErrorRate() float64 { return 0 }
+
+func (p *fakeProducer) Stats() kafka.WriterStats { return kafka.WriterStats{} }
+
+func (p *fakeProducer) Close() error { return nil }
+
+func (p *fakeProducer) published() []kafka.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]kafka.Message(nil), p.messages...)
+}
+
+// trades decodes the published trades in publishing order.
+func (p *fakeProducer) trades(t *testing.T) []Ticker {
+	t.Helper()
+	var trades []Ticker
+	for _, message := range p.published() {
+		var trade Ticker
+		if err := json.Unmarshal(message.Value, &trade); err != nil {
+			t.Fatalf("published value %q is not a trade: %v", message.Value, err)
+		}
+		trades = append(trades, trade)
+	}
+	return trades
+}
+
+// fakeMetrics records the ingest latencies and counts reconnects; everything else is dropped.
+type fakeMetrics struct {
+	mu             sync.Mutex
+	ingestLatency  []float64
+	reconnects     int
+	pipelineErrors map[string]int
+}
+
+func (m *fakeMetrics) IncreaseHits(int, string, string)                 {}
+func (m *fakeMetrics) ObserveResponseTime(int, string, string, float64) {}
+func (m *fakeMetrics) IncreaseTradesReceived(string)                    {}
+func (m *fakeMetrics) IncreaseTradesPublished(string)                   {}
+func (m *fakeMetrics) ObservePublishLatency(string, float64)            {}
+func (m *fakeMetrics) AddActiveSubscriptions(int)                       {}
+func (m *fakeMetrics) IncreaseConfigReloads(string)                     {}
+func (m *fakeMetrics) IncreaseRestartRequired(string)                   {}
+
+func (m *fakeMetrics) IncreasePipelineErrors(class string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.pipelineErrors == nil {
+		m.pipelineErrors = make(map[string]int)
+	}
+	m.pipelineErrors[class]++
+}
+
+func (m *fakeMetrics) ObserveIngestLatency(_ string, seconds float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ingestLatency = append(m.ingestLatency, seconds)
+}
+
+func (m *fakeMetrics) IncreaseReconnects() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reconnects++
+}
+
+type testListener struct {
+	*tradeListener
+	producer *fakeProducer
+	metrics  *fakeMetrics
+}
+
+func testConfig(url string) *config.Config {
+	return &config.Config{
+		Logger:   config.LoggerConfig{Level: "error", Encoding: "json"},
+		Exchange: config.ExchangeConfig{Url: url},
+		Kafka:    config.KafkaConfig{Format: kafkaClient.FormatJson, TopicStrategy: "per-symbol"},
+	}
+}
+
+func newTestListener(t *testing.T, cfg *config.Config, policy FailurePolicy, symbols ...string) *testListener {
+	t.Helper()
+	log := logger.NewLogger(cfg)
+	log.InitLogger()
+	serializer, err := kafkaClient.NewSerializer(cfg.Kafka)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	producer := &fakeProducer{}
+	metrics := &fakeMetrics{}
+	return &testListener{
+		tradeListener: NewTradeListener(log, cfg, producer, serializer, metrics, policy, symbols),
+		producer:      producer,
+		metrics:       metrics,
+	}
+}
+
+// fastPolicy is the default policy with a backoff short enough for tests.
+func fastPolicy() FailurePolicy {
+	policy := DefaultFailurePolicy()
+	policy.RetryBackoff = 10 * time.Millisecond
+	return policy
+}
+
+// start runs the listener until the test ends and returns the result of Start.
+func (l *testListener) start(t *testing.T) <-chan error {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- l.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		stopCtx, stop := context.WithTimeout(context.Background(), waitTimeout)
+		defer stop()
+		_ = l.Stop(stopCtx)
+	})
+	return result
+}
+
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newExchange(t *testing.T, opts exchangetest.Options) *exchangetest.Server {
+	t.Helper()
+	if opts.Seed == 0 {
+		opts.Seed = 1
+	}
+	if opts.TradeInterval == 0 {
+		opts.TradeInterval = 5 * time.Millisecond
+	}
+	server := exchangetest.NewServer(opts)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func countBySymbol(trades []Ticker) map[string]int {
+	counts := make(map[string]int)
+	for _, trade := range trades {
+		counts[trade.Symbol]++
+	}
+	return counts
+}
+
+func TestListenerSubscribesAndPublishes(t *testing.T) {
+	exchange := newExchange(t, exchangetest.Options{})
+	l := newTestListener(t, testConfig(exchange.URL()), fastPolicy(), "btcusdt", "ethusdt")
+	l.start(t)
+
+	eventually(t, "trades of both symbols", func() bool {
+		counts := countBySymbol(l.producer.trades(t))
+		return counts["BTCUSDT"] >= 5 && counts["ETHUSDT"] >= 5
+	})
+	if !l.Connected() {
+		t.Error("Connected() = false while trades arrive")
+	}
+	if got := exchange.Connections(); got != 1 {
+		t.Errorf("exchange has %d connections, want 1", got)
+	}
+	for _, message := range l.producer.published() {
+		var trade Ticker
+		_ = json.Unmarshal(message.Value, &trade)
+		if want := "trades-" + map[string]string{"BTCUSDT": "btcusdt", "ETHUSDT": "ethusdt"}[trade.Symbol]; message.Topic != want {
+			t.Fatalf("trade of %s published to %q, want %q", trade.Symbol, message.Topic, want)
+		}
+		if string(message.Key) != trade.Symbol {
+			t.Fatalf("trade of %s keyed %q", trade.Symbol, message.Key)
+		}
+		if stream := (kafkaClient.HeaderCarrier{Headers: &message.Headers}).Get(kafkaClient.HeaderStream); stream != kafkaClient.StreamTrades {
+			t.Fatalf("trade of %s has stream header %q, want %q", trade.Symbol, stream, kafkaClient.StreamTrades)
+		}
+	}
+}
+
+func TestListenerDecodesTrades(t *testing.T) {
+	exchange := newExchange(t, exchangetest.Options{TradeInterval: time.Hour})
+	l := newTestListener(t, testConfig(exchange.URL()), fastPolicy(), "btcusdt")
+	observed := make(chan Ticker, 1)
+	l.OnTrade(func(trade Ticker) { observed <- trade })
+	l.start(t)
+	eventually(t, "connection", l.Connected)
+
+	exchange.SendRaw([]byte(`{"e":"aggTrade","E":1700000000001,"s":"BTCUSDT","a":42,"p":"30000.10","q":"0.5","f":1,"l":2,"T":1700000000000,"m":true,"M":true}`))
+	eventually(t, "the trade", func() bool { return len(l.producer.published()) == 1 })
+
+	// Observers get the buyer maker flag, the published trade leaves it out.
+	want := Ticker{Symbol: "BTCUSDT", Price: "30000.10", Quantity: "0.5", Time: 1700000000000, BuyerMaker: true}
+	if got := <-observed; got != want {
+		t.Errorf("observed %+v, want %+v", got, want)
+	}
+	published := l.producer.published()[0].Value
+	if want := `{"s":"BTCUSDT","p":"30000.10","q":"0.5","T":1700000000000}`; string(published) != want {
+		t.Errorf("published %s, want %s", published, want)
+	}
+}
+
+func TestListenerDropsDuplicates(t *testing.T) {
+	exchange := newExchange(t, exchangetest.Options{TradeInterval: time.Hour})
+	l := newTestListener(t, testConfig(exchange.URL()), fastPolicy(), "btcusdt")
+	l.start(t)
+	eventually(t, "connection", l.Connected)
+
+	for _, id := range []int{7, 7, 6, 8, 8} {
+		exchange.SendRaw([]byte(fmt.Sprintf(`{"e":"aggTrade","s":"BTCUSDT","a":%d,"p":"%d","q":"1","T":1700000000000}`, id, id)))
+	}
+	exchange.SendRaw([]byte(`{"e":"aggTrade","s":"BTCUSDT","a":9,"p":"9","q":"1","T":1700000000000}`))
+	eventually(t, "the last trade", func() bool {
+		trades := l.producer.trades(t)
+		return len(trades) > 0 && trades[len(trades)-1].Price == "9"
+	})
+
+	var prices []string
+	for _, trade := range l.producer.trades(t) {
+		prices = append(prices, trade.Price)
+	}
+	if fmt.Sprint(prices) != "[7 8 9]" {
+		t.Errorf("published prices %v, want [7 8 9]", prices)
+	}
+}
+
+// Trades of a symbol removed by SetSymbols are dropped until it is added again, and its aggregate
+// trade ids are forgotten with it.
+func TestListenerDropsTradesOfRemovedSymbols(t *testing.T) {
+	exchange := newExchange(t, exchangetest.Options{TradeInterval: time.Hour})
+	l := newTestListener(t, testConfig(exchange.URL()), fastPolicy(), "btcusdt", "ethusdt")
+	l.start(t)
+	eventually(t, "connection", l.Connected)
+	send := func(symbol string, id int) {
+		exchange.SendRaw([]byte(fmt.Sprintf(`{"e":"aggTrade","s":"%s","a":%d,"p":"%d","q":"1","T":1700000000000}`, symbol, id, id)))
+	}
+	// Frames are handled in order, so the trade of price last is handled after the ones before.
+	waitFor := func(last string) {
+		eventually(t, "the trade of price "+last, func() bool {
+			trades := l.producer.trades(t)
+			return len(trades) > 0 && trades[len(trades)-1].Price == last
+		})
+	}
+
+	send("ETHUSDT", 5)
+	waitFor("5")
+	if err := l.SetSymbols([]string{"btcusdt"}); err != nil {
+		t.Fatal(err)
+	}
+	send("ETHUSDT", 6)
+	send("BTCUSDT", 1)
+	waitFor("1")
+	if _, ok := l.LastTrades()["ETHUSDT"]; ok {
+		t.Error("last trades still has the removed ETHUSDT")
+	}
+
+	if err := l.SetSymbols([]string{"btcusdt", "ethusdt"}); err != nil {
+		t.Fatal(err)
+	}
+	send("ETHUSDT", 3)
+	waitFor("3")
+
+	var prices []string
+	for _, trade := range l.producer.trades(t) {
+		prices = append(prices, trade.Price)
+	}
+	if fmt.Sprint(prices) != "[5 1 3]" {
+		t.Errorf("published prices %v, want [5 1 3]", prices)
+	}
+}
+
+func TestListenerReconnects(t *testing.T) {
+	exchange := newExchange(t, exchangetest.Options{DisconnectAfter: 20})
+	l := newTestListener(t, testConfig(exchange.URL()), fastPolicy(), "btcusdt")
+	l.start(t)
+
+	// Every connection is dropped after 20 trades, so 100 trades take several reconnects.
+	eventually(t, "trades over several connections", func() bool { return len(l.producer.published()) >= 100 })
+	l.metrics.mu.Lock()
+	reconnects := l.metrics.reconnects
+	l.metrics.mu.Unlock()
+	if reconnects < 4 {
+		t.Errorf("%d reconnects, want at least 4", reconnects)
+	}
+
+	exchange.Disconnect()
+	published := len(l.producer.published())
+	eventually(t, "trades after Disconnect", func() bool { return len(l.producer.published()) > published+10 })
+}
+
+func TestListenerGivesUpAfterMaxRetries(t *testing.T) {
+	exchange := newExchange(t, exchangetest.Options{})
+	url := exchange.URL()
+	exchange.Close()
+
+	policy := fastPolicy()
+	policy.MaxRetries = 2
+	l := newTestListener(t, testConfig(url), policy, "btcusdt")
+	select {
+	case err := <-l.start(t):
+		if ClassOf(err) != ConnectionError {
+			t.Errorf("Start returned %v, want a connection error", err)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("Start did not give up")
+	}
+}
+
+func TestListenerSkipsMalformedFrames(t *testing.T) {
+	exchange := newExchange(t, exchangetest.Options{MalformedProbability: 0.3})
+	l := newTestListener(t, testConfig(exchange.URL()), fastPolicy(), "btcusdt")
+	l.start(t)
+
+	eventually(t, "trades and skipped frames", func() bool {
+		return len(l.producer.published()) >= 20 && l.Skipped(DecodeError) >= 5
+	})
+	if got := exchange.Connections(); got != 1 {
+		t.Errorf("exchange has %d connections, want the first one kept", got)
+	}
+}
+
+func TestListenerEscalatesMalformedFrames(t *testing.T) {
+	exchange := newExchange(t, exchangetest.Options{TradeInterval: time.Hour})
+	policy, err := NewFailurePolicy(config.FailurePolicyConfig{Decode: string(Escalate)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newTestListener(t, testConfig(exchange.URL()), policy, "btcusdt")
+	result := l.start(t)
+	eventually(t, "connection", l.Connected)
+
+	exchange.SendRaw([]byte(`{"e":"aggTrade","s":`))
+	select {
+	case err := <-result:
+		if ClassOf(err) != DecodeError {
+			t.Errorf("Start returned %v, want a decode error", err)
+		}
+	case <-time.After(waitTimeout):
+		t.Fatal("Start did not return the escalated error")
+	}
+}
+
+func TestListenerMeasuresIngestLatency(t *testing.T) {
+	const latency = 50 * time.Millisecond
+	exchange := newExchange(t, exchangetest.Options{Latency: latency, TradeInterval: 10 * time.Millisecond})
+	l := newTestListener(t, testConfig(exchange.URL()), fastPolicy(), "btcusdt")
+	l.start(t)
+
+	eventually(t, "trades", func() bool { return len(l.producer.published()) >= 5 })
+	l.metrics.mu.Lock()
+	defer l.metrics.mu.Unlock()
+	for _, seconds := range l.metrics.ingestLatency {
+		// Trade times are milliseconds, so the measured latency can be up to 1ms short.
+		if seconds < (latency - time.Millisecond).Seconds() {
+			t.Fatalf("ingest latency %vs, want at least %v", seconds, latency)
+		}
+	}
+}
+
+// A recorded session replays into the same trades, in the same order for every symbol.
+func TestListenerRecordAndReplay(t *testing.T) {
+	exchange := newExchange(t, exchangetest.Options{})
+	path := filepath.Join(t.TempDir(), "capture.gz")
+	cfg := testConfig(exchange.URL())
+	cfg.Capture.RecordPath = path
+
+	recorder := newTestListener(t, cfg, fastPolicy(), "btcusdt", "ethusdt")
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- recorder.Start(ctx) }()
+	eventually(t, "recorded trades", func() bool { return len(recorder.producer.published()) >= 50 })
+	cancel()
+	if err := <-result; err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	stopCtx, stop := context.WithTimeout(context.Background(), waitTimeout)
+	defer stop()
+	if err := recorder.Stop(stopCtx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	replayer := newTestListener(t, testConfig(""), fastPolicy(), "btcusdt", "ethusdt")
+	if err := replayer.Replay(context.Background(), path, 0); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if err := replayer.Stop(stopCtx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	recorded, replayed := recorder.producer.trades(t), replayer.producer.trades(t)
+	if len(replayed) != len(recorded) {
+		t.Fatalf("replayed %d trades, recorded %d", len(replayed), len(recorded))
+	}
+	for symbol, trades := range bySymbol(recorded) {
+		if fmt.Sprint(bySymbol(replayed)[symbol]) != fmt.Sprint(trades) {
+			t.Errorf("replayed trades of %s differ from the recorded ones", symbol)
+		}
+	}
+
+	// The trades of a second replay are not duplicates of the first.
+	if err := replayer.Replay(context.Background(), path, 0); err != nil {
+		t.Fatalf("second Replay: %v", err)
+	}
+	if err := replayer.Stop(stopCtx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if replayed := replayer.producer.trades(t); len(replayed) != 2*len(recorded) {
+		t.Errorf("replayed %d trades twice, want %d", len(replayed), 2*len(recorded))
+	}
+}
+
+// The trades of a symbol are published in the order they were received, however long each
+// publish takes.
+func TestListenerPublishesInOrder(t *testing.T) {
+	exchange := newExchange(t, exchangetest.Options{TradeInterval: time.Hour})
+	l := newTestListener(t, testConfig(exchange.URL()), fastPolicy(), "btcusdt", "ethusdt")
+	random := rand.New(rand.NewSource(1))
+	var randomMu sync.Mutex
+	l.producer.fail = func(kafka.Message) error {
+		randomMu.Lock()
+		delay := time.Duration(random.Intn(500)) * time.Microsecond
+		randomMu.Unlock()
+		time.Sleep(delay)
+		return nil
+	}
+	l.start(t)
+	eventually(t, "connection", l.Connected)
+
+	const count = 200
+	for i := 1; i <= count; i++ {
+		for _, symbol := range []string{"BTCUSDT", "ETHUSDT"} {
+			exchange.SendRaw([]byte(fmt.Sprintf(`{"e":"aggTrade","s":"%s","a":%d,"p":"%d","q":"1","T":1700000000000}`, symbol, i, i)))
+		}
+	}
+	eventually(t, "all trades", func() bool { return len(l.producer.published()) == 2*count })
+
+	for symbol, trades := range bySymbol(l.producer.trades(t)) {
+		for i, trade := range trades {
+			if want := fmt.Sprint(i + 1); trade.Price != want {
+				t.Fatalf("trade %d of %s has price %s, want %s", i, symbol, trade.Price, want)
+			}
+		}
+	}
+}
+
+func bySymbol(trades []Ticker) map[string][]Ticker {
+	grouped := make(map[string][]Ticker)
+	for _, trade := range trades {
+		grouped[trade.Symbol] = append(grouped[trade.Symbol], trade)
+	}
+	return grouped
+}
+
+// publishStalls makes the producer of l hold its first publish until released, then fail failures
+// times before it publishes. started is closed when the first publish is held.
+func publishStalls(l *testListener, failures int) (started <-chan struct{}, release func()) {
+	held, released := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	var mu sync.Mutex
+	l.producer.fail = func(kafka.Message) error {
+		once.Do(func() { close(held) })
+		<-released
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			return errors.New("broker unavailable")
+		}
+		return nil
+	}
+	return held, func() { close(released) }
+}
+
+// A trade whose publish fails while the listener stops is retried past the retry limit until it
+// is published, as long as the Stop has time left.
+func TestListenerRetriesPublishWhileStopping(t *testing.T) {
+	exchange := newExchange(t, exchangetest.Options{TradeInterval: time.Hour})
+	policy := fastPolicy()
+	policy.actions[PublishError] = Retry
+	policy.MaxRetries = 2
+	l := newTestListener(t, testConfig(exchange.URL()), policy, "btcusdt")
+	started, release := publishStalls(l, 5)
+	l.start(t)
+	eventually(t, "connection", l.Connected)
+
+	exchange.SendRaw([]byte(`{"e":"aggTrade","s":"BTCUSDT","a":1,"p":"1","q":"1","T":1700000000000}`))
+	<-started
+	stopped := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+		defer cancel()
+		stopped <- l.Stop(ctx)
+	}()
+	eventually(t, "stopping", l.isStopping)
+	release()
+
+	if err := <-stopped; err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if len(l.producer.published()) != 1 || l.escalatedErr() != nil {
+		t.Errorf("published %d trades and escalated %v, want the trade published", len(l.producer.published()), l.escalatedErr())
+	}
+}
+
+// A Stop that runs out of time ends the retries and escalates.
+func TestListenerEscalatesPublishWhenTheDrainEnds(t *testing.T) {
+	exchange := newExchange(t, exchangetest.Options{TradeInterval: time.Hour})
+	policy := fastPolicy()
+	policy.actions[PublishError] = Retry
+	l := newTestListener(t, testConfig(exchange.URL()), policy, "btcusdt")
+	started, release := publishStalls(l, math.MaxInt)
+	l.start(t)
+	eventually(t, "connection", l.Connected)
+
+	exchange.SendRaw([]byte(`{"e":"aggTrade","s":"BTCUSDT","a":1,"p":"1","q":"1","T":1700000000000}`))
+	<-started
+	release()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := l.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop returned %v, want the deadline", err)
+	}
+	eventually(t, "escalation", func() bool { return ClassOf(l.escalatedErr()) == PublishError })
+	if len(l.producer.published()) != 0 {
+		t.Error("published a failing trade")
+	}
+}
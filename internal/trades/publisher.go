@@ -0,0 +1,113 @@
+package trades
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+)
+
+// publishQueueSize is the number of trades of a symbol waiting to be published before the read
+// loop blocks.
+const publishQueueSize = 1024
+
+type publishJob struct {
+	// ctx carries the span of the received frame.
+	ctx   context.Context
+	trade Ticker
+	src   source
+}
+
+// publishers publish the trades of every symbol in the order they were received: each symbol has
+// a queue and a single goroutine publishing from it, so a symbol whose publishes are slow or
+// retried does not hold up the others. A Stop closes quit and replaces the set, the goroutines
+// publish what was queued and end.
+type publishers struct {
+	// ctx is done when the Stop draining the publishers runs out of time.
+	ctx    context.Context
+	cancel context.CancelFunc
+	quit   chan struct{}
+	queues map[string]chan publishJob
+	wg     sync.WaitGroup
+}
+
+func newPublishers() *publishers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &publishers{
+		ctx:    ctx,
+		cancel: cancel,
+		quit:   make(chan struct{}),
+		queues: make(map[string]chan publishJob),
+	}
+}
+
+// enqueue hands trade to the publisher of its symbol, starting it for the first trade of the
+// symbol. Trades received while stopping are dropped.
+func (l *tradeListener) enqueue(ctx context.Context, trade Ticker, src source) {
+	l.mu.Lock()
+	p := l.publishers
+	queue, ok := p.queues[trade.Symbol]
+	if !ok {
+		queue = make(chan publishJob, publishQueueSize)
+		p.queues[trade.Symbol] = queue
+		p.wg.Add(1)
+		go l.publishLoop(p, queue)
+	}
+	l.mu.Unlock()
+
+	select {
+	case queue <- publishJob{ctx: ctx, trade: trade, src: src}:
+	case <-p.quit:
+	}
+}
+
+func (l *tradeListener) publishLoop(p *publishers, queue chan publishJob) {
+	defer p.wg.Done()
+
+	publish := func(job publishJob) {
+		// Publishing is cancelled by a Stop that runs out of time, not by the end of the frame.
+		ctx := trace.ContextWithSpan(p.ctx, trace.SpanFromContext(job.ctx))
+		l.publish(ctx, p.ctx, job.trade, job.src)
+	}
+	for {
+		select {
+		case job := <-queue:
+			publish(job)
+		case <-p.quit:
+			for {
+				select {
+				case job := <-queue:
+					publish(job)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// drainPublishers stops the publishers after they published the queued trades, or cancels their
+// publishing when ctx is done first.
+func (l *tradeListener) drainPublishers(ctx context.Context) error {
+	l.mu.Lock()
+	p := l.publishers
+	l.publishers = newPublishers()
+	l.mu.Unlock()
+
+	defer p.cancel()
+	stop := context.AfterFunc(ctx, p.cancel)
+	defer stop()
+	close(p.quit)
+
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
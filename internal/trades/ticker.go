@@ -1,8 +1,55 @@
 package trades
 
+import (
+	"fmt"
+	kafkaClient "github.com/sefikcan/read-time-trade/pkg/kafka"
+)
+
 type Ticker struct {
 	Symbol   string `json:"s"`
 	Price    string `json:"p"`
 	Quantity string `json:"q"`
 	Time     int64  `json:"T"`
+	// BuyerMaker is set when the seller took liquidity, i.e. the trade hit the bid. It is passed
+	// to observers but not published.
+	BuyerMaker bool `json:"-"`
+}
+
+// tickerSchema is the Avro and Protobuf schema of published trades. Price and quantity stay
+// decimal strings, as sent by the exchange, so no precision is lost.
+var tickerSchema = &kafkaClient.Schema{
+	Namespace: "realtimetrade",
+	Name:      "Trade",
+	Version:   1,
+	Fields: []kafkaClient.SchemaField{
+		{Name: "symbol", Type: kafkaClient.FieldString},
+		{Name: "price", Type: kafkaClient.FieldString},
+		{Name: "quantity", Type: kafkaClient.FieldString},
+		{Name: "time", Type: kafkaClient.FieldLong},
+	},
+}
+
+func (t Ticker) Schema() *kafkaClient.Schema {
+	return tickerSchema
+}
+
+func (t Ticker) Values() []interface{} {
+	return []interface{}{t.Symbol, t.Price, t.Quantity, t.Time}
+}
+
+// SetValues sets the trade from the values of its schema fields, as decoded from Avro or
+// Protobuf.
+func (t *Ticker) SetValues(values []interface{}) error {
+	if len(values) != len(tickerSchema.Fields) {
+		return fmt.Errorf("trade has %d fields, got %d values", len(tickerSchema.Fields), len(values))
+	}
+	symbol, symbolOk := values[0].(string)
+	price, priceOk := values[1].(string)
+	quantity, quantityOk := values[2].(string)
+	at, timeOk := values[3].(int64)
+	if !symbolOk || !priceOk || !quantityOk || !timeOk {
+		return fmt.Errorf("trade values %v do not match the schema", values)
+	}
+	t.Symbol, t.Price, t.Quantity, t.Time = symbol, price, quantity, at
+	return nil
 }
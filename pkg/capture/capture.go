@@ -0,0 +1,174 @@
+package capture
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// flushInterval bounds how much of a capture is lost when the process dies without closing the
+// writer: the buffered frames are flushed to the file as a complete gzip block this often.
+const flushInterval = time.Second
+
+// frameHeaderSize is the size of the fixed header stored in front of every frame:
+// 8 bytes of receive timestamp (unix nanoseconds) and 4 bytes of payload length.
+const frameHeaderSize = 12
+
+// Frame is a single raw WebSocket message together with the time it was received.
+type Frame struct {
+	ReceivedAt time.Time
+	Payload    []byte
+}
+
+// Writer appends frames to a gzip compressed capture file. Frames are flushed every
+// flushInterval, so a capture cut short by a crash still reads back up to the last flush.
+type Writer struct {
+	mu    sync.Mutex
+	file  *os.File
+	gz    *gzip.Writer
+	buf   *bufio.Writer
+	stop  chan struct{}
+	done  chan struct{}
+	dirty bool
+}
+
+func NewWriter(path string) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create capture file %s: %w", path, err)
+	}
+
+	gz := gzip.NewWriter(file)
+	w := &Writer{
+		file: file,
+		gz:   gz,
+		buf:  bufio.NewWriter(gz),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go w.flushPeriodically()
+	return w, nil
+}
+
+func (w *Writer) flushPeriodically() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			// A failed flush fails the next Write or Close as well, which reports it.
+			_ = w.Flush()
+		}
+	}
+}
+
+// Flush writes the buffered frames to the file as a complete gzip block.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.dirty {
+		return nil
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if err := w.gz.Flush(); err != nil {
+		return err
+	}
+	w.dirty = false
+	return nil
+}
+
+func (w *Writer) Write(frame Frame) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint64(header[0:8], uint64(frame.ReceivedAt.UnixNano()))
+	binary.BigEndian.PutUint32(header[8:12], uint32(len(frame.Payload)))
+
+	w.dirty = true
+	if _, err := w.buf.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.buf.Write(frame.Payload)
+	return err
+}
+
+func (w *Writer) Close() error {
+	close(w.stop)
+	<-w.done
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return errors.Join(w.buf.Flush(), w.gz.Close(), w.file.Close())
+}
+
+// Reader reads frames back from a capture file in the order they were recorded.
+type Reader struct {
+	file *os.File
+	gz   *gzip.Reader
+	buf  *bufio.Reader
+}
+
+func NewReader(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open capture file %s: %w", path, err)
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("read capture file %s: %w", path, err)
+	}
+
+	return &Reader{
+		file: file,
+		gz:   gz,
+		buf:  bufio.NewReader(gz),
+	}, nil
+}
+
+// Read returns the next frame, or io.EOF once the capture is exhausted. A capture whose writer
+// was never closed ends without the gzip trailer; when it ends at a frame boundary that is taken
+// as its end as well.
+func (r *Reader) Read() (Frame, error) {
+	var header [frameHeaderSize]byte
+	if n, err := io.ReadFull(r.buf, header[:]); err != nil {
+		if n == 0 && errors.Is(err, io.ErrUnexpectedEOF) {
+			return Frame{}, io.EOF
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return Frame{}, fmt.Errorf("truncated frame header: %w", err)
+		}
+		return Frame{}, err
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[8:12]))
+	if _, err := io.ReadFull(r.buf, payload); err != nil {
+		return Frame{}, fmt.Errorf("truncated frame payload: %w", err)
+	}
+
+	return Frame{
+		ReceivedAt: time.Unix(0, int64(binary.BigEndian.Uint64(header[0:8]))),
+		Payload:    payload,
+	}, nil
+}
+
+func (r *Reader) Close() error {
+	return errors.Join(r.gz.Close(), r.file.Close())
+}
@@ -0,0 +1,163 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var frames = []Frame{
+	{ReceivedAt: time.Unix(1700000000, 1), Payload: []byte(`{"e":"aggTrade","s":"BTCUSDT","p":"30000.1"}`)},
+	{ReceivedAt: time.Unix(1700000000, 2), Payload: []byte{}},
+	{ReceivedAt: time.Unix(1700000001, 0), Payload: bytes.Repeat([]byte("x"), 70000)},
+}
+
+func writeFrames(t *testing.T, w *Writer) {
+	t.Helper()
+	for _, frame := range frames {
+		if err := w.Write(frame); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+}
+
+func readFrames(t *testing.T, path string) []Frame {
+	t.Helper()
+	r, err := NewReader(path)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	defer r.Close()
+
+	var read []Frame
+	for {
+		frame, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return read
+		}
+		if err != nil {
+			t.Fatalf("Read after %d frames: %v", len(read), err)
+		}
+		read = append(read, frame)
+	}
+}
+
+func assertFrames(t *testing.T, read []Frame) {
+	t.Helper()
+	if len(read) != len(frames) {
+		t.Fatalf("read %d frames, want %d", len(read), len(frames))
+	}
+	for i := range frames {
+		if !read[i].ReceivedAt.Equal(frames[i].ReceivedAt) {
+			t.Errorf("frame %d received at %v, want %v", i, read[i].ReceivedAt, frames[i].ReceivedAt)
+		}
+		if !bytes.Equal(read[i].Payload, frames[i].Payload) {
+			t.Errorf("frame %d payload differs", i)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.gz")
+	w, err := NewWriter(path)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	writeFrames(t, w)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	assertFrames(t, readFrames(t, path))
+}
+
+// A writer that is never closed, as after a crash, keeps the frames up to its last flush.
+func TestUnclosedWriterKeepsFlushedFrames(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "capture.gz")
+	w, err := NewWriter(path)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	defer w.Close()
+	writeFrames(t, w)
+
+	deadline := time.Now().Add(3 * flushInterval)
+	for {
+		w.mu.Lock()
+		dirty := w.dirty
+		w.mu.Unlock()
+		if !dirty {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("frames not flushed within %v", 3*flushInterval)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Copy the file as the crash left it, without the gzip trailer Close writes.
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed := filepath.Join(dir, "crashed.gz")
+	if err := os.WriteFile(crashed, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFrames(t, readFrames(t, crashed))
+}
+
+func TestTruncatedFrame(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "capture.gz")
+	w, err := NewWriter(path)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	writeFrames(t, w)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Rewrite the capture without the last bytes of the last payload.
+	r, err := NewReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(r.gz)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(dir, "truncated.gz")
+	tw, err := NewWriter(truncated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.buf.Write(raw[:len(raw)-10]); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = NewReader(truncated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for i := 0; i < len(frames)-1; i++ {
+		if _, err := r.Read(); err != nil {
+			t.Fatalf("Read frame %d: %v", i, err)
+		}
+	}
+	if _, err := r.Read(); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("Read of the truncated frame returned %v, want a truncation error", err)
+	}
+}
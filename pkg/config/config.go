@@ -1,145 +1,251 @@
 package config
 
 import (
-	"fmt"
-	"github.com/spf13/viper"
-	"os"
-	"reflect"
-	"strings"
 	"time"
 )
 
 const (
-	defaultConfigPath     = "pkg/config/"
-	tagName               = "mapstructure"
-	configFileType        = "yaml"
-	defaultConfigFileName = "config-dev"
-	environmentKey        = "environment"
+	defaultConfigPath = "pkg/config/"
+	tagName           = "mapstructure"
+	secretTagName     = "secret"
+	configFileType    = "yaml"
+	environmentKey    = "environment"
+	envPrefix         = "RTT"
 )
 
 type Config struct {
-	Server  ServerConfig `mapstructure:"server"`
-	Metric  MetricConfig `mapstructure:"metric"`
-	Logger  LoggerConfig `mapstructure:"logger"`
-	Jaeger  JaegerConfig `mapstructure:"jaeger"`
-	Kafka   KafkaConfig  `mapstructure:"kafka"`
-	Tickers TickerConfig `mapstructure:"tickers"`
+	Server        ServerConfig        `mapstructure:"server"`
+	Metric        MetricConfig        `mapstructure:"metric"`
+	Logger        LoggerConfig        `mapstructure:"logger"`
+	Jaeger        JaegerConfig        `mapstructure:"jaeger"`
+	Kafka         KafkaConfig         `mapstructure:"kafka"`
+	Tickers       []string            `mapstructure:"tickers"`
+	Capture       CaptureConfig       `mapstructure:"capture"`
+	Exchange      ExchangeConfig      `mapstructure:"exchange"`
+	FailurePolicy FailurePolicyConfig `mapstructure:"failurePolicy"`
+	Health        HealthConfig        `mapstructure:"health"`
+	Stats         StatsConfig         `mapstructure:"stats"`
+	Indicators    IndicatorsConfig    `mapstructure:"indicators"`
+	Alerts        AlertsConfig        `mapstructure:"alerts"`
+	Candles       CandlesConfig       `mapstructure:"candles"`
 }
 
 type ServerConfig struct {
-	AppVersion     string        `mapstructure:"appVersion"`
-	Host           string        `mapstructure:"host"`
-	Port           string        `mapstructure:"port"`
-	Mode           string        `mapstructure:"mode"`
-	ReadTimeout    time.Duration `mapstructure:"readTimeout"`
-	WriteTimeout   time.Duration `mapstructure:"writeTimeout"`
-	SSL            bool          `mapstructure:"ssl"`
-	MaxHeaderBytes int           `mapstructure:"maxHeaderBytes"`
-	CtxTimeout     time.Duration `mapstructure:"ctxTimeout"`
+	AppVersion     string          `mapstructure:"appVersion"`
+	Host           string          `mapstructure:"host"`
+	Port           string          `mapstructure:"port"`
+	DebugPort      string          `mapstructure:"debugPort"`
+	Mode           string          `mapstructure:"mode"`
+	ReadTimeout    time.Duration   `mapstructure:"readTimeout"`
+	WriteTimeout   time.Duration   `mapstructure:"writeTimeout"`
+	SSL            bool            `mapstructure:"ssl"`
+	MaxHeaderBytes int             `mapstructure:"maxHeaderBytes"`
+	CtxTimeout     time.Duration   `mapstructure:"ctxTimeout"`
+	RateLimit      RateLimitConfig `mapstructure:"rateLimit"`
+	// AdminToken is the bearer token of the admin routes, which are not served without one.
+	AdminToken string `mapstructure:"adminToken" secret:"true"`
 }
 
+// RateLimitConfig limits the API requests of every client IP to Rate per second, with bursts of
+// up to Burst requests. A Rate of 0 disables the limit. Probes and metrics are never limited.
+type RateLimitConfig struct {
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+}
+
+// MetricConfig serves /metrics on the dedicated Url when set and on the main server when
+// ServeOnMain is true.
 type MetricConfig struct {
-	Url         string `mapstructure:"url"`
-	ServiceName string `mapstructure:"serviceName"`
+	Url         string              `mapstructure:"url"`
+	ServiceName string              `mapstructure:"serviceName"`
+	ServeOnMain bool                `mapstructure:"serveOnMain"`
+	Buckets     MetricBucketsConfig `mapstructure:"buckets"`
+}
+
+// MetricBucketsConfig overrides the histogram buckets, in seconds, of the latency metrics.
+type MetricBucketsConfig struct {
+	Http    []float64 `mapstructure:"http"`
+	Publish []float64 `mapstructure:"publish"`
+	Ingest  []float64 `mapstructure:"ingest"`
 }
 
+// LoggerConfig configures the logger. Components overrides Level for named loggers such as
+// listener, kafka or http, and a dotted child like listener.btcusdt for a single symbol.
 type LoggerConfig struct {
-	Development bool   `mapstructure:"development"`
-	Encoding    string `mapstructure:"encoding"`
-	Level       string `mapstructure:"level"`
+	Development bool              `mapstructure:"development"`
+	Encoding    string            `mapstructure:"encoding"`
+	Level       string            `mapstructure:"level"`
+	Components  map[string]string `mapstructure:"components"`
+	Sampling    LogSamplingConfig `mapstructure:"sampling"`
 }
 
+// LogSamplingConfig limits high-volume entries such as received trades: per second, the first
+// Initial entries with the same message are logged, then every Thereafter-th. 0 disables sampling.
+type LogSamplingConfig struct {
+	Initial    int `mapstructure:"initial"`
+	Thereafter int `mapstructure:"thereafter"`
+}
+
+// JaegerConfig configures span export over OTLP/HTTP. Host is the collector endpoint, e.g. the
+// 4318 port of Jaeger all-in-one, and SamplingRatio the share of new traces that are sampled.
 type JaegerConfig struct {
-	Host        string `mapstructure:"host"`
-	ServiceName string `mapstructure:"serviceName"`
-	LogSpans    bool   `mapstructure:"logSpans"`
+	Host          string  `mapstructure:"host"`
+	ServiceName   string  `mapstructure:"serviceName"`
+	LogSpans      bool    `mapstructure:"logSpans"`
+	Insecure      bool    `mapstructure:"insecure"`
+	SamplingRatio float64 `mapstructure:"samplingRatio"`
+}
+
+type ExchangeConfig struct {
+	Url              string        `mapstructure:"url"`
+	HandshakeTimeout time.Duration `mapstructure:"handshakeTimeout"`
+	ProxyUrl         string        `mapstructure:"proxyUrl"`
+	CaBundle         string        `mapstructure:"caBundle"`
+	Compression      bool          `mapstructure:"compression"`
+	ReadBufferSize   int           `mapstructure:"readBufferSize"`
+	WriteBufferSize  int           `mapstructure:"writeBufferSize"`
+}
+
+// HealthConfig holds the thresholds of the liveness and readiness probes. Durations are seconds.
+type HealthConfig struct {
+	Timeout         time.Duration `mapstructure:"timeout"`
+	MaxTradeAge     time.Duration `mapstructure:"maxTradeAge"`
+	MaxDisconnected time.Duration `mapstructure:"maxDisconnected"`
+	MaxErrorRate    float64       `mapstructure:"maxErrorRate"`
+}
+
+// StatsConfig enables the rolling statistics of every symbol over Windows, published to the
+// stats stream every PublishInterval. Durations are seconds.
+type StatsConfig struct {
+	Enabled         bool            `mapstructure:"enabled"`
+	Windows         []time.Duration `mapstructure:"windows"`
+	PublishInterval time.Duration   `mapstructure:"publishInterval"`
+}
+
+// IndicatorsConfig enables the technical indicators of finalized candles, published to the
+// indicators stream. Every symbol gets candles of Intervals, unless Symbols lists its own. Periods
+// count candles, durations are seconds.
+type IndicatorsConfig struct {
+	Enabled   bool                       `mapstructure:"enabled"`
+	Intervals []time.Duration            `mapstructure:"intervals"`
+	Symbols   map[string][]time.Duration `mapstructure:"symbols"`
+	Sma       int                        `mapstructure:"sma"`
+	Ema       int                        `mapstructure:"ema"`
+	Rsi       int                        `mapstructure:"rsi"`
+	Atr       int                        `mapstructure:"atr"`
+	Macd      MacdConfig                 `mapstructure:"macd"`
+	Bollinger BollingerConfig            `mapstructure:"bollinger"`
+}
+
+// CandlesConfig enables the candles stream, derived from the trades topics by a transactional
+// pipeline: every candle is published exactly once, also across restarts. Interval is seconds.
+type CandlesConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
 }
 
-type TickerConfig struct {
-	Tickers string `mapstructure:"tickers"`
+type MacdConfig struct {
+	Fast   int `mapstructure:"fast"`
+	Slow   int `mapstructure:"slow"`
+	Signal int `mapstructure:"signal"`
 }
 
+type BollingerConfig struct {
+	Period     int     `mapstructure:"period"`
+	Deviations float64 `mapstructure:"deviations"`
+}
+
+// AlertsConfig enables the alert rules evaluated against every trade. Rules are kept in
+// StorePath and a rule without a cooldown of its own waits Cooldown between alerts. Durations
+// are seconds. The alert routes require Token as a bearer token.
+type AlertsConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Token     string        `mapstructure:"token" secret:"true"`
+	StorePath string        `mapstructure:"storePath"`
+	Cooldown  time.Duration `mapstructure:"cooldown"`
+	Webhook   WebhookConfig `mapstructure:"webhook"`
+}
+
+// WebhookConfig sets the delivery of alerts. Deliveries are signed with an HMAC-SHA256 of Secret
+// and retried MaxAttempts times, backing off from RetryBackoff. Webhooks may only be on
+// AllowedHosts, or on any host of public addresses when none are set.
+type WebhookConfig struct {
+	Secret       string        `mapstructure:"secret" secret:"true"`
+	AllowedHosts []string      `mapstructure:"allowedHosts"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+	MaxAttempts  int           `mapstructure:"maxAttempts"`
+	RetryBackoff time.Duration `mapstructure:"retryBackoff"`
+}
+
+// FailurePolicyConfig selects retry, skip or escalate for every class of listener error.
+type FailurePolicyConfig struct {
+	Connection   string        `mapstructure:"connection"`
+	Subscribe    string        `mapstructure:"subscribe"`
+	Decode       string        `mapstructure:"decode"`
+	Publish      string        `mapstructure:"publish"`
+	MaxRetries   int           `mapstructure:"maxRetries"`
+	RetryBackoff time.Duration `mapstructure:"retryBackoff"`
+}
+
+type CaptureConfig struct {
+	RecordPath  string  `mapstructure:"recordPath"`
+	ReplayPath  string  `mapstructure:"replayPath"`
+	ReplaySpeed float64 `mapstructure:"replaySpeed"`
+}
+
+// KafkaConfig configures publishing. TopicStrategy is per-symbol, shared or per-exchange and
+// TopicName the template of the topic names, with {exchange}, {stream} and {symbol}
+// placeholders; when empty the default of the strategy applies. Balancer is key, which keeps the
+// messages of a symbol in order on one partition, or least-bytes.
 type KafkaConfig struct {
-	Brokers           []string `mapstructure:"brokers"`
-	GroupID           string   `mapstructure:"groupID"`
-	InitTopics        bool     `mapstructure:"initTopics"`
-	TopicName         string   `mapstructure:"topicName"`
-	Partitions        int      `mapstructure:"partitions"`
-	ReplicationFactor int      `mapstructure:"replicationFactor"`
-}
-
-func NewConfig() *Config {
-	env, _ := os.LookupEnv(environmentKey)
-	fmt.Println("Environment: [" + env + "] read from runtime arguments [" + environmentKey + "].")
-
-	return ReadConfig(&Config{}, strings.ToUpper(env))
-}
-
-var ReadConfig = func(c *Config, env string) *Config {
-	fmt.Println("Configuration read initiated...")
-	v := viper.New()
-	switch {
-	case env == "DEV":
-		v = readFromEnv(v)
-	case env == "REMOTE":
-		v = readFromConfigServer(v)
-	default:
-		v = readFromAppYaml(v)
-	}
-	if err := v.Unmarshal(&c); err != nil {
-		panic("Configuration unmarshalling occurred an error, terminating: " + err.Error())
-	}
-
-	return c
-}
-
-var readFromEnv = func(v *viper.Viper) *viper.Viper {
-	fmt.Println("Reading environment configuration")
-	addKeysToViper(v)
-	v.AutomaticEnv()
-	return v
-}
-
-var readFromConfigServer = func(v *viper.Viper) *viper.Viper {
-	return v
-}
-
-var readFromAppYaml = func(v *viper.Viper) *viper.Viper {
-	fmt.Println("Reading application yml configuration")
-	v.SetConfigName(defaultConfigFileName)
-	v.SetTypeByDefaultValue(true)
-	v.SetConfigType(configFileType)
-	v.AddConfigPath("./" + defaultConfigPath)
-	if err := v.ReadInConfig(); err != nil {
-		fmt.Printf("Viper read config has an error: %e\n", err)
-	}
-
-	return v
-}
-
-func getAllKeys(t reflect.Type) []string {
-	var result []string
-	for i := 0; i < t.NumField(); i++ {
-		f := t.Field(i)
-		n := strings.ToUpper(f.Tag.Get(tagName))
-		if reflect.Struct == f.Type.Kind() {
-			subKeys := getAllKeys(f.Type)
-			for _, k := range subKeys {
-				result = append(result, n+"."+k)
-			}
-		} else {
-			result = append(result, n)
-		}
-	}
-
-	return result
-}
-
-func addKeysToViper(v *viper.Viper) {
-	var reply interface{} = Config{}
-	t := reflect.TypeOf(reply)
-	keys := getAllKeys(t)
-	for _, key := range keys {
-		v.SetDefault(key, "")
-	}
+	Brokers           []string        `mapstructure:"brokers"`
+	GroupID           string          `mapstructure:"groupID"`
+	InitTopics        bool            `mapstructure:"initTopics"`
+	TopicStrategy     string          `mapstructure:"topicStrategy"`
+	TopicName         string          `mapstructure:"topicName"`
+	Balancer          string          `mapstructure:"balancer"`
+	Partitions        int             `mapstructure:"partitions"`
+	ReplicationFactor int             `mapstructure:"replicationFactor"`
+	Sasl              KafkaSaslConfig `mapstructure:"sasl"`
+	Tls               KafkaTlsConfig  `mapstructure:"tls"`
+	// Format of the message values: json, avro or protobuf. Avro and Protobuf need the schema
+	// registry.
+	Format         string               `mapstructure:"format"`
+	SchemaRegistry SchemaRegistryConfig `mapstructure:"schemaRegistry"`
+	// Delivery is at-least-once, where a retried write may duplicate messages, or idempotent,
+	// where the broker drops duplicates.
+	Delivery string `mapstructure:"delivery"`
+	// TransactionalId prefixes the transactional ids of the pipelines that derive streams from
+	// the published trades.
+	TransactionalId string `mapstructure:"transactionalId"`
+}
+
+// SchemaRegistryConfig locates a Confluent compatible schema registry. Compatibility, e.g.
+// BACKWARD, is set on every subject before a schema is registered; when empty the registry
+// default applies. Timeout is seconds.
+type SchemaRegistryConfig struct {
+	Url           string        `mapstructure:"url"`
+	Username      string        `mapstructure:"username"`
+	Password      string        `mapstructure:"password" secret:"true"`
+	Compatibility string        `mapstructure:"compatibility"`
+	Timeout       time.Duration `mapstructure:"timeout"`
+}
+
+// KafkaSaslConfig authenticates the broker connections. Mechanism is plain, scram-sha-256 or
+// scram-sha-512; when empty no authentication is done.
+type KafkaSaslConfig struct {
+	Mechanism string `mapstructure:"mechanism"`
+	Username  string `mapstructure:"username"`
+	Password  string `mapstructure:"password" secret:"true"`
+}
+
+// KafkaTlsConfig encrypts the broker connections. CaFile adds the broker CA to the system pool,
+// CertFile and KeyFile hold the client certificate for mutual TLS.
+type KafkaTlsConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CaFile             string `mapstructure:"caFile"`
+	CertFile           string `mapstructure:"certFile"`
+	KeyFile            string `mapstructure:"keyFile"`
+	ServerName         string `mapstructure:"serverName"`
+	InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify"`
 }
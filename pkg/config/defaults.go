@@ -0,0 +1,120 @@
+package config
+
+// defaults is the lowest configuration layer, so that a service starts with nothing but the
+// settings that differ per deployment. Durations are seconds, as in the yml files.
+var defaults = map[string]interface{}{
+	"server.appVersion":      "1.0.0",
+	"server.host":            "",
+	"server.port":            "5000",
+	"server.debugPort":       "",
+	"server.mode":            "Production",
+	"server.readTimeout":     5,
+	"server.writeTimeout":    5,
+	"server.maxHeaderBytes":  1 << 20,
+	"server.ctxTimeout":      4,
+	"server.ssl":             false,
+	"server.rateLimit.rate":  0,
+	"server.rateLimit.burst": 0,
+	"server.adminToken":      "",
+
+	"logger.development":         false,
+	"logger.encoding":            "json",
+	"logger.level":               "info",
+	"logger.sampling.initial":    100,
+	"logger.sampling.thereafter": 100,
+	"logger.components":          map[string]string{},
+
+	"jaeger.host":          "localhost:4318",
+	"jaeger.serviceName":   "real-time-trade",
+	"jaeger.samplingRatio": 1,
+	"jaeger.logSpans":      false,
+	"jaeger.insecure":      false,
+
+	"metric.url":             "localhost:7070",
+	"metric.serviceName":     "real-time-trade",
+	"metric.serveOnMain":     false,
+	"metric.buckets.http":    []float64{},
+	"metric.buckets.publish": []float64{},
+	"metric.buckets.ingest":  []float64{},
+
+	"kafka.brokers":                      []string{"localhost:9092"},
+	"kafka.groupID":                      "real-time-trade",
+	"kafka.initTopics":                   false,
+	"kafka.topicStrategy":                "per-symbol",
+	"kafka.topicName":                    "",
+	"kafka.balancer":                     "key",
+	"kafka.partitions":                   3,
+	"kafka.replicationFactor":            1,
+	"kafka.sasl.mechanism":               "",
+	"kafka.sasl.username":                "",
+	"kafka.sasl.password":                "",
+	"kafka.tls.enabled":                  false,
+	"kafka.tls.caFile":                   "",
+	"kafka.tls.certFile":                 "",
+	"kafka.tls.keyFile":                  "",
+	"kafka.tls.serverName":               "",
+	"kafka.tls.insecureSkipVerify":       false,
+	"kafka.format":                       "json",
+	"kafka.schemaRegistry.url":           "",
+	"kafka.schemaRegistry.username":      "",
+	"kafka.schemaRegistry.password":      "",
+	"kafka.schemaRegistry.compatibility": "BACKWARD",
+	"kafka.schemaRegistry.timeout":       5,
+	"kafka.delivery":                     "idempotent",
+	"kafka.transactionalId":              "real-time-trade",
+
+	"tickers": []string{"btcusdt", "ethusdt"},
+
+	"capture.recordPath":  "",
+	"capture.replayPath":  "",
+	"capture.replaySpeed": 1,
+
+	"exchange.url":              "wss://stream.binance.com:9443/ws",
+	"exchange.handshakeTimeout": 10,
+	"exchange.proxyUrl":         "",
+	"exchange.caBundle":         "",
+	"exchange.compression":      false,
+	"exchange.readBufferSize":   4096,
+	"exchange.writeBufferSize":  1024,
+
+	"failurePolicy.connection":   "retry",
+	"failurePolicy.subscribe":    "retry",
+	"failurePolicy.decode":       "skip",
+	"failurePolicy.publish":      "skip",
+	"failurePolicy.maxRetries":   5,
+	"failurePolicy.retryBackoff": 1,
+
+	"health.timeout":         2,
+	"health.maxTradeAge":     60,
+	"health.maxDisconnected": 300,
+	"health.maxErrorRate":    0.5,
+
+	"stats.enabled":         false,
+	"stats.windows":         []int{60, 300, 3600, 86400},
+	"stats.publishInterval": 5,
+
+	"indicators.enabled":              false,
+	"indicators.intervals":            []int{60, 300},
+	"indicators.sma":                  20,
+	"indicators.ema":                  20,
+	"indicators.rsi":                  14,
+	"indicators.atr":                  14,
+	"indicators.macd.fast":            12,
+	"indicators.macd.slow":            26,
+	"indicators.macd.signal":          9,
+	"indicators.bollinger.period":     20,
+	"indicators.bollinger.deviations": 2,
+
+	"alerts.enabled":              false,
+	"alerts.token":                "",
+	"alerts.storePath":            "alerts.json",
+	"alerts.cooldown":             300,
+	"alerts.webhook.secret":       "",
+	"alerts.webhook.allowedHosts": []string{},
+	"alerts.webhook.timeout":      5,
+	"alerts.webhook.maxAttempts":  5,
+	"alerts.webhook.retryBackoff": 1,
+
+	"candles.enabled":  false,
+	"candles.interval": 60,
+}
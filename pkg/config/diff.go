@@ -0,0 +1,30 @@
+package config
+
+import (
+	"reflect"
+)
+
+// Diff returns the settings that differ between two configurations, as dotted paths of their
+// mapstructure names such as "server.port" or "tickers". Lists and maps are compared as a whole.
+func Diff(old, new *Config) []string {
+	return diffValues("", reflect.ValueOf(*old), reflect.ValueOf(*new))
+}
+
+func diffValues(prefix string, old, new reflect.Value) []string {
+	if old.Kind() != reflect.Struct {
+		if reflect.DeepEqual(old.Interface(), new.Interface()) {
+			return nil
+		}
+		return []string{prefix}
+	}
+
+	var changed []string
+	for i := 0; i < old.NumField(); i++ {
+		name := old.Type().Field(i).Tag.Get(tagName)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		changed = append(changed, diffValues(name, old.Field(i), new.Field(i))...)
+	}
+	return changed
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := defaultConfig(t)
+	if changed := Diff(old, defaultConfig(t)); changed != nil {
+		t.Fatalf("identical configurations differ in %v", changed)
+	}
+
+	next := defaultConfig(t)
+	next.Server.Port = "6000"
+	next.Server.RateLimit.Rate = old.Server.RateLimit.Rate + 1
+	next.Tickers = append(append([]string{}, old.Tickers...), "solusdt")
+	next.Logger.Components = map[string]string{"listener": "warn"}
+	next.Alerts.Webhook.AllowedHosts = []string{"hooks.example.com"}
+
+	// Settings come in the order of the fields; lists and maps are reported as a whole.
+	want := []string{
+		"server.port",
+		"server.rateLimit.rate",
+		"logger.components",
+		"tickers",
+		"alerts.webhook.allowedHosts",
+	}
+	if got := Diff(old, next); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,412 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	secretsDirKey     = "RTT_SECRETS_DIR"
+	defaultSecretsDir = "/run/secrets/real-time-trade"
+	redacted          = "******"
+)
+
+// ErrHelp is returned by NewLoader when the usage was requested with -h or --help.
+var ErrHelp = pflag.ErrHelp
+
+// shortcutFlags are flags for the settings most often changed on the command line. Every other
+// setting can be changed with --set.
+var shortcutFlags = []struct {
+	name string
+	key  string
+}{
+	{name: "port", key: "server.port"},
+	{name: "log-level", key: "logger.level"},
+	{name: "tickers", key: "tickers"},
+	{name: "brokers", key: "kafka.brokers"},
+	{name: "exchange-url", key: "exchange.url"},
+}
+
+// Loader reads the configuration from its layers, each overriding the ones before it:
+//
+//  1. defaults compiled into the service
+//  2. the yml file of the environment, pkg/config/config-<environment>.yaml, or --config
+//  3. the config server, when environment is REMOTE or CONFIG_SERVER_URL is set
+//  4. environment variables named RTT_ and the upper cased setting, e.g. RTT_KAFKA_BROKERS
+//  5. command line flags
+//  6. secret files in the secrets directory, each named after its setting
+type Loader struct {
+	env         string
+	file        string
+	remote      *RemoteSource
+	secretsDir  string
+	overrides   []override
+	printConfig bool
+}
+
+type override struct {
+	key   string
+	value string
+	flag  string
+}
+
+// Source tells which layer a setting was read from and where, e.g. the file or variable name.
+type Source struct {
+	Layer  string
+	Origin string
+}
+
+func (s Source) String() string {
+	if s.Origin == "" {
+		return s.Layer
+	}
+	return s.Layer + " " + s.Origin
+}
+
+type setting struct {
+	key    string
+	secret bool
+	// nested is set for maps, whose entries can be set individually as key.entry.
+	nested bool
+}
+
+// NewLoader parses the command line arguments, without the program name, and locates the layers
+// they and the environment select.
+func NewLoader(args []string) (*Loader, error) {
+	flags := pflag.NewFlagSet("real-time-trade", pflag.ContinueOnError)
+	env := flags.String("environment", os.Getenv(environmentKey), "selects pkg/config/config-<environment>.yaml; REMOTE also reads the config server")
+	file := flags.String("config", "", "yml file to read instead of the one of the environment")
+	secretsDir := flags.String("secrets-dir", envOrDefault(secretsDirKey, defaultSecretsDir), "directory of secret files named after their setting, e.g. kafka.sasl.password")
+	printConfig := flags.Bool("print-config", false, "print the effective configuration and the source of every setting, then exit")
+	sets := flags.StringArray("set", nil, "change a setting, e.g. --set server.port=5001 (repeatable)")
+	shortcuts := make([]*string, len(shortcutFlags))
+	for i, shortcut := range shortcutFlags {
+		shortcuts[i] = flags.String(shortcut.name, "", "same as --set "+shortcut.key+"=...")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	l := &Loader{
+		env:         strings.ToUpper(*env),
+		secretsDir:  *secretsDir,
+		printConfig: *printConfig,
+	}
+
+	var errs []error
+	for i, shortcut := range shortcutFlags {
+		if flags.Changed(shortcut.name) {
+			l.overrides = append(l.overrides, override{key: shortcut.key, value: *shortcuts[i], flag: "--" + shortcut.name})
+		}
+	}
+	for _, set := range *sets {
+		key, value, ok := strings.Cut(set, "=")
+		if !ok {
+			errs = append(errs, fmt.Errorf("--set %s: expected setting=value", set))
+			continue
+		}
+		if _, known := lookupSetting(key); !known {
+			errs = append(errs, fmt.Errorf("--set %s: unknown setting %q", set, key))
+			continue
+		}
+		l.overrides = append(l.overrides, override{key: key, value: value, flag: "--set " + key})
+	}
+
+	var err error
+	if l.file, err = configFile(l.env, *file); err != nil {
+		errs = append(errs, err)
+	}
+	if l.env == "REMOTE" || os.Getenv(configServerUrlKey) != "" {
+		l.remote = NewRemoteSourceFromEnv()
+	}
+
+	return l, errors.Join(errs...)
+}
+
+// configFile returns the yml file to read: explicit when set, else the file of env. Without an
+// environment a missing config-dev.yaml is fine and the defaults apply.
+func configFile(env, explicit string) (string, error) {
+	if explicit != "" {
+		if _, err := os.Stat(explicit); err != nil {
+			return "", fmt.Errorf("--config: %w", err)
+		}
+		return explicit, nil
+	}
+
+	name := "config-dev"
+	switch env {
+	case "", "DEV", "REMOTE":
+	default:
+		name = "config-" + strings.ToLower(env)
+	}
+	path := filepath.Join(defaultConfigPath, name+"."+configFileType)
+	if _, err := os.Stat(path); err != nil {
+		if env == "" && errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", fmt.Errorf("%s %s: %w", environmentKey, env, err)
+	}
+	return path, nil
+}
+
+// Environment returns the selected environment, upper cased.
+func (l *Loader) Environment() string {
+	return l.env
+}
+
+// File returns the yml file read, or an empty string when only the defaults are used.
+func (l *Loader) File() string {
+	return l.file
+}
+
+// PrintConfigRequested reports whether --print-config was given.
+func (l *Loader) PrintConfigRequested() bool {
+	return l.printConfig
+}
+
+// Load reads every layer and returns the resulting configuration. It does not validate it.
+func (l *Loader) Load() (*Config, error) {
+	v, _, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Config{}
+	if err = v.Unmarshal(c, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		secondsHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))); err != nil {
+		return nil, fmt.Errorf("decoding configuration: %w", err)
+	}
+	return c, nil
+}
+
+// PrintConfig writes every setting with its effective value and source. Secrets and the
+// passwords of URLs are redacted.
+func (l *Loader) PrintConfig(w io.Writer) error {
+	v, sources, err := l.read()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range settings() {
+		source := sources[strings.ToLower(s.key)]
+		value := fmt.Sprintf("%v", v.Get(s.key))
+		if s.secret || source.Layer == "secret" {
+			if value != "" {
+				value = redacted
+			}
+		} else {
+			value = redactUrl(value)
+		}
+		if _, err = fmt.Fprintf(w, "%-32s = %-40s (%s)\n", s.key, value, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Loader) read() (*viper.Viper, map[string]Source, error) {
+	v := viper.New()
+	sources := make(map[string]Source)
+	set := func(key string, source Source) {
+		if s, known := lookupSetting(key); known {
+			key = s.key
+		}
+		sources[strings.ToLower(key)] = source
+	}
+
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	for _, s := range settings() {
+		set(s.key, Source{Layer: "default"})
+	}
+
+	if l.file != "" {
+		v.SetConfigFile(l.file)
+		v.SetConfigType(configFileType)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, nil, fmt.Errorf("reading %s: %w", l.file, err)
+		}
+		for _, s := range settings() {
+			if v.InConfig(s.key) {
+				set(s.key, Source{Layer: "file", Origin: l.file})
+			}
+		}
+	}
+
+	if l.remote != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), configServerTimeout)
+		defer cancel()
+		remoteSettings, err := l.remote.Load(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("remote configuration: %w", err)
+		}
+		if err = v.MergeConfigMap(remoteSettings); err != nil {
+			return nil, nil, fmt.Errorf("merging remote configuration: %w", err)
+		}
+		for _, key := range flattenKeys("", remoteSettings) {
+			set(key, Source{Layer: "remote", Origin: l.remote.Url})
+		}
+	}
+
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	for _, s := range settings() {
+		if err := v.BindEnv(s.key); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := os.LookupEnv(envName(s.key)); ok {
+			set(s.key, Source{Layer: "env", Origin: envName(s.key)})
+		}
+	}
+
+	for _, o := range l.overrides {
+		v.Set(o.key, o.value)
+		set(o.key, Source{Layer: "flag", Origin: o.flag})
+	}
+
+	if err := l.readSecrets(v, set); err != nil {
+		return nil, nil, err
+	}
+
+	return v, sources, nil
+}
+
+// readSecrets sets every file of the secrets directory, such as a mounted Kubernetes secret, as
+// the setting it is named after. A missing directory is skipped.
+func (l *Loader) readSecrets(v *viper.Viper, set func(string, Source)) error {
+	entries, err := os.ReadDir(l.secretsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("secrets: %w", err)
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		// Kubernetes mounts the files through hidden ..data directories and symlinks.
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(l.secretsDir, entry.Name())
+		if _, known := lookupSetting(entry.Name()); !known {
+			errs = append(errs, fmt.Errorf("secret %s: unknown setting %q", path, entry.Name()))
+			continue
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("secret %s: %w", path, err))
+			continue
+		}
+		v.Set(entry.Name(), strings.TrimRight(string(b), "\r\n"))
+		set(entry.Name(), Source{Layer: "secret", Origin: path})
+	}
+	return errors.Join(errs...)
+}
+
+// settings lists every setting of Config by its dotted mapstructure path.
+func settings() []setting {
+	return collectSettings("", reflect.TypeOf(Config{}))
+}
+
+func collectSettings(prefix string, t reflect.Type) []setting {
+	var result []setting
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := f.Tag.Get(tagName)
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if f.Type.Kind() == reflect.Struct {
+			result = append(result, collectSettings(key, f.Type)...)
+			continue
+		}
+		result = append(result, setting{
+			key:    key,
+			secret: f.Tag.Get(secretTagName) == "true",
+			nested: f.Type.Kind() == reflect.Map,
+		})
+	}
+	return result
+}
+
+// lookupSetting finds the setting of key, ignoring case. Entries of maps belong to the map.
+func lookupSetting(key string) (setting, bool) {
+	key = strings.ToLower(key)
+	for _, s := range settings() {
+		lower := strings.ToLower(s.key)
+		if key == lower || (s.nested && strings.HasPrefix(key, lower+".")) {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+func envName(key string) string {
+	return envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+func flattenKeys(prefix string, settings map[string]interface{}) []string {
+	var keys []string
+	for name, value := range settings {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			keys = append(keys, flattenKeys(key, nested)...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// secondsHookFunc decodes text into the durations of the configuration, which count seconds:
+// both "5" and "5s" become 5. Durations that are not whole seconds, such as "500ms", are rejected
+// rather than cut short.
+func secondsHookFunc() mapstructure.DecodeHookFuncType {
+	durationType := reflect.TypeOf(time.Duration(0))
+	return func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+		if from.Kind() != reflect.String || to != durationType {
+			return data, nil
+		}
+		text := strings.TrimSpace(data.(string))
+		if seconds, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return time.Duration(seconds), nil
+		}
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither seconds nor a duration", text)
+		}
+		if d%time.Second != 0 {
+			return nil, fmt.Errorf("%q is not a whole number of seconds", text)
+		}
+		return d / time.Second, nil
+	}
+}
+
+func redactUrl(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	return u.Redacted()
+}
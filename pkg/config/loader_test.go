@@ -0,0 +1,50 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSecondsHookFunc(t *testing.T) {
+	hook := secondsHookFunc()
+	durationType := reflect.TypeOf(time.Duration(0))
+
+	cases := []struct {
+		text    string
+		seconds time.Duration
+		wantErr bool
+	}{
+		{text: "5", seconds: 5},
+		{text: " 30 ", seconds: 30},
+		{text: "5s", seconds: 5},
+		{text: "2m", seconds: 120},
+		{text: "1h30m", seconds: 5400},
+		{text: "0s", seconds: 0},
+		{text: "500ms", wantErr: true},
+		{text: "1.5s", wantErr: true},
+		{text: "soon", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.text, func(t *testing.T) {
+			got, err := hook(reflect.TypeOf(""), durationType, c.text)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != c.seconds {
+				t.Errorf("got %v, want %v", got, c.seconds)
+			}
+		})
+	}
+
+	// Anything but text into a duration passes through untouched.
+	if got, err := hook(reflect.TypeOf(""), reflect.TypeOf(""), "500ms"); err != nil || got != "500ms" {
+		t.Errorf("text into text: got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The config server is located through the environment, as it has to be reached before any
+// configuration is read.
+const (
+	configServerUrlKey    = "CONFIG_SERVER_URL"
+	configServerTokenKey  = "CONFIG_SERVER_TOKEN"
+	configServerPrefixKey = "CONFIG_SERVER_PREFIX"
+	configCachePathKey    = "CONFIG_CACHE_PATH"
+
+	defaultConfigServerUrl    = "http://localhost:8500"
+	defaultConfigServerPrefix = "real-time-trade"
+	defaultConfigCachePath    = ".config-cache.yaml"
+	configServerTimeout       = 5 * time.Second
+
+	// Blocking queries return after configServerWait without a change; failed ones are retried
+	// after configServerRetry.
+	configServerWait  = 5 * time.Minute
+	configServerRetry = 10 * time.Second
+)
+
+// RemoteSource reads settings from the Consul KV store. Every key below Prefix holds one setting,
+// its path mirroring the YAML structure: real-time-trade/kafka/brokers holds the value of
+// kafka.brokers. Values are YAML, so lists and numbers keep their types.
+type RemoteSource struct {
+	Url       string
+	Token     string
+	Prefix    string
+	CachePath string
+
+	client *http.Client
+}
+
+// NewRemoteSourceFromEnv configures the remote source from CONFIG_SERVER_URL, CONFIG_SERVER_TOKEN,
+// CONFIG_SERVER_PREFIX and CONFIG_CACHE_PATH.
+func NewRemoteSourceFromEnv() *RemoteSource {
+	return &RemoteSource{
+		Url:       envOrDefault(configServerUrlKey, defaultConfigServerUrl),
+		Token:     os.Getenv(configServerTokenKey),
+		Prefix:    strings.Trim(envOrDefault(configServerPrefixKey, defaultConfigServerPrefix), "/"),
+		CachePath: envOrDefault(configCachePathKey, defaultConfigCachePath),
+		client:    &http.Client{Timeout: configServerTimeout},
+	}
+}
+
+type consulPair struct {
+	Key   string `json:"Key"`
+	Value string `json:"Value"`
+}
+
+// Load returns the settings of the config server and refreshes the cache file with them. When the
+// server cannot be reached the settings of the last successful load are read from the cache.
+func (s *RemoteSource) Load(ctx context.Context) (map[string]interface{}, error) {
+	settings, err := s.fetch(ctx)
+	if err == nil {
+		if cacheErr := s.writeCache(settings); cacheErr != nil {
+			fmt.Printf("Config cache %s could not be written: %s\n", s.CachePath, cacheErr)
+		}
+		return settings, nil
+	}
+
+	fmt.Printf("Config server %s unavailable, falling back to cache %s: %s\n", s.Url, s.CachePath, err)
+	cached, cacheErr := s.readCache()
+	if cacheErr != nil {
+		return nil, errors.Join(err, fmt.Errorf("config cache: %w", cacheErr))
+	}
+	return cached, nil
+}
+
+// Watch calls onChange whenever a key below Prefix changes, using Consul blocking queries, until
+// ctx is done.
+func (s *RemoteSource) Watch(ctx context.Context, onChange func()) {
+	client := &http.Client{Timeout: configServerWait + configServerTimeout}
+	var index string
+	for ctx.Err() == nil {
+		_, next, err := s.query(ctx, client, index)
+		if err == nil && next == "" {
+			err = errors.New("response without X-Consul-Index, blocking queries unsupported")
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Printf("Watching config server %s failed, retrying: %s\n", s.Url, err)
+			timer := time.NewTimer(configServerRetry)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			continue
+		}
+
+		if index != "" && next != index {
+			onChange()
+		}
+		index = next
+	}
+}
+
+func (s *RemoteSource) fetch(ctx context.Context) (map[string]interface{}, error) {
+	pairs, _, err := s.query(ctx, s.client, "")
+	if err != nil {
+		return nil, err
+	}
+	return s.settings(pairs)
+}
+
+// query lists the keys below Prefix. With a non-empty index it blocks until the keys change past
+// that index or the wait time elapses. It returns the index of the listed keys.
+func (s *RemoteSource) query(ctx context.Context, client *http.Client, index string) ([]consulPair, string, error) {
+	endpoint, err := url.Parse(s.Url)
+	if err != nil {
+		return nil, "", err
+	}
+	endpoint.Path = path.Join(endpoint.Path, "/v1/kv", s.Prefix) + "/"
+	query := url.Values{"recurse": {"true"}}
+	if index != "" {
+		query.Set("index", index)
+		query.Set("wait", configServerWait.String())
+	}
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.Token != "" {
+		req.Header.Set("X-Consul-Token", s.Token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, "", fmt.Errorf("no keys below %q", s.Prefix)
+	case http.StatusForbidden, http.StatusUnauthorized:
+		return nil, "", fmt.Errorf("access to %q denied, check %s", s.Prefix, configServerTokenKey)
+	default:
+		return nil, "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var pairs []consulPair
+	if err = json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, "", fmt.Errorf("decoding response: %w", err)
+	}
+	return pairs, resp.Header.Get("X-Consul-Index"), nil
+}
+
+// settings turns the flat key-value pairs into the nested map viper merges. Folder keys, which
+// end with a slash and have no value, are skipped.
+func (s *RemoteSource) settings(pairs []consulPair) (map[string]interface{}, error) {
+	settings := make(map[string]interface{})
+	for _, pair := range pairs {
+		keyPath := strings.Trim(strings.TrimPrefix(pair.Key, s.Prefix), "/")
+		if keyPath == "" || strings.HasSuffix(pair.Key, "/") {
+			continue
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(pair.Value)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", pair.Key, err)
+		}
+		var value interface{}
+		if err = yaml.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("key %s: %w", pair.Key, err)
+		}
+
+		if err = setPath(settings, strings.Split(keyPath, "/"), value); err != nil {
+			return nil, fmt.Errorf("key %s: %w", pair.Key, err)
+		}
+	}
+	return settings, nil
+}
+
+func setPath(settings map[string]interface{}, path []string, value interface{}) error {
+	for _, name := range path[:len(path)-1] {
+		child, ok := settings[name]
+		if !ok {
+			child = make(map[string]interface{})
+			settings[name] = child
+		}
+		childSettings, ok := child.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is both a value and a folder", name)
+		}
+		settings = childSettings
+	}
+	name := path[len(path)-1]
+	if _, ok := settings[name].(map[string]interface{}); ok {
+		return fmt.Errorf("%s is both a value and a folder", name)
+	}
+	settings[name] = value
+	return nil
+}
+
+func (s *RemoteSource) writeCache(settings map[string]interface{}) error {
+	b, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	// Written next to the cache and renamed, so a crash never leaves a truncated cache behind.
+	tmp, err := os.CreateTemp(filepath.Dir(s.CachePath), filepath.Base(s.CachePath)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.CachePath)
+}
+
+func (s *RemoteSource) readCache() (map[string]interface{}, error) {
+	b, err := os.ReadFile(s.CachePath)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]interface{})
+	if err = yaml.Unmarshal(b, &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func envOrDefault(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
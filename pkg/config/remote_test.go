@@ -0,0 +1,236 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testPrefix = "real-time-trade"
+
+// fakeKV serves the keys below testPrefix as the Consul KV API does, answering blocking queries
+// once the keys change past the queried index.
+type fakeKV struct {
+	mu      sync.Mutex
+	keys    map[string]string
+	index   int
+	changed chan struct{}
+	blocked chan struct{}
+	token   string
+	status  int
+}
+
+func newFakeKV(t *testing.T, keys map[string]string) (*fakeKV, *httptest.Server) {
+	t.Helper()
+	kv := &fakeKV{keys: keys, index: 1, changed: make(chan struct{}), blocked: make(chan struct{}, 1)}
+	server := httptest.NewServer(kv)
+	t.Cleanup(server.Close)
+	return kv, server
+}
+
+func (kv *fakeKV) set(key, value string) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	kv.keys[key] = value
+	kv.index++
+	close(kv.changed)
+	kv.changed = make(chan struct{})
+}
+
+func (kv *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/kv/"+testPrefix+"/" || r.URL.Query().Get("recurse") != "true" {
+		http.NotFound(w, r)
+		return
+	}
+
+	kv.mu.Lock()
+	if kv.token != "" && r.Header.Get("X-Consul-Token") != kv.token {
+		kv.mu.Unlock()
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if kv.status != 0 {
+		kv.mu.Unlock()
+		w.WriteHeader(kv.status)
+		return
+	}
+	if index := r.URL.Query().Get("index"); index == strconv.Itoa(kv.index) {
+		changed := kv.changed
+		kv.mu.Unlock()
+		select {
+		case kv.blocked <- struct{}{}:
+		default:
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+		kv.mu.Lock()
+	}
+	defer kv.mu.Unlock()
+
+	pairs := []consulPair{{Key: testPrefix + "/"}}
+	for key, value := range kv.keys {
+		pairs = append(pairs, consulPair{Key: testPrefix + "/" + key, Value: base64.StdEncoding.EncodeToString([]byte(value))})
+	}
+	w.Header().Set("X-Consul-Index", strconv.Itoa(kv.index))
+	_ = json.NewEncoder(w).Encode(pairs)
+}
+
+func newTestSource(t *testing.T, url string) *RemoteSource {
+	t.Helper()
+	return &RemoteSource{
+		Url:       url,
+		Prefix:    testPrefix,
+		CachePath: filepath.Join(t.TempDir(), "config-cache.yaml"),
+		client:    &http.Client{Timeout: time.Second},
+	}
+}
+
+func TestRemoteSourceLoad(t *testing.T) {
+	_, server := newFakeKV(t, map[string]string{
+		"kafka/brokers":      "[broker-1:9092, broker-2:9092]",
+		"kafka/retries":      "3",
+		"logger/level":       "debug",
+		"exchange/symbols/":  "",
+		"exchange/reconnect": "true",
+	})
+	source := newTestSource(t, server.URL)
+
+	settings, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"kafka": map[string]interface{}{
+			"brokers": []interface{}{"broker-1:9092", "broker-2:9092"},
+			"retries": 3,
+		},
+		"logger":   map[string]interface{}{"level": "debug"},
+		"exchange": map[string]interface{}{"reconnect": true},
+	}
+	if !reflect.DeepEqual(settings, want) {
+		t.Errorf("settings = %v, want %v", settings, want)
+	}
+}
+
+func TestRemoteSourceSendsToken(t *testing.T) {
+	kv, server := newFakeKV(t, map[string]string{"logger/level": "info"})
+	kv.token = "secret-token"
+	source := newTestSource(t, server.URL)
+
+	if _, err := source.Load(context.Background()); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Fatalf("Load without token returned %v, want access denied", err)
+	}
+
+	source.Token = kv.token
+	if _, err := source.Load(context.Background()); err != nil {
+		t.Fatalf("Load with token: %v", err)
+	}
+}
+
+func TestRemoteSourceRejectsInvalidKeys(t *testing.T) {
+	cases := map[string]map[string]string{
+		"invalid yaml":     {"kafka/brokers": "[broker-1"},
+		"value and folder": {"kafka": "1", "kafka/brokers": "broker-1"},
+	}
+	for name, keys := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, server := newFakeKV(t, keys)
+			source := newTestSource(t, server.URL)
+			if _, err := source.fetch(context.Background()); err == nil {
+				t.Error("fetch returned no error")
+			}
+		})
+	}
+}
+
+// Once loaded, the settings survive the config server going away.
+func TestRemoteSourceFallsBackToCache(t *testing.T) {
+	_, server := newFakeKV(t, map[string]string{"logger/level": "debug", "kafka/retries": "3"})
+	source := newTestSource(t, server.URL)
+
+	loaded, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	server.Close()
+	cached, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load with the server down: %v", err)
+	}
+	if !reflect.DeepEqual(cached, loaded) {
+		t.Errorf("cached settings = %v, want %v", cached, loaded)
+	}
+}
+
+func TestRemoteSourceFallsBackToCacheOnErrorStatus(t *testing.T) {
+	kv, server := newFakeKV(t, map[string]string{"logger/level": "debug"})
+	source := newTestSource(t, server.URL)
+	if _, err := source.Load(context.Background()); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	kv.status = http.StatusInternalServerError
+	settings, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load with the server failing: %v", err)
+	}
+	if want := map[string]interface{}{"logger": map[string]interface{}{"level": "debug"}}; !reflect.DeepEqual(settings, want) {
+		t.Errorf("cached settings = %v, want %v", settings, want)
+	}
+}
+
+func TestRemoteSourceWithoutCache(t *testing.T) {
+	_, server := newFakeKV(t, nil)
+	server.Close()
+	source := newTestSource(t, server.URL)
+
+	_, err := source.Load(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "config cache") {
+		t.Fatalf("Load returned %v, want a config cache error", err)
+	}
+}
+
+func TestRemoteSourceWatch(t *testing.T) {
+	kv, server := newFakeKV(t, map[string]string{"logger/level": "info"})
+	source := newTestSource(t, server.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		source.Watch(ctx, func() { changes <- struct{}{} })
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// The first query only learns the index, so wait for the watch to block on it.
+	select {
+	case <-kv.blocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch never blocked on the config server")
+	}
+
+	kv.set("logger/level", "debug")
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported")
+	}
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// topicTemplates are the default topicName templates of the topic strategies: a topic per
+// symbol and stream, a single topic per stream partitioned by symbol, or a topic per exchange
+// and stream.
+var topicTemplates = map[string]string{
+	"per-symbol":   "{stream}-{symbol}",
+	"shared":       "{stream}",
+	"per-exchange": "{exchange}.{stream}",
+}
+
+var (
+	topicPlaceholder = regexp.MustCompile(`\{[^}]*}`)
+	topicPattern     = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+)
+
+// DefaultTopicTemplate returns the topicName template used when topicName is empty.
+func DefaultTopicTemplate(strategy string) string {
+	return topicTemplates[strategy]
+}
+
+// validateTopicTemplate checks that the template only uses known placeholders, separates the
+// streams and names topics the way its strategy partitions them.
+func validateTopicTemplate(strategy, template string) error {
+	if template == "" {
+		return nil
+	}
+
+	for _, placeholder := range topicPlaceholder.FindAllString(template, -1) {
+		switch placeholder {
+		case "{exchange}", "{stream}", "{symbol}":
+		default:
+			return fmt.Errorf("kafka.topicName: unknown placeholder %s, use {exchange}, {stream} or {symbol}", placeholder)
+		}
+	}
+	if !strings.Contains(template, "{stream}") {
+		return fmt.Errorf("kafka.topicName: %q must contain {stream}, so trades and derived streams get their own topics", template)
+	}
+	perSymbol := strings.Contains(template, "{symbol}")
+	switch {
+	case strategy == "per-symbol" && !perSymbol:
+		return fmt.Errorf("kafka.topicName: %q must contain {symbol} with strategy per-symbol", template)
+	case strategy != "per-symbol" && perSymbol:
+		return fmt.Errorf("kafka.topicName: %q must not contain {symbol} with strategy %s", template, strategy)
+	case strategy == "per-exchange" && !strings.Contains(template, "{exchange}"):
+		return fmt.Errorf("kafka.topicName: %q must contain {exchange} with strategy per-exchange", template)
+	}
+
+	sample := strings.NewReplacer("{exchange}", "binance", "{stream}", "trades", "{symbol}", "btcusdt").Replace(template)
+	if !topicPattern.MatchString(sample) {
+		return fmt.Errorf("kafka.topicName: %q is no valid topic name, only letters, digits, '.', '_' and '-' are allowed", sample)
+	}
+	return nil
+}
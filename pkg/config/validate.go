@@ -0,0 +1,597 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	symbolPattern = regexp.MustCompile(`^[a-z0-9]{2,20}$`)
+
+	logLevels       = []string{"debug", "info", "warn", "error", "dpanic", "panic", "fatal"}
+	logEncodings    = []string{"json", "console"}
+	failureActions  = []string{"retry", "skip", "escalate"}
+	saslMechanisms  = []string{"plain", "scram-sha-256", "scram-sha-512"}
+	messageFormats  = []string{"json", "avro", "protobuf"}
+	deliveries      = []string{"at-least-once", "idempotent"}
+	topicStrategies = []string{"per-symbol", "shared", "per-exchange"}
+	balancers       = []string{"key", "least-bytes"}
+	compatibilities = []string{"BACKWARD", "BACKWARD_TRANSITIVE", "FORWARD", "FORWARD_TRANSITIVE", "FULL", "FULL_TRANSITIVE", "NONE"}
+)
+
+// ValidationError lists every invalid setting of a configuration, so that all of them can be
+// fixed at once.
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d invalid configuration setting(s):", len(e.Errors))
+	for _, err := range e.Errors {
+		b.WriteString("\n  - ")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return e.Errors
+}
+
+// Validate checks every section and returns a *ValidationError with all invalid settings, or nil.
+func (c *Config) Validate() error {
+	var errs []error
+	for _, err := range []error{
+		c.Server.Validate(),
+		c.Metric.Validate(),
+		c.Logger.Validate(),
+		c.Jaeger.Validate(),
+		c.Kafka.Validate(),
+		validateTickers(c.Tickers),
+		c.Capture.Validate(),
+		c.Exchange.Validate(),
+		c.FailurePolicy.Validate(),
+		c.Health.Validate(),
+		c.Stats.Validate(),
+		c.Indicators.Validate(),
+		c.Alerts.Validate(),
+		c.Candles.Validate(),
+	} {
+		errs = append(errs, unjoin(err)...)
+	}
+	if c.Candles.Enabled && c.Kafka.TransactionalId == "" {
+		errs = append(errs, fmt.Errorf("kafka.transactionalId: required when candles are enabled"))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: errs}
+}
+
+func (c ServerConfig) Validate() error {
+	var errs []error
+
+	errs = append(errs, validatePort("server.port", c.Port, true))
+	errs = append(errs, validatePort("server.debugPort", c.DebugPort, false))
+	if c.DebugPort != "" && c.DebugPort == c.Port {
+		errs = append(errs, fmt.Errorf("server.debugPort: must differ from server.port %s", c.Port))
+	}
+	if c.ReadTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("server.readTimeout: must be a positive number of seconds"))
+	}
+	if c.WriteTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("server.writeTimeout: must be a positive number of seconds"))
+	}
+	if c.CtxTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("server.ctxTimeout: must be a positive number of seconds"))
+	}
+	if c.MaxHeaderBytes < 0 {
+		errs = append(errs, fmt.Errorf("server.maxHeaderBytes: must not be negative"))
+	}
+	if c.RateLimit.Rate < 0 {
+		errs = append(errs, fmt.Errorf("server.rateLimit.rate: must not be negative"))
+	}
+	if c.RateLimit.Burst < 0 {
+		errs = append(errs, fmt.Errorf("server.rateLimit.burst: must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c MetricConfig) Validate() error {
+	var errs []error
+
+	errs = append(errs, validateHostPort("metric.url", c.Url, false))
+	if c.ServiceName == "" {
+		errs = append(errs, fmt.Errorf("metric.serviceName: required, it prefixes every metric name"))
+	}
+	errs = append(errs, validateBuckets("metric.buckets.http", c.Buckets.Http))
+	errs = append(errs, validateBuckets("metric.buckets.publish", c.Buckets.Publish))
+	errs = append(errs, validateBuckets("metric.buckets.ingest", c.Buckets.Ingest))
+
+	return errors.Join(errs...)
+}
+
+func (c LoggerConfig) Validate() error {
+	var errs []error
+
+	// Levels are read case-insensitively, like the admin routes do.
+	errs = append(errs, validateOneOf("logger.level", strings.ToLower(c.Level), logLevels, true))
+	errs = append(errs, validateOneOf("logger.encoding", c.Encoding, logEncodings, true))
+	for component, level := range c.Components {
+		if strings.Trim(component, ".") == "" {
+			errs = append(errs, fmt.Errorf("logger.components: empty component name"))
+			continue
+		}
+		errs = append(errs, validateOneOf("logger.components."+component, strings.ToLower(level), logLevels, true))
+	}
+	if c.Sampling.Initial < 0 {
+		errs = append(errs, fmt.Errorf("logger.sampling.initial: must not be negative"))
+	}
+	if c.Sampling.Thereafter < 0 {
+		errs = append(errs, fmt.Errorf("logger.sampling.thereafter: must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c JaegerConfig) Validate() error {
+	var errs []error
+
+	errs = append(errs, validateHostPort("jaeger.host", c.Host, true))
+	if c.ServiceName == "" {
+		errs = append(errs, fmt.Errorf("jaeger.serviceName: required"))
+	}
+	if c.SamplingRatio < 0 || c.SamplingRatio > 1 {
+		errs = append(errs, fmt.Errorf("jaeger.samplingRatio: must be between 0 and 1, got %v", c.SamplingRatio))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c KafkaConfig) Validate() error {
+	var errs []error
+
+	if len(c.Brokers) == 0 {
+		errs = append(errs, fmt.Errorf("kafka.brokers: at least one broker is required"))
+	}
+	for i, broker := range c.Brokers {
+		errs = append(errs, validateHostPort(fmt.Sprintf("kafka.brokers[%d]", i), broker, true))
+	}
+	if c.InitTopics {
+		if c.Partitions < 1 {
+			errs = append(errs, fmt.Errorf("kafka.partitions: must be at least 1 when initTopics is set"))
+		}
+		if c.ReplicationFactor < 1 {
+			errs = append(errs, fmt.Errorf("kafka.replicationFactor: must be at least 1 when initTopics is set"))
+		}
+	}
+	if err := validateOneOf("kafka.topicStrategy", c.TopicStrategy, topicStrategies, true); err != nil {
+		errs = append(errs, err)
+	} else {
+		errs = append(errs, validateTopicTemplate(c.TopicStrategy, c.TopicName))
+	}
+	errs = append(errs, validateOneOf("kafka.balancer", c.Balancer, balancers, true))
+	errs = append(errs, unjoin(c.Sasl.Validate())...)
+	errs = append(errs, unjoin(c.Tls.Validate())...)
+	errs = append(errs, validateOneOf("kafka.format", c.Format, messageFormats, true))
+	errs = append(errs, validateOneOf("kafka.delivery", c.Delivery, deliveries, true))
+	if c.Format == "avro" || c.Format == "protobuf" {
+		errs = append(errs, unjoin(c.SchemaRegistry.Validate())...)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c KafkaSaslConfig) Validate() error {
+	var errs []error
+
+	errs = append(errs, validateOneOf("kafka.sasl.mechanism", c.Mechanism, saslMechanisms, false))
+	if c.Mechanism != "" {
+		if c.Username == "" {
+			errs = append(errs, fmt.Errorf("kafka.sasl.username: required with mechanism %s", c.Mechanism))
+		}
+		if c.Password == "" {
+			errs = append(errs, fmt.Errorf("kafka.sasl.password: required with mechanism %s", c.Mechanism))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c SchemaRegistryConfig) Validate() error {
+	var errs []error
+
+	if c.Url == "" {
+		errs = append(errs, fmt.Errorf("kafka.schemaRegistry.url: required for avro and protobuf"))
+	} else if u, err := url.Parse(c.Url); err != nil {
+		errs = append(errs, fmt.Errorf("kafka.schemaRegistry.url: %w", err))
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		errs = append(errs, fmt.Errorf("kafka.schemaRegistry.url: scheme must be http or https, got %q", u.Scheme))
+	}
+	errs = append(errs, validateOneOf("kafka.schemaRegistry.compatibility", c.Compatibility, compatibilities, false))
+	if c.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("kafka.schemaRegistry.timeout: must be a positive number of seconds"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c KafkaTlsConfig) Validate() error {
+	var errs []error
+
+	if !c.Enabled {
+		return nil
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("kafka.tls: certFile and keyFile must be set together"))
+	}
+	errs = append(errs, validateFile("kafka.tls.caFile", c.CaFile))
+	errs = append(errs, validateFile("kafka.tls.certFile", c.CertFile))
+	errs = append(errs, validateFile("kafka.tls.keyFile", c.KeyFile))
+
+	return errors.Join(errs...)
+}
+
+// validateTickers requires at least one symbol, each lower case letters and digits like btcusdt,
+// and no duplicates.
+func validateTickers(tickers []string) error {
+	var errs []error
+
+	if len(tickers) == 0 {
+		errs = append(errs, fmt.Errorf("tickers: at least one symbol is required"))
+	}
+	seen := make(map[string]bool, len(tickers))
+	for i, ticker := range tickers {
+		if !symbolPattern.MatchString(ticker) {
+			errs = append(errs, fmt.Errorf("tickers[%d]: %q is not a symbol like btcusdt (lower case letters and digits)", i, ticker))
+			continue
+		}
+		if seen[ticker] {
+			errs = append(errs, fmt.Errorf("tickers[%d]: duplicate symbol %q", i, ticker))
+		}
+		seen[ticker] = true
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c CaptureConfig) Validate() error {
+	var errs []error
+
+	if c.RecordPath != "" && c.ReplayPath != "" {
+		errs = append(errs, fmt.Errorf("capture: recordPath and replayPath are mutually exclusive"))
+	}
+	if c.RecordPath != "" {
+		if _, err := os.Stat(filepath.Dir(c.RecordPath)); err != nil {
+			errs = append(errs, fmt.Errorf("capture.recordPath: %w", err))
+		}
+	}
+	if c.ReplayPath != "" {
+		if _, err := os.Stat(c.ReplayPath); err != nil {
+			errs = append(errs, fmt.Errorf("capture.replayPath: %w", err))
+		}
+	}
+	if c.ReplaySpeed < 0 {
+		errs = append(errs, fmt.Errorf("capture.replaySpeed: must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate reports exchange settings that would only fail once the listener dials.
+func (c ExchangeConfig) Validate() error {
+	var errs []error
+
+	if c.Url != "" {
+		u, err := url.Parse(c.Url)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("exchange.url: %w", err))
+		case u.Scheme != "ws" && u.Scheme != "wss":
+			errs = append(errs, fmt.Errorf("exchange.url: scheme must be ws or wss, got %q", u.Scheme))
+		case u.Host == "":
+			errs = append(errs, fmt.Errorf("exchange.url: missing host"))
+		}
+	}
+
+	if c.ProxyUrl != "" {
+		u, err := url.Parse(c.ProxyUrl)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("exchange.proxyUrl: %w", err))
+		case u.Scheme != "http" && u.Scheme != "socks5" && u.Scheme != "socks5h":
+			errs = append(errs, fmt.Errorf("exchange.proxyUrl: scheme must be http, socks5 or socks5h, got %q", u.Scheme))
+		case u.Host == "":
+			errs = append(errs, fmt.Errorf("exchange.proxyUrl: missing host"))
+		}
+	}
+
+	if c.CaBundle != "" {
+		if _, err := os.Stat(c.CaBundle); err != nil {
+			errs = append(errs, fmt.Errorf("exchange.caBundle: %w", err))
+		}
+	}
+
+	if c.HandshakeTimeout < 0 {
+		errs = append(errs, fmt.Errorf("exchange.handshakeTimeout: must not be negative"))
+	}
+	if c.ReadBufferSize < 0 {
+		errs = append(errs, fmt.Errorf("exchange.readBufferSize: must not be negative"))
+	}
+	if c.WriteBufferSize < 0 {
+		errs = append(errs, fmt.Errorf("exchange.writeBufferSize: must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c FailurePolicyConfig) Validate() error {
+	var errs []error
+
+	errs = append(errs, validateOneOf("failurePolicy.connection", c.Connection, failureActions, false))
+	errs = append(errs, validateOneOf("failurePolicy.subscribe", c.Subscribe, failureActions, false))
+	errs = append(errs, validateOneOf("failurePolicy.decode", c.Decode, failureActions, false))
+	errs = append(errs, validateOneOf("failurePolicy.publish", c.Publish, failureActions, false))
+	if c.MaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("failurePolicy.maxRetries: must not be negative"))
+	}
+	if c.RetryBackoff < 0 {
+		errs = append(errs, fmt.Errorf("failurePolicy.retryBackoff: must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c HealthConfig) Validate() error {
+	var errs []error
+
+	if c.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("health.timeout: must be a positive number of seconds"))
+	}
+	if c.MaxTradeAge <= 0 {
+		errs = append(errs, fmt.Errorf("health.maxTradeAge: must be a positive number of seconds"))
+	}
+	if c.MaxDisconnected <= 0 {
+		errs = append(errs, fmt.Errorf("health.maxDisconnected: must be a positive number of seconds"))
+	}
+	if c.MaxErrorRate < 0 || c.MaxErrorRate > 1 {
+		errs = append(errs, fmt.Errorf("health.maxErrorRate: must be between 0 and 1, got %v", c.MaxErrorRate))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c StatsConfig) Validate() error {
+	var errs []error
+
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.Windows) == 0 {
+		errs = append(errs, fmt.Errorf("stats.windows: at least one window is required"))
+	}
+	seen := make(map[time.Duration]bool, len(c.Windows))
+	for i, window := range c.Windows {
+		if window <= 0 {
+			errs = append(errs, fmt.Errorf("stats.windows[%d]: must be a positive number of seconds", i))
+		}
+		if seen[window] {
+			errs = append(errs, fmt.Errorf("stats.windows[%d]: duplicate window of %d seconds", i, window))
+		}
+		seen[window] = true
+	}
+	if c.PublishInterval <= 0 {
+		errs = append(errs, fmt.Errorf("stats.publishInterval: must be a positive number of seconds"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c IndicatorsConfig) Validate() error {
+	var errs []error
+
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.Intervals) == 0 {
+		errs = append(errs, fmt.Errorf("indicators.intervals: at least one interval is required"))
+	}
+	errs = append(errs, validateIntervals("indicators.intervals", c.Intervals)...)
+	symbols := make([]string, 0, len(c.Symbols))
+	for symbol := range c.Symbols {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		errs = append(errs, validateIntervals("indicators.symbols."+symbol, c.Symbols[symbol])...)
+	}
+
+	for _, period := range []struct {
+		field string
+		value int
+	}{
+		{"indicators.sma", c.Sma},
+		{"indicators.ema", c.Ema},
+		{"indicators.rsi", c.Rsi},
+		{"indicators.atr", c.Atr},
+		{"indicators.macd.fast", c.Macd.Fast},
+		{"indicators.macd.slow", c.Macd.Slow},
+		{"indicators.macd.signal", c.Macd.Signal},
+		{"indicators.bollinger.period", c.Bollinger.Period},
+	} {
+		if period.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s: must be a positive number of candles", period.field))
+		}
+	}
+	if c.Macd.Fast >= c.Macd.Slow {
+		errs = append(errs, fmt.Errorf("indicators.macd: fast (%d) must be shorter than slow (%d)", c.Macd.Fast, c.Macd.Slow))
+	}
+	if c.Bollinger.Deviations <= 0 {
+		errs = append(errs, fmt.Errorf("indicators.bollinger.deviations: must be positive"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c AlertsConfig) Validate() error {
+	var errs []error
+
+	if !c.Enabled {
+		return nil
+	}
+	if c.Token == "" {
+		errs = append(errs, fmt.Errorf("alerts.token: required, it authorizes the alert routes"))
+	}
+	if c.StorePath == "" {
+		errs = append(errs, fmt.Errorf("alerts.storePath: required"))
+	}
+	if c.Cooldown < 0 {
+		errs = append(errs, fmt.Errorf("alerts.cooldown: must not be negative"))
+	}
+	if c.Webhook.Secret == "" {
+		errs = append(errs, fmt.Errorf("alerts.webhook.secret: required, it signs every alert"))
+	}
+	for _, host := range c.Webhook.AllowedHosts {
+		if host == "" || strings.ContainsAny(host, "/:@ ") {
+			errs = append(errs, fmt.Errorf("alerts.webhook.allowedHosts: must be host names, got %q", host))
+		}
+	}
+	if c.Webhook.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("alerts.webhook.timeout: must be a positive number of seconds"))
+	}
+	if c.Webhook.MaxAttempts <= 0 {
+		errs = append(errs, fmt.Errorf("alerts.webhook.maxAttempts: must be positive"))
+	}
+	if c.Webhook.RetryBackoff < 0 {
+		errs = append(errs, fmt.Errorf("alerts.webhook.retryBackoff: must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c CandlesConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Interval <= 0 || 86400%c.Interval != 0 {
+		return fmt.Errorf("candles.interval: must be a positive number of seconds dividing a day, got %d", c.Interval)
+	}
+	return nil
+}
+
+// validateIntervals checks candle intervals of seconds: positive, distinct and dividing a day, so
+// that candles align to the same boundaries on every instance.
+func validateIntervals(field string, intervals []time.Duration) []error {
+	var errs []error
+
+	seen := make(map[time.Duration]bool, len(intervals))
+	for i, interval := range intervals {
+		if interval <= 0 || 86400%interval != 0 {
+			errs = append(errs, fmt.Errorf("%s[%d]: must be a positive number of seconds dividing a day, got %d", field, i, interval))
+		}
+		if seen[interval] {
+			errs = append(errs, fmt.Errorf("%s[%d]: duplicate interval of %d seconds", field, i, interval))
+		}
+		seen[interval] = true
+	}
+	return errs
+}
+
+// validatePort checks that value is a port number, as the servers listen on ":"+value.
+func validatePort(field, value string, required bool) error {
+	if value == "" {
+		if required {
+			return fmt.Errorf("%s: required", field)
+		}
+		return nil
+	}
+
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("%s: %q is not a port between 1 and 65535", field, value)
+	}
+	return nil
+}
+
+// validateHostPort checks that value has the host:port form, e.g. localhost:9092.
+func validateHostPort(field, value string, required bool) error {
+	if value == "" {
+		if required {
+			return fmt.Errorf("%s: required", field)
+		}
+		return nil
+	}
+
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return fmt.Errorf("%s: %q is not host:port", field, value)
+	}
+	if host == "" {
+		return fmt.Errorf("%s: %q is missing the host", field, value)
+	}
+	return validatePort(field, port, true)
+}
+
+// validateFile checks that an optional file exists.
+func validateFile(field, path string) error {
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	return nil
+}
+
+func validateOneOf(field, value string, allowed []string, required bool) error {
+	if value == "" {
+		if required {
+			return fmt.Errorf("%s: required, one of %s", field, strings.Join(allowed, ", "))
+		}
+		return nil
+	}
+
+	for _, candidate := range allowed {
+		if value == candidate {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: %q must be one of %s", field, value, strings.Join(allowed, ", "))
+}
+
+// validateBuckets accepts an empty list, which selects the default buckets, or increasing
+// positive bounds.
+func validateBuckets(field string, buckets []float64) error {
+	for i, bound := range buckets {
+		if bound <= 0 {
+			return fmt.Errorf("%s: bound %v must be positive", field, bound)
+		}
+		if i > 0 && bound <= buckets[i-1] {
+			return fmt.Errorf("%s: bounds must be increasing, %v follows %v", field, bound, buckets[i-1])
+		}
+	}
+	return nil
+}
+
+// unjoin flattens the errors joined by errors.Join into a list.
+func unjoin(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// defaultConfig is the configuration of the compiled in defaults alone.
+func defaultConfig(t *testing.T) *Config {
+	t.Helper()
+	c, err := (&Loader{secretsDir: t.TempDir()}).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	if err := defaultConfig(t).Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(c *Config)
+		want   []string
+	}{
+		{
+			name:   "levels in any case",
+			change: func(c *Config) { c.Logger.Level, c.Logger.Components = "DEBUG", map[string]string{"listener": "Warn"} },
+		},
+		{
+			name:   "unknown level",
+			change: func(c *Config) { c.Logger.Level = "verbose" },
+			want:   []string{`logger.level: "verbose" must be one of debug, info, warn, error, dpanic, panic, fatal`},
+		},
+		{
+			name:   "no tickers",
+			change: func(c *Config) { c.Tickers = nil },
+			want:   []string{"tickers: at least one symbol is required"},
+		},
+		{
+			name:   "upper case and duplicate tickers",
+			change: func(c *Config) { c.Tickers = []string{"BTCUSDT", "ethusdt", "eth-usdt", "ethusdt"} },
+			want: []string{
+				`tickers[0]: "BTCUSDT" is not a symbol like btcusdt (lower case letters and digits)`,
+				`tickers[2]: "eth-usdt" is not a symbol like btcusdt (lower case letters and digits)`,
+				`tickers[3]: duplicate symbol "ethusdt"`,
+			},
+		},
+		{
+			name: "bad durations",
+			change: func(c *Config) {
+				c.Server.ReadTimeout = 0
+				c.Exchange.HandshakeTimeout = -1
+				c.FailurePolicy.RetryBackoff = -1
+				c.Health.MaxTradeAge = 0
+			},
+			want: []string{
+				"server.readTimeout: must be a positive number of seconds",
+				"exchange.handshakeTimeout: must not be negative",
+				"failurePolicy.retryBackoff: must not be negative",
+				"health.maxTradeAge: must be a positive number of seconds",
+			},
+		},
+		{
+			name: "stats windows",
+			change: func(c *Config) {
+				c.Stats.Enabled = true
+				c.Stats.Windows = []time.Duration{60, 0, 60}
+				c.Stats.PublishInterval = 0
+			},
+			want: []string{
+				"stats.windows[1]: must be a positive number of seconds",
+				"stats.windows[2]: duplicate window of 60 seconds",
+				"stats.publishInterval: must be a positive number of seconds",
+			},
+		},
+		{
+			name: "indicator intervals",
+			change: func(c *Config) {
+				c.Indicators.Enabled = true
+				c.Indicators.Intervals = []time.Duration{60, 7}
+				c.Indicators.Symbols = map[string][]time.Duration{"btcusdt": {300, 300}}
+			},
+			want: []string{
+				"indicators.intervals[1]: must be a positive number of seconds dividing a day, got 7",
+				"indicators.symbols.btcusdt[1]: duplicate interval of 300 seconds",
+			},
+		},
+		{
+			name:   "alerts without their secrets",
+			change: func(c *Config) { c.Alerts.Enabled = true },
+			want: []string{
+				"alerts.token: required, it authorizes the alert routes",
+				"alerts.webhook.secret: required, it signs every alert",
+			},
+		},
+		{
+			name: "alert webhook settings",
+			change: func(c *Config) {
+				c.Alerts.Enabled, c.Alerts.Token, c.Alerts.Webhook.Secret = true, "token", "secret"
+				c.Alerts.Cooldown = -1
+				c.Alerts.Webhook.AllowedHosts = []string{"hooks.example.com", "https://hooks.example.com"}
+				c.Alerts.Webhook.Timeout = 0
+			},
+			want: []string{
+				"alerts.cooldown: must not be negative",
+				`alerts.webhook.allowedHosts: must be host names, got "https://hooks.example.com"`,
+				"alerts.webhook.timeout: must be a positive number of seconds",
+			},
+		},
+		{
+			name: "candles without a transactional id",
+			change: func(c *Config) {
+				c.Candles.Enabled, c.Candles.Interval = true, 7
+				c.Kafka.TransactionalId = ""
+			},
+			want: []string{
+				"candles.interval: must be a positive number of seconds dividing a day, got 7",
+				"kafka.transactionalId: required when candles are enabled",
+			},
+		},
+		{
+			name: "disabled sections are not checked",
+			change: func(c *Config) {
+				c.Stats.Windows = nil
+				c.Alerts.Webhook.Secret = ""
+				c.Candles.Interval = 7
+				c.Kafka.TransactionalId = ""
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config := defaultConfig(t)
+			c.change(config)
+
+			err := config.Validate()
+			if len(c.want) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("got %v, want a *ValidationError", err)
+			}
+			var got []string
+			for _, err := range validationErr.Errors {
+				got = append(got, err.Error())
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got errors\n%q\nwant\n%q", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"path/filepath"
+	"time"
+)
+
+// reloadDebounce coalesces the bursts of events of a single edit, such as the symlink swap of a
+// Kubernetes ConfigMap update.
+const reloadDebounce = time.Second
+
+// Watch reads the configuration of loader again whenever its yml file or the keys of its config
+// server change, and passes the new configuration to onChange. Configurations that fail to load
+// or validate are passed as the error instead. Watch blocks until ctx is done.
+func Watch(ctx context.Context, loader *Loader, onChange func(*Config, error)) error {
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+
+	if loader.file != "" {
+		watcher, err := watchFile(loader.file, notify)
+		if err != nil {
+			return err
+		}
+		defer watcher.Close()
+	}
+
+	if loader.remote != nil {
+		go loader.remote.Watch(ctx, notify)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+
+		timer := time.NewTimer(reloadDebounce)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		// Events of the same edit that arrived while waiting are covered by this reload.
+		select {
+		case <-changed:
+		default:
+		}
+
+		cfg, err := loader.Load()
+		if err == nil {
+			err = cfg.Validate()
+		}
+		if err != nil {
+			onChange(nil, err)
+			continue
+		}
+		onChange(cfg, nil)
+	}
+}
+
+// watchFile calls notify when file is written or replaced, until the returned watcher is closed.
+// The directory is watched rather than the file, so that atomic saves and the symlink swap of a
+// Kubernetes ConfigMap update, which replace the file, are noticed as well.
+func watchFile(file string, notify func()) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	file = filepath.Clean(file)
+	if err = watcher.Add(filepath.Dir(file)); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	go func() {
+		target, _ := filepath.EvalSymlinks(file)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				current, _ := filepath.EvalSymlinks(file)
+				written := filepath.Clean(event.Name) == file && (event.Has(fsnotify.Write) || event.Has(fsnotify.Create))
+				if written || (current != "" && current != target) {
+					target = current
+					notify()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				fmt.Printf("Watching config file %s failed: %s\n", file, err)
+			}
+		}
+	}()
+	return watcher, nil
+}
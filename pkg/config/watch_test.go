@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("tickers: [btcusdt]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan struct{}, 16)
+	watcher, err := watchFile(file, func() { changes <- struct{}{} })
+	if err != nil {
+		t.Fatalf("watchFile: %v", err)
+	}
+
+	// Other files of the directory are ignored.
+	if err := os.WriteFile(filepath.Join(dir, "other.yaml"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// An atomic save replaces the file.
+	tmp := filepath.Join(dir, "config.yaml.tmp")
+	if err := os.WriteFile(tmp, []byte("tickers: [ethusdt]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported")
+	}
+
+	if err := watcher.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	for len(changes) > 0 {
+		<-changes
+	}
+	if err := os.WriteFile(file, []byte("tickers: [bnbusdt]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+		t.Fatal("change reported after the watcher was closed")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,331 @@
+package exchangetest
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const aggTradeSuffix = "@aggTrade"
+
+// Options controls the synthetic market generated by the fake exchange and the faults it injects.
+type Options struct {
+	// Seed makes the generated trades deterministic. Zero seeds from the current time.
+	Seed int64
+	// TradeInterval is the pause between trades on every subscribed stream.
+	TradeInterval time.Duration
+	// StartPrice is the first price of every symbol's random walk.
+	StartPrice float64
+	// Volatility is the maximum relative price move of a single trade.
+	Volatility float64
+	// BurstProbability is the chance that a tick emits BurstSize trades at once instead of one.
+	BurstProbability float64
+	BurstSize        int
+	// Latency delays every frame written to a client.
+	Latency time.Duration
+	// MalformedProbability is the chance that a trade frame is replaced by invalid JSON.
+	MalformedProbability float64
+	// DisconnectAfter closes a connection after that many trade frames. Zero never disconnects.
+	DisconnectAfter int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		TradeInterval: 100 * time.Millisecond,
+		StartPrice:    100,
+		Volatility:    0.001,
+		BurstSize:     10,
+	}
+}
+
+type request struct {
+	Id     int      `json:"id"`
+	Method string   `json:"method"`
+	Params []string `json:"params"`
+}
+
+type response struct {
+	Result interface{} `json:"result"`
+	Id     int         `json:"id"`
+}
+
+type aggTrade struct {
+	EventType    string `json:"e"`
+	EventTime    int64  `json:"E"`
+	Symbol       string `json:"s"`
+	AggTradeId   int64  `json:"a"`
+	Price        string `json:"p"`
+	Quantity     string `json:"q"`
+	FirstTradeId int64  `json:"f"`
+	LastTradeId  int64  `json:"l"`
+	Time         int64  `json:"T"`
+	BuyerMaker   bool   `json:"m"`
+	Ignore       bool   `json:"M"`
+}
+
+// Exchange is an http.Handler speaking the Binance WebSocket SUBSCRIBE/UNSUBSCRIBE protocol.
+type Exchange struct {
+	opts     Options
+	upgrader websocket.Upgrader
+
+	mu      sync.Mutex
+	rnd     *rand.Rand
+	prices  map[string]float64
+	tradeId int64
+	conns   map[*session]struct{}
+}
+
+func New(opts Options) *Exchange {
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if opts.TradeInterval <= 0 {
+		opts.TradeInterval = DefaultOptions().TradeInterval
+	}
+	if opts.StartPrice <= 0 {
+		opts.StartPrice = DefaultOptions().StartPrice
+	}
+
+	return &Exchange{
+		opts:   opts,
+		rnd:    rand.New(rand.NewSource(seed)),
+		prices: make(map[string]float64),
+		conns:  make(map[*session]struct{}),
+	}
+}
+
+func (e *Exchange) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := e.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	s := &session{exchange: e, conn: conn, streams: make(map[string]struct{}), done: make(chan struct{})}
+	e.mu.Lock()
+	e.conns[s] = struct{}{}
+	e.mu.Unlock()
+
+	go s.produce()
+	s.consume()
+}
+
+// Disconnect drops every open client connection without a close handshake.
+func (e *Exchange) Disconnect() {
+	e.mu.Lock()
+	conns := make([]*session, 0, len(e.conns))
+	for s := range e.conns {
+		conns = append(conns, s)
+	}
+	e.mu.Unlock()
+
+	for _, s := range conns {
+		s.close()
+	}
+}
+
+// SendRaw writes payload as a text frame to every open connection, e.g. to inject malformed frames.
+func (e *Exchange) SendRaw(payload []byte) {
+	e.mu.Lock()
+	conns := make([]*session, 0, len(e.conns))
+	for s := range e.conns {
+		conns = append(conns, s)
+	}
+	e.mu.Unlock()
+
+	for _, s := range conns {
+		_ = s.write(payload)
+	}
+}
+
+// Connections reports how many clients are currently connected.
+func (e *Exchange) Connections() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return len(e.conns)
+}
+
+func (e *Exchange) nextTrade(stream string) ([]byte, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.opts.MalformedProbability > 0 && e.rnd.Float64() < e.opts.MalformedProbability {
+		return []byte(`{"e":"aggTrade","s":`), true
+	}
+
+	symbol := strings.ToUpper(strings.TrimSuffix(stream, aggTradeSuffix))
+	price, ok := e.prices[symbol]
+	if !ok {
+		price = e.opts.StartPrice
+	}
+	price *= 1 + (e.rnd.Float64()*2-1)*e.opts.Volatility
+	e.prices[symbol] = price
+	e.tradeId++
+
+	now := time.Now().UnixMilli()
+	b, _ := json.Marshal(aggTrade{
+		EventType:    "aggTrade",
+		EventTime:    now,
+		Symbol:       symbol,
+		AggTradeId:   e.tradeId,
+		Price:        strconv.FormatFloat(price, 'f', 8, 64),
+		Quantity:     strconv.FormatFloat(e.rnd.Float64()*10, 'f', 8, 64),
+		FirstTradeId: e.tradeId,
+		LastTradeId:  e.tradeId,
+		Time:         now,
+		BuyerMaker:   e.rnd.Intn(2) == 0,
+		Ignore:       true,
+	})
+	return b, false
+}
+
+func (e *Exchange) burst() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.opts.BurstProbability > 0 && e.opts.BurstSize > 1 && e.rnd.Float64() < e.opts.BurstProbability {
+		return e.opts.BurstSize
+	}
+	return 1
+}
+
+func (e *Exchange) remove(s *session) {
+	e.mu.Lock()
+	delete(e.conns, s)
+	e.mu.Unlock()
+}
+
+type session struct {
+	exchange *Exchange
+	conn     *websocket.Conn
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	streams map[string]struct{}
+	sent    int
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (s *session) consume() {
+	defer s.close()
+
+	for {
+		_, payload, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var req request
+		if err := json.Unmarshal(payload, &req); err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		switch req.Method {
+		case "SUBSCRIBE":
+			for _, stream := range req.Params {
+				s.streams[stream] = struct{}{}
+			}
+		case "UNSUBSCRIBE":
+			for _, stream := range req.Params {
+				delete(s.streams, stream)
+			}
+		}
+		s.mu.Unlock()
+
+		b, _ := json.Marshal(response{Id: req.Id})
+		if err := s.write(b); err != nil {
+			return
+		}
+	}
+}
+
+func (s *session) produce() {
+	ticker := time.NewTicker(s.exchange.opts.TradeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		streams := make([]string, 0, len(s.streams))
+		for stream := range s.streams {
+			if strings.HasSuffix(stream, aggTradeSuffix) {
+				streams = append(streams, stream)
+			}
+		}
+		s.mu.Unlock()
+
+		for _, stream := range streams {
+			for i := s.exchange.burst(); i > 0; i-- {
+				payload, _ := s.exchange.nextTrade(stream)
+				if err := s.write(payload); err != nil {
+					s.close()
+					return
+				}
+
+				s.sent++
+				if s.exchange.opts.DisconnectAfter > 0 && s.sent >= s.exchange.opts.DisconnectAfter {
+					s.close()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *session) write(payload []byte) error {
+	if s.exchange.opts.Latency > 0 {
+		time.Sleep(s.exchange.opts.Latency)
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	return s.conn.WriteMessage(websocket.TextMessage, payload)
+}
+
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		_ = s.conn.Close()
+		s.exchange.remove(s)
+	})
+}
+
+// Server runs an Exchange on a local loopback port, in the spirit of httptest.Server.
+type Server struct {
+	*Exchange
+	http *httptest.Server
+}
+
+func NewServer(opts Options) *Server {
+	exchange := New(opts)
+	return &Server{
+		Exchange: exchange,
+		http:     httptest.NewServer(exchange),
+	}
+}
+
+// URL returns the WebSocket endpoint the listener should dial.
+func (s *Server) URL() string {
+	return "ws" + strings.TrimPrefix(s.http.URL, "http") + "/ws"
+}
+
+func (s *Server) Close() {
+	s.Disconnect()
+	s.http.Close()
+}
@@ -7,5 +7,9 @@ import (
 )
 
 func NewKafkaConn(ctx context.Context, cfg *config.Config) (*kafka.Conn, error) {
-	return kafka.DialContext(ctx, "tcp", cfg.Kafka.Brokers[0])
+	dialer, err := NewDialer(cfg.Kafka)
+	if err != nil {
+		return nil, err
+	}
+	return dialer.DialContext(ctx, "tcp", cfg.Kafka.Brokers[0])
 }
@@ -7,4 +7,10 @@ const (
 	writerWriteTimeout = 10 * time.Second
 	writerRequiredAcks = -1
 	writerMaxAttempts  = 3
+	dialTimeout        = 10 * time.Second
+
+	transactionTimeout   = 40 * time.Second
+	pipelineRetryBackoff = time.Second
+
+	errorRateWindow = 100
 )
@@ -0,0 +1,219 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/linkedin/goavro/v2"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"sync"
+)
+
+// ErrMalformedValue is returned for values that can never be decoded, unlike the failures to look
+// up their schema.
+var ErrMalformedValue = errors.New("malformed value")
+
+// Decodable is a Record the deserializers can fill in from the values of its schema fields, in
+// their order.
+type Decodable interface {
+	Record
+	SetValues(values []interface{}) error
+}
+
+// Deserializer decodes the message values written by the Serializer of the same format.
+type Deserializer interface {
+	Deserialize(ctx context.Context, value []byte, record Decodable) error
+}
+
+func NewDeserializer(cfg config.KafkaConfig) (Deserializer, error) {
+	switch cfg.Format {
+	case "", FormatJson:
+		return jsonDeserializer{}, nil
+	case FormatAvro:
+		return &avroDeserializer{registry: NewSchemaRegistry(cfg.SchemaRegistry), codecs: make(map[int]*goavro.Codec)}, nil
+	case FormatProtobuf:
+		return protobufDeserializer{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported message format %q", cfg.Format)
+	}
+}
+
+type jsonDeserializer struct{}
+
+func (jsonDeserializer) Deserialize(_ context.Context, value []byte, record Decodable) error {
+	if err := json.Unmarshal(value, record); err != nil {
+		return fmt.Errorf("%w: %s", ErrMalformedValue, err)
+	}
+	return nil
+}
+
+// avroDeserializer decodes a value with the schema it was written with, looked up by its id, and
+// takes the fields of the record by name. Fields the writer did not have get their default.
+type avroDeserializer struct {
+	registry *SchemaRegistry
+
+	mu     sync.Mutex
+	codecs map[int]*goavro.Codec
+}
+
+func (d *avroDeserializer) Deserialize(ctx context.Context, value []byte, record Decodable) error {
+	id, value, err := splitWirePrefix(value)
+	if err != nil {
+		return err
+	}
+	codec, err := d.codec(ctx, id)
+	if err != nil {
+		return err
+	}
+	native, _, err := codec.NativeFromBinary(value)
+	if err != nil {
+		return fmt.Errorf("%w: avro schema %d: %s", ErrMalformedValue, id, err)
+	}
+	written, ok := native.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%w: avro schema %d is not a record", ErrMalformedValue, id)
+	}
+
+	fields := record.Schema().Fields
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		if v, ok := written[field.Name]; ok {
+			values[i] = v
+		} else {
+			values[i] = field.zero()
+		}
+	}
+	return setValues(record, values)
+}
+
+func (d *avroDeserializer) codec(ctx context.Context, id int) (*goavro.Codec, error) {
+	d.mu.Lock()
+	codec, ok := d.codecs[id]
+	d.mu.Unlock()
+	if ok {
+		return codec, nil
+	}
+
+	schema, err := d.registry.Schema(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	codec, err = goavro.NewCodec(schema)
+	if err != nil {
+		return nil, fmt.Errorf("avro schema %d: %w", id, err)
+	}
+
+	d.mu.Lock()
+	d.codecs[id] = codec
+	d.mu.Unlock()
+	return codec, nil
+}
+
+// protobufDeserializer decodes the fields of a value by number, the position of the field in the
+// record schema. Unknown fields, written by a newer schema, are skipped.
+type protobufDeserializer struct{}
+
+func (protobufDeserializer) Deserialize(_ context.Context, value []byte, record Decodable) error {
+	_, value, err := splitWirePrefix(value)
+	if err != nil {
+		return err
+	}
+	if value, err = skipMessageIndexes(value); err != nil {
+		return err
+	}
+
+	fields := record.Schema().Fields
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		values[i] = field.zero()
+	}
+	for len(value) > 0 {
+		number, wireType, n := protowire.ConsumeTag(value)
+		if n < 0 {
+			return fmt.Errorf("%w: protobuf tag: %s", ErrMalformedValue, protowire.ParseError(n))
+		}
+		value = value[n:]
+
+		i := int(number) - 1
+		if i < 0 || i >= len(fields) {
+			n = protowire.ConsumeFieldValue(number, wireType, value)
+		} else {
+			values[i], n, err = consumeField(fields[i], wireType, value)
+			if err != nil {
+				return err
+			}
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: protobuf field %d: %s", ErrMalformedValue, number, protowire.ParseError(n))
+		}
+		value = value[n:]
+	}
+	return setValues(record, values)
+}
+
+func consumeField(field SchemaField, wireType protowire.Type, b []byte) (interface{}, int, error) {
+	switch {
+	case field.Type == FieldString && wireType == protowire.BytesType:
+		v, n := protowire.ConsumeString(b)
+		return v, n, nil
+	case field.Type == FieldLong && wireType == protowire.VarintType:
+		v, n := protowire.ConsumeVarint(b)
+		return int64(v), n, nil
+	case field.Type == FieldDouble && wireType == protowire.Fixed64Type:
+		v, n := protowire.ConsumeFixed64(b)
+		return math.Float64frombits(v), n, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: field %s: wire type %d does not match %s", ErrMalformedValue, field.Name, wireType, field.Type)
+	}
+}
+
+// skipMessageIndexes skips the zigzag encoded count and indexes of the message in its schema,
+// a single 0 for the first message.
+func skipMessageIndexes(b []byte) ([]byte, error) {
+	count, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return nil, fmt.Errorf("%w: protobuf message indexes: %s", ErrMalformedValue, protowire.ParseError(n))
+	}
+	b = b[n:]
+	for i := int64(0); i < protowire.DecodeZigZag(count); i++ {
+		if _, n = protowire.ConsumeVarint(b); n < 0 {
+			return nil, fmt.Errorf("%w: protobuf message indexes: %s", ErrMalformedValue, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return b, nil
+}
+
+func setValues(record Decodable, values []interface{}) error {
+	if err := record.SetValues(values); err != nil {
+		return fmt.Errorf("%w: %s", ErrMalformedValue, err)
+	}
+	return nil
+}
+
+// splitWirePrefix returns the schema id and the encoded value of the Confluent wire format.
+func splitWirePrefix(b []byte) (int, []byte, error) {
+	if len(b) < 5 || b[0] != wireMagicByte {
+		return 0, nil, fmt.Errorf("%w: not in the schema registry wire format", ErrMalformedValue)
+	}
+	return int(binary.BigEndian.Uint32(b[1:5])), b[5:], nil
+}
+
+// zero is the value of a field missing from a message: its default, or the zero of its type.
+func (f SchemaField) zero() interface{} {
+	if f.Default != nil {
+		return f.Default
+	}
+	switch f.Type {
+	case FieldLong:
+		return int64(0)
+	case FieldDouble:
+		return float64(0)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,159 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"google.golang.org/protobuf/encoding/protowire"
+	"net/http"
+	"testing"
+)
+
+func (r *testRecord) SetValues(values []interface{}) error {
+	symbol, symbolOk := values[0].(string)
+	at, timeOk := values[1].(int64)
+	price, priceOk := values[2].(float64)
+	if !symbolOk || !timeOk || !priceOk {
+		return fmt.Errorf("values %v do not match the schema", values)
+	}
+	r.Symbol, r.Time, r.Price = symbol, at, price
+	return nil
+}
+
+// oldRecord is written with the first version of a schema, before price was added.
+type oldRecord struct {
+	Symbol string
+	Time   int64
+}
+
+var oldSchema = &Schema{
+	Namespace: testSchema.Namespace,
+	Name:      testSchema.Name,
+	Version:   1,
+	Fields:    testSchema.Fields[:2],
+}
+
+func (r oldRecord) Schema() *Schema {
+	return oldSchema
+}
+
+func (r oldRecord) Values() []interface{} {
+	return []interface{}{r.Symbol, r.Time}
+}
+
+func newTestDeserializer(t *testing.T, format, url string) Deserializer {
+	t.Helper()
+	deserializer, err := NewDeserializer(config.KafkaConfig{
+		Format:         format,
+		SchemaRegistry: config.SchemaRegistryConfig{Url: url, Timeout: 5},
+	})
+	if err != nil {
+		t.Fatalf("NewDeserializer: %v", err)
+	}
+	return deserializer
+}
+
+func TestDeserializerReadsSerializedRecords(t *testing.T) {
+	for _, format := range []string{FormatJson, FormatAvro, FormatProtobuf} {
+		t.Run(format, func(t *testing.T) {
+			registry, server := newFakeRegistry(t)
+			serializer := newTestSerializer(t, format, server.URL)
+			deserializer := newTestDeserializer(t, format, server.URL)
+			ctx := context.Background()
+
+			b, err := serializer.Serialize(ctx, "trades-btcusdt", record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				var decoded testRecord
+				if err := deserializer.Deserialize(ctx, b, &decoded); err != nil {
+					t.Fatalf("Deserialize: %v", err)
+				}
+				if decoded != record {
+					t.Errorf("decoded %+v, want %+v", decoded, record)
+				}
+			}
+
+			// Avro looks the schema up once.
+			lookups := 0
+			for _, request := range registry.requests {
+				if request == http.MethodGet+" /schemas/ids/1" {
+					lookups++
+				}
+			}
+			if want := map[string]int{FormatAvro: 1}[format]; lookups != want {
+				t.Errorf("%d schema lookups, want %d", lookups, want)
+			}
+		})
+	}
+}
+
+// Values written before a field was added decode with the zero of the field.
+func TestDeserializerReadsOlderSchemas(t *testing.T) {
+	for _, format := range []string{FormatAvro, FormatProtobuf} {
+		t.Run(format, func(t *testing.T) {
+			_, server := newFakeRegistry(t)
+			ctx := context.Background()
+
+			b, err := newTestSerializer(t, format, server.URL).Serialize(ctx, "trades-btcusdt", oldRecord{Symbol: "BTCUSDT", Time: 1700000000123})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded testRecord
+			if err := newTestDeserializer(t, format, server.URL).Deserialize(ctx, b, &decoded); err != nil {
+				t.Fatalf("Deserialize: %v", err)
+			}
+			if want := (testRecord{Symbol: "BTCUSDT", Time: 1700000000123}); decoded != want {
+				t.Errorf("decoded %+v, want %+v", decoded, want)
+			}
+		})
+	}
+}
+
+// Protobuf fields of a newer schema are skipped.
+func TestProtobufDeserializerSkipsUnknownFields(t *testing.T) {
+	_, server := newFakeRegistry(t)
+	ctx := context.Background()
+	b, err := newTestSerializer(t, FormatProtobuf, server.URL).Serialize(ctx, "trades-btcusdt", record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = protowire.AppendTag(b, 9, protowire.BytesType)
+	b = protowire.AppendString(b, "added later")
+
+	var decoded testRecord
+	if err := newTestDeserializer(t, FormatProtobuf, "").Deserialize(ctx, b, &decoded); err != nil || decoded != record {
+		t.Errorf("decoded %+v, %v, want %+v", decoded, err, record)
+	}
+}
+
+func TestDeserializerErrors(t *testing.T) {
+	_, server := newFakeRegistry(t)
+	cases := []struct {
+		name      string
+		format    string
+		value     []byte
+		malformed bool
+	}{
+		{"json", FormatJson, []byte(`{"s":`), true},
+		{"json of another type", FormatJson, []byte(`{"s":1}`), true},
+		{"avro without the wire format", FormatAvro, []byte("BTCUSDT"), true},
+		{"avro of an unknown schema", FormatAvro, append(wirePrefix(42), 2), false},
+		{"protobuf truncated", FormatProtobuf, append(wirePrefix(1), 0, 0x0a, 5, 'B'), true},
+		{"protobuf of another wire type", FormatProtobuf, append(wirePrefix(1), 0, 0x08, 1), true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var decoded testRecord
+			err := newTestDeserializer(t, c.format, server.URL).Deserialize(context.Background(), c.value, &decoded)
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			if errors.Is(err, ErrMalformedValue) != c.malformed {
+				t.Errorf("error %v, want malformed %v", err, c.malformed)
+			}
+		})
+	}
+}
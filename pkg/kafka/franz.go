@@ -0,0 +1,122 @@
+package kafka
+
+import (
+	"fmt"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/segmentio/kafka-go"
+	"github.com/twmb/franz-go/pkg/kgo"
+	franzSasl "github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// franzOptions configures a franz-go client like NewTransport does kafka-go. Idempotent delivery
+// and the transactional pipelines go through franz-go, as kafka-go supports neither.
+func franzOptions(log logger.Logger, cfg config.KafkaConfig) ([]kgo.Opt, error) {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.DialTimeout(dialTimeout),
+		kgo.WithLogger(franzLogger{log: log}),
+		kgo.AllowAutoTopicCreation(),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+		kgo.ProducerBatchCompression(kgo.SnappyCompression()),
+		kgo.ProduceRequestTimeout(writerWriteTimeout),
+		// Idempotent records are retried without a limit by default, which blocks publishing
+		// while the brokers are unreachable instead of failing like kafka-go does.
+		kgo.RecordRetries(writerMaxAttempts),
+		kgo.RecordDeliveryTimeout(writerWriteTimeout),
+		kgo.RecordPartitioner(newPartitioner(cfg.Balancer)),
+	}
+
+	mechanism, err := newFranzSaslMechanism(cfg.Sasl)
+	if err != nil {
+		return nil, fmt.Errorf("kafka sasl: %w", err)
+	}
+	if mechanism != nil {
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+
+	tlsConfig, err := newTlsConfig(cfg.Tls)
+	if err != nil {
+		return nil, fmt.Errorf("kafka tls: %w", err)
+	}
+	if tlsConfig != nil {
+		opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+	}
+
+	return opts, nil
+}
+
+// newPartitioner matches newBalancer.
+func newPartitioner(name string) kgo.Partitioner {
+	if name == "least-bytes" {
+		return kgo.LeastBackupPartitioner()
+	}
+	return kgo.StickyKeyPartitioner(nil)
+}
+
+func newFranzSaslMechanism(cfg config.KafkaSaslConfig) (franzSasl.Mechanism, error) {
+	switch cfg.Mechanism {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Auth{User: cfg.Username, Pass: cfg.Password}.AsMechanism(), nil
+	case "scram-sha-256":
+		return scram.Auth{User: cfg.Username, Pass: cfg.Password}.AsSha256Mechanism(), nil
+	case "scram-sha-512":
+		return scram.Auth{User: cfg.Username, Pass: cfg.Password}.AsSha512Mechanism(), nil
+	default:
+		return nil, fmt.Errorf("unsupported mechanism %q", cfg.Mechanism)
+	}
+}
+
+// toRecord and fromRecord convert between the kafka-go messages used throughout the service and
+// franz-go records.
+func toRecord(message kafka.Message) *kgo.Record {
+	record := &kgo.Record{
+		Topic: message.Topic,
+		Key:   message.Key,
+		Value: message.Value,
+	}
+	for _, header := range message.Headers {
+		record.Headers = append(record.Headers, kgo.RecordHeader{Key: header.Key, Value: header.Value})
+	}
+	return record
+}
+
+func fromRecord(record *kgo.Record) kafka.Message {
+	message := kafka.Message{
+		Topic:     record.Topic,
+		Partition: int(record.Partition),
+		Offset:    record.Offset,
+		Key:       record.Key,
+		Value:     record.Value,
+		Time:      record.Timestamp,
+	}
+	for _, header := range record.Headers {
+		message.Headers = append(message.Headers, kafka.Header{Key: header.Key, Value: header.Value})
+	}
+	return message
+}
+
+// franzLogger passes the client logs to the kafka logger. Its info logs, about metadata and
+// connections, are logged at debug level, and its debug logs, about every request, left out.
+type franzLogger struct {
+	log logger.Logger
+}
+
+func (l franzLogger) Level() kgo.LogLevel {
+	return kgo.LogLevelInfo
+}
+
+func (l franzLogger) Log(level kgo.LogLevel, msg string, keyvals ...interface{}) {
+	switch level {
+	case kgo.LogLevelError:
+		l.log.Errorw(msg, keyvals...)
+	case kgo.LogLevelWarn:
+		l.log.Warnw(msg, keyvals...)
+	default:
+		l.log.Debugw(msg, keyvals...)
+	}
+}
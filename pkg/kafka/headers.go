@@ -0,0 +1,88 @@
+package kafka
+
+import (
+	"github.com/segmentio/kafka-go"
+	"strconv"
+	"time"
+)
+
+// Provenance headers, set on every published message next to the trace context, so consumers
+// can audit lineage and measure end-to-end latency without decoding values.
+const (
+	HeaderExchange      = "exchange"
+	HeaderStream        = "stream"
+	HeaderFormat        = "format"
+	HeaderSchemaVersion = "schema-version"
+	HeaderIngestHost    = "ingest-host"
+	HeaderIngestTime    = "ingest-timestamp"
+	HeaderConnectionId  = "connection-id"
+)
+
+// Provenance describes where a message comes from. IngestTime is written as unix milliseconds,
+// like Kafka timestamps. Empty values, such as the connection of derived messages or a zero
+// IngestTime, are left out.
+type Provenance struct {
+	Exchange      string
+	Stream        string
+	Format        string
+	SchemaVersion int
+	IngestHost    string
+	IngestTime    time.Time
+	ConnectionId  string
+}
+
+func (p Provenance) Headers() []kafka.Header {
+	var ingestTime string
+	if !p.IngestTime.IsZero() {
+		ingestTime = strconv.FormatInt(p.IngestTime.UnixMilli(), 10)
+	}
+
+	headers := make([]kafka.Header, 0, 7)
+	for _, header := range [][2]string{
+		{HeaderExchange, p.Exchange},
+		{HeaderStream, p.Stream},
+		{HeaderFormat, p.Format},
+		{HeaderSchemaVersion, strconv.Itoa(p.SchemaVersion)},
+		{HeaderIngestHost, p.IngestHost},
+		{HeaderIngestTime, ingestTime},
+		{HeaderConnectionId, p.ConnectionId},
+	} {
+		if header[1] != "" {
+			headers = append(headers, kafka.Header{Key: header[0], Value: []byte(header[1])})
+		}
+	}
+	return headers
+}
+
+// HeaderCarrier adapts Kafka message headers to the OpenTelemetry TextMapCarrier interface so
+// trace context can be injected into and extracted from messages.
+type HeaderCarrier struct {
+	Headers *[]kafka.Header
+}
+
+func (c HeaderCarrier) Get(key string) string {
+	for _, header := range *c.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (c HeaderCarrier) Set(key, value string) {
+	for i, header := range *c.Headers {
+		if header.Key == key {
+			(*c.Headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.Headers = append(*c.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.Headers))
+	for _, header := range *c.Headers {
+		keys = append(keys, header.Key)
+	}
+	return keys
+}
@@ -0,0 +1,48 @@
+package kafka
+
+import (
+	"github.com/segmentio/kafka-go"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProvenanceHeaders(t *testing.T) {
+	provenance := Provenance{
+		Exchange:      "binance",
+		Stream:        StreamTrades,
+		Format:        FormatAvro,
+		SchemaVersion: 1,
+		IngestHost:    "ingest-1",
+		IngestTime:    time.UnixMilli(1700000000123),
+		ConnectionId:  "0a1b2c3d4e5f6071",
+	}
+	want := []kafka.Header{
+		{Key: HeaderExchange, Value: []byte("binance")},
+		{Key: HeaderStream, Value: []byte("trades")},
+		{Key: HeaderFormat, Value: []byte("avro")},
+		{Key: HeaderSchemaVersion, Value: []byte("1")},
+		{Key: HeaderIngestHost, Value: []byte("ingest-1")},
+		{Key: HeaderIngestTime, Value: []byte("1700000000123")},
+		{Key: HeaderConnectionId, Value: []byte("0a1b2c3d4e5f6071")},
+	}
+	if got := provenance.Headers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Headers() = %v, want %v", got, want)
+	}
+}
+
+// Derived messages have no connection, and a message without an ingest time gets no header
+// rather than the unix milliseconds of the zero time.
+func TestProvenanceHeadersLeaveOutEmptyValues(t *testing.T) {
+	headers := Provenance{Exchange: "binance", Stream: StreamStats, Format: FormatJson, SchemaVersion: 1}.Headers()
+
+	carrier := HeaderCarrier{Headers: &headers}
+	for _, key := range []string{HeaderIngestHost, HeaderIngestTime, HeaderConnectionId} {
+		if value := carrier.Get(key); value != "" {
+			t.Errorf("header %s = %q, want it left out", key, value)
+		}
+	}
+	if len(headers) != 4 {
+		t.Errorf("got %d headers, want 4", len(headers))
+	}
+}
@@ -0,0 +1,123 @@
+package kafka
+
+import (
+	"context"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/segmentio/kafka-go"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel"
+	"sync"
+	"time"
+)
+
+// idempotentProducer publishes through a franz-go client with idempotent writes: the broker
+// drops retried batches it already appended, so retries never duplicate trades.
+type idempotentProducer struct {
+	log     logger.Logger
+	client  *kgo.Client
+	results *outcomeWindow
+
+	mu    sync.Mutex
+	stats kafka.WriterStats
+}
+
+func NewIdempotentProducer(log logger.Logger, cfg config.KafkaConfig) (*idempotentProducer, error) {
+	log = log.Named("kafka")
+	opts, err := franzOptions(log, cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &idempotentProducer{
+		log:     log,
+		client:  client,
+		results: newOutcomeWindow(errorRateWindow),
+	}, nil
+}
+
+func (p *idempotentProducer) PublishMessage(ctx context.Context, kafkaMessages ...kafka.Message) error {
+	records := make([]*kgo.Record, 0, len(kafkaMessages))
+	var size int64
+	for _, message := range kafkaMessages {
+		records = append(records, toRecord(message))
+		size += int64(len(message.Key) + len(message.Value))
+	}
+
+	start := time.Now()
+	results := p.client.ProduceSync(ctx, records...)
+	err := results.FirstErr()
+	p.results.record(err != nil)
+	p.record(len(records), size, time.Since(start), err)
+
+	for _, result := range results {
+		p.logDelivery(result.Record, result.Err)
+	}
+	return err
+}
+
+func (p *idempotentProducer) ErrorRate() float64 {
+	return p.results.rate()
+}
+
+// Stats returns the counters of kafka.WriterStats that apply to this client, reset on every call
+// like kafka.Writer.Stats.
+func (p *idempotentProducer) Stats() kafka.WriterStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	if stats.Writes > 0 {
+		stats.WriteTime.Avg = stats.WriteTime.Sum / time.Duration(stats.Writes)
+	}
+	p.stats = kafka.WriterStats{}
+	return stats
+}
+
+// Close flushes buffered records before closing the client.
+func (p *idempotentProducer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), writerWriteTimeout)
+	defer cancel()
+	err := p.client.Flush(ctx)
+	p.client.Close()
+	return err
+}
+
+func (p *idempotentProducer) record(messages int, size int64, took time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stats.Writes++
+	p.stats.Messages += int64(messages)
+	p.stats.Bytes += size
+	p.stats.WriteTime.Sum += took
+	if took > p.stats.WriteTime.Max {
+		p.stats.WriteTime.Max = took
+	}
+	if err != nil {
+		p.stats.Errors++
+	}
+}
+
+func (p *idempotentProducer) logDelivery(record *kgo.Record, err error) {
+	message := fromRecord(record)
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), HeaderCarrier{Headers: &message.Headers})
+	if err != nil {
+		p.log.ErrorCtx(ctx, "Message delivery failed",
+			logger.FieldTopic, message.Topic,
+			"key", string(message.Key),
+			logger.FieldError, err,
+		)
+		return
+	}
+	p.log.DebugCtx(ctx, "Message delivered",
+		logger.FieldTopic, message.Topic,
+		"key", string(message.Key),
+		"partition", message.Partition,
+		logger.FieldOffset, message.Offset,
+	)
+}
@@ -0,0 +1,228 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/segmentio/kafka-go"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"sync"
+	"time"
+)
+
+// Processor transforms the messages of a pipeline. Its state must follow from the messages it
+// processed alone, so that it can be rolled back when a transaction aborts and rebuilt by
+// consuming again after a restart.
+type Processor interface {
+	// Process returns the messages to produce for a consumed message.
+	Process(ctx context.Context, message kafka.Message) ([]kafka.Message, error)
+	// Snapshot returns a copy of the state, which Restore puts back when a transaction aborts.
+	Snapshot() interface{}
+	Restore(snapshot interface{})
+	// Resume returns the offset of a partition to commit instead of next, the offset after the
+	// last processed message: the first message whose results are not produced yet, from which
+	// consuming again rebuilds the state.
+	Resume(topic string, partition int32, next int64) int64
+	// Reset drops the state of a partition, whose offset the group is about to fetch again.
+	Reset(topic string, partition int32)
+}
+
+// transactSession is the part of kgo.GroupTransactSession a pipeline uses.
+type transactSession interface {
+	PollFetches(ctx context.Context) kgo.Fetches
+	Begin() error
+	ProduceSync(ctx context.Context, records ...*kgo.Record) kgo.ProduceResults
+	End(ctx context.Context, commit kgo.TransactionEndTry) (bool, error)
+	Close()
+}
+
+// Pipeline consumes topics, transforms their messages and produces the results. Every batch is a
+// transaction that also commits the consumed offsets, so its results are produced exactly once:
+// an aborted batch is consumed again, from the state before it.
+type Pipeline struct {
+	log       logger.Logger
+	name      string
+	session   transactSession
+	processor Processor
+	// retryBackoff is the wait before a batch that failed is consumed again.
+	retryBackoff time.Duration
+	done         chan struct{}
+
+	mu     sync.Mutex
+	resets map[string][]int32
+}
+
+// NewPipeline consumes the topics matching topicPattern in the consumer group and with the
+// transactional id of the configured ones, suffixed by name.
+func NewPipeline(log logger.Logger, cfg config.KafkaConfig, name, topicPattern string, processor Processor) (*Pipeline, error) {
+	log = log.Named("kafka")
+	p := &Pipeline{
+		log:          log,
+		name:         name,
+		processor:    processor,
+		retryBackoff: pipelineRetryBackoff,
+		done:         make(chan struct{}),
+		resets:       make(map[string][]int32),
+	}
+
+	opts, err := franzOptions(log, cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts,
+		kgo.TransactionalID(cfg.TransactionalId+"-"+name),
+		kgo.TransactionTimeout(transactionTimeout),
+		kgo.ConsumerGroup(cfg.GroupID+"-"+name),
+		kgo.ConsumeRegex(),
+		kgo.ConsumeTopics(topicPattern),
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+		kgo.RequireStableFetchOffsets(),
+		// Assigned partitions start from the committed offsets; revoked ones are no longer ours.
+		kgo.OnPartitionsAssigned(p.reset),
+		kgo.OnPartitionsRevoked(p.reset),
+		kgo.OnPartitionsLost(p.reset),
+	)
+	session, err := kgo.NewGroupTransactSession(opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.session = session
+	return p, nil
+}
+
+// Run processes batches until ctx is done. A batch that fails to process or produce is aborted
+// and consumed again after retryBackoff.
+func (p *Pipeline) Run(ctx context.Context) error {
+	defer close(p.done)
+
+	for {
+		fetches := p.session.PollFetches(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if fetches.IsClientClosed() {
+			return errors.New("pipeline client closed")
+		}
+		fetches.EachError(func(topic string, partition int32, err error) {
+			p.log.Warnw("Pipeline fetch failed", "pipeline", p.name, "topic", topic, "partition", partition, "error", err)
+		})
+		p.applyResets()
+		if fetches.NumRecords() == 0 {
+			continue
+		}
+
+		committed, processErr, err := p.transact(ctx, fetches)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("pipeline %s: %w", p.name, err)
+		}
+		if committed {
+			continue
+		}
+		if processErr == nil {
+			p.log.Infow("Pipeline transaction aborted by a rebalance", "pipeline", p.name)
+			continue
+		}
+
+		p.log.Warnw("Pipeline transaction aborted, retrying", "pipeline", p.name, "error", processErr)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(p.retryBackoff):
+		}
+	}
+}
+
+// transact processes a batch in a transaction. When it is not committed the session consumes the
+// batch again and the processor is rolled back to the state before it.
+func (p *Pipeline) transact(ctx context.Context, fetches kgo.Fetches) (committed bool, processErr, err error) {
+	snapshot := p.processor.Snapshot()
+	if err := p.session.Begin(); err != nil {
+		return false, nil, fmt.Errorf("begin transaction: %w", err)
+	}
+
+	processErr = p.process(ctx, fetches)
+	end := kgo.TryCommit
+	if processErr != nil {
+		end = kgo.TryAbort
+	}
+	// Cancelling End leaves the transaction undecided, so shutdown waits for it.
+	committed, err = p.session.End(kgo.PreTxnCommitFnContext(context.WithoutCancel(ctx), p.resumeOffsets), end)
+	if !committed {
+		p.processor.Restore(snapshot)
+	}
+	if err != nil {
+		return false, processErr, fmt.Errorf("end transaction: %w", err)
+	}
+	return committed, processErr, nil
+}
+
+func (p *Pipeline) process(ctx context.Context, fetches kgo.Fetches) error {
+	var records []*kgo.Record
+	for iter := fetches.RecordIter(); !iter.Done(); {
+		messages, err := p.processor.Process(ctx, fromRecord(iter.Next()))
+		if err != nil {
+			return err
+		}
+		for _, message := range messages {
+			records = append(records, toRecord(message))
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return p.session.ProduceSync(ctx, records...).FirstErr()
+}
+
+// resumeOffsets commits the offsets the processor resumes from rather than those after the
+// consumed messages, so a restart rebuilds the state whose results were not produced yet. The
+// session keeps consuming after the consumed messages.
+func (p *Pipeline) resumeOffsets(req *kmsg.TxnOffsetCommitRequest) error {
+	for i := range req.Topics {
+		topic := &req.Topics[i]
+		for j := range topic.Partitions {
+			partition := &topic.Partitions[j]
+			partition.Offset = p.processor.Resume(topic.Topic, partition.Partition, partition.Offset)
+		}
+	}
+	return nil
+}
+
+// reset is called by the group while it rebalances; the state of the partitions is dropped before
+// the next batch is processed.
+func (p *Pipeline) reset(_ context.Context, _ *kgo.Client, partitions map[string][]int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for topic, numbers := range partitions {
+		p.resets[topic] = append(p.resets[topic], numbers...)
+	}
+}
+
+func (p *Pipeline) applyResets() {
+	p.mu.Lock()
+	resets := p.resets
+	p.resets = make(map[string][]int32)
+	p.mu.Unlock()
+
+	for topic, partitions := range resets {
+		for _, partition := range partitions {
+			p.processor.Reset(topic, partition)
+		}
+	}
+}
+
+// Close waits for Run to end its transaction, then leaves the group.
+func (p *Pipeline) Close(ctx context.Context) error {
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+	}
+	p.session.Close()
+	return nil
+}
@@ -0,0 +1,301 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"github.com/segmentio/kafka-go"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const pipelineTopic = "numbers"
+
+var errProduce = errors.New("produce failed")
+
+// fakeBroker keeps what survives the sessions of a test: the input partitions, the committed
+// output and the committed offsets of the group.
+type fakeBroker struct {
+	input     [][]int
+	output    []string
+	committed map[int32]int64
+}
+
+func newFakeBroker(partitions ...[]int) *fakeBroker {
+	return &fakeBroker{input: partitions, committed: make(map[int32]int64)}
+}
+
+// fakeSession is a transactional session over a fakeBroker, polling batch records of every
+// partition at a time. Like kgo.GroupTransactSession it rewinds to the offsets it committed last
+// when a transaction aborts. produceFailures and abortEnds fail the next produce calls and
+// commits; after stopAfter transactions the session stops consuming, as if the process ended.
+type fakeSession struct {
+	t         *testing.T
+	broker    *fakeBroker
+	batch     int
+	preCommit func(*kmsg.TxnOffsetCommitRequest) error
+	stop      context.CancelFunc
+
+	position  map[int32]int64
+	committed map[int32]int64
+	buffer    []string
+	inTxn     bool
+
+	produceFailures int
+	abortEnds       int
+	stopAfter       int
+	transactions    int
+}
+
+// newFakeSession joins the group, starting from its committed offsets.
+func newFakeSession(t *testing.T, broker *fakeBroker, batch int) *fakeSession {
+	s := &fakeSession{t: t, broker: broker, batch: batch, position: make(map[int32]int64), committed: make(map[int32]int64), stopAfter: -1}
+	for partition, offset := range broker.committed {
+		s.position[partition], s.committed[partition] = offset, offset
+	}
+	return s
+}
+
+func (s *fakeSession) PollFetches(context.Context) kgo.Fetches {
+	var partitions []kgo.FetchPartition
+	for i, input := range s.broker.input {
+		partition := int32(i)
+		var records []*kgo.Record
+		for offset := s.position[partition]; offset < int64(len(input)) && len(records) < s.batch; offset++ {
+			records = append(records, &kgo.Record{Topic: pipelineTopic, Partition: partition, Offset: offset, Value: []byte(strconv.Itoa(input[offset]))})
+		}
+		if len(records) > 0 {
+			s.position[partition] += int64(len(records))
+			partitions = append(partitions, kgo.FetchPartition{Partition: partition, Records: records})
+		}
+	}
+	if len(partitions) == 0 || s.transactions == s.stopAfter {
+		s.stop()
+		return nil
+	}
+	return kgo.Fetches{{Topics: []kgo.FetchTopic{{Topic: pipelineTopic, Partitions: partitions}}}}
+}
+
+func (s *fakeSession) Begin() error {
+	if s.inTxn {
+		s.t.Fatal("Begin within a transaction")
+	}
+	s.inTxn, s.buffer = true, nil
+	return nil
+}
+
+func (s *fakeSession) ProduceSync(_ context.Context, records ...*kgo.Record) kgo.ProduceResults {
+	results := make(kgo.ProduceResults, 0, len(records))
+	if s.produceFailures > 0 {
+		s.produceFailures--
+		for _, record := range records {
+			results = append(results, kgo.ProduceResult{Record: record, Err: errProduce})
+		}
+		return results
+	}
+	for _, record := range records {
+		s.buffer = append(s.buffer, string(record.Key)+":"+string(record.Value))
+		results = append(results, kgo.ProduceResult{Record: record})
+	}
+	return results
+}
+
+func (s *fakeSession) End(_ context.Context, commit kgo.TransactionEndTry) (bool, error) {
+	s.inTxn = false
+	s.transactions++
+	if commit == kgo.TryAbort || s.abortEnds > 0 {
+		if commit == kgo.TryCommit {
+			s.abortEnds--
+		}
+		for partition, offset := range s.committed {
+			s.position[partition] = offset
+		}
+		for partition := range s.position {
+			if _, ok := s.committed[partition]; !ok {
+				delete(s.position, partition)
+			}
+		}
+		return false, nil
+	}
+
+	req := kmsg.NewPtrTxnOffsetCommitRequest()
+	topic := kmsg.NewTxnOffsetCommitRequestTopic()
+	topic.Topic = pipelineTopic
+	for partition, offset := range s.position {
+		if offset != s.committed[partition] {
+			p := kmsg.NewTxnOffsetCommitRequestTopicPartition()
+			p.Partition, p.Offset = partition, offset
+			topic.Partitions = append(topic.Partitions, p)
+		}
+	}
+	req.Topics = append(req.Topics, topic)
+	if err := s.preCommit(req); err != nil {
+		return false, err
+	}
+
+	s.broker.output = append(s.broker.output, s.buffer...)
+	for _, p := range req.Topics[0].Partitions {
+		s.broker.committed[p.Partition] = p.Offset
+		s.committed[p.Partition] = s.position[p.Partition]
+	}
+	return true, nil
+}
+
+func (s *fakeSession) Close() {}
+
+// windowSums sums every window of size numbers of a partition, publishing the sum keyed by the
+// partition once the window is full.
+type windowSums struct {
+	size int
+	open map[int32]*window
+}
+
+type window struct {
+	first int64
+	count int
+	sum   int
+}
+
+func newWindowSums(size int) *windowSums {
+	return &windowSums{size: size, open: make(map[int32]*window)}
+}
+
+func (w *windowSums) Process(_ context.Context, message kafka.Message) ([]kafka.Message, error) {
+	n, err := strconv.Atoi(string(message.Value))
+	if err != nil {
+		return nil, err
+	}
+	partition := int32(message.Partition)
+	open, ok := w.open[partition]
+	if !ok {
+		open = &window{first: message.Offset}
+		w.open[partition] = open
+	}
+	open.count++
+	open.sum += n
+	if open.count < w.size {
+		return nil, nil
+	}
+	delete(w.open, partition)
+	return []kafka.Message{{Topic: "sums", Key: []byte(strconv.Itoa(int(partition))), Value: []byte(strconv.Itoa(open.sum))}}, nil
+}
+
+func (w *windowSums) Snapshot() interface{} {
+	open := make(map[int32]*window, len(w.open))
+	for partition, state := range w.open {
+		copied := *state
+		open[partition] = &copied
+	}
+	return open
+}
+
+func (w *windowSums) Restore(snapshot interface{}) {
+	w.open = snapshot.(map[int32]*window)
+}
+
+func (w *windowSums) Resume(_ string, partition int32, next int64) int64 {
+	if open, ok := w.open[partition]; ok {
+		return open.first
+	}
+	return next
+}
+
+func (w *windowSums) Reset(_ string, partition int32) {
+	delete(w.open, partition)
+}
+
+// runPipeline runs a pipeline of a new windowSums over session until the session stops.
+func runPipeline(t *testing.T, session *fakeSession) {
+	t.Helper()
+	cfg := &config.Config{Logger: config.LoggerConfig{Level: "error", Encoding: "json"}}
+	log := logger.NewLogger(cfg)
+	log.InitLogger()
+
+	processor := newWindowSums(3)
+	p := &Pipeline{
+		log:          log,
+		name:         "sums",
+		session:      session,
+		processor:    processor,
+		retryBackoff: time.Millisecond,
+		done:         make(chan struct{}),
+		resets:       make(map[string][]int32),
+	}
+	session.preCommit = p.resumeOffsets
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	session.stop = cancel
+	if err := p.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func numbers(from, to int) []int {
+	var all []int
+	for n := from; n < to; n++ {
+		all = append(all, n)
+	}
+	return all
+}
+
+func TestPipelineProducesExactlyOnce(t *testing.T) {
+	input := [][]int{numbers(0, 20), numbers(100, 113)}
+	clean := newFakeBroker(input...)
+	runPipeline(t, newFakeSession(t, clean, 2))
+	if len(clean.output) != 6+4 {
+		t.Fatalf("clean run produced %v, want 10 sums", clean.output)
+	}
+
+	cases := []struct {
+		name  string
+		setup func(*fakeSession)
+	}{
+		{"produce failures", func(s *fakeSession) { s.produceFailures = 2 }},
+		{"aborted commits", func(s *fakeSession) { s.abortEnds = 3 }},
+		{"both", func(s *fakeSession) { s.produceFailures, s.abortEnds = 1, 2 }},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			broker := newFakeBroker(input...)
+			session := newFakeSession(t, broker, 2)
+			c.setup(session)
+			runPipeline(t, session)
+			if !reflect.DeepEqual(broker.output, clean.output) {
+				t.Errorf("produced %v, want %v", broker.output, clean.output)
+			}
+		})
+	}
+}
+
+// A restart consumes again from the committed offsets with a new processor, rebuilding the
+// windows that were open, and produces every sum once.
+func TestPipelineRestartsFromTheOpenWindows(t *testing.T) {
+	input := [][]int{numbers(0, 20), numbers(100, 113)}
+	clean := newFakeBroker(input...)
+	runPipeline(t, newFakeSession(t, clean, 2))
+
+	for stopAfter := 1; stopAfter < 10; stopAfter++ {
+		t.Run(fmt.Sprintf("after %d transactions", stopAfter), func(t *testing.T) {
+			broker := newFakeBroker(input...)
+			first := newFakeSession(t, broker, 2)
+			first.stopAfter = stopAfter
+			first.abortEnds = 1
+			runPipeline(t, first)
+
+			runPipeline(t, newFakeSession(t, broker, 2))
+			if !reflect.DeepEqual(broker.output, clean.output) {
+				t.Errorf("produced %v, want %v", broker.output, clean.output)
+			}
+		})
+	}
+}
@@ -2,12 +2,18 @@ package kafka
 
 import (
 	"context"
+	"github.com/sefikcan/read-time-trade/pkg/config"
 	"github.com/sefikcan/read-time-trade/pkg/logger"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
 )
 
 type Producer interface {
 	PublishMessage(ctx context.Context, kafkaMessages ...kafka.Message) error
+	// ErrorRate returns the share of failed publishes among the most recent ones.
+	ErrorRate() float64
+	// Stats returns the writer statistics accumulated since the previous call.
+	Stats() kafka.WriterStats
 	Close() error
 }
 
@@ -15,20 +21,63 @@ type producer struct {
 	log     logger.Logger
 	brokers []string
 	w       *kafka.Writer
+	results *outcomeWindow
 }
 
-func NewProducer(log logger.Logger, brokers []string) *producer {
-	return &producer{
+func NewProducer(log logger.Logger, cfg config.KafkaConfig) (*producer, error) {
+	log = log.Named("kafka")
+	w, err := NewWriter(cfg, kafka.LoggerFunc(log.Errorf))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &producer{
 		log:     log,
-		brokers: brokers,
-		w:       NewWriter(brokers, kafka.LoggerFunc(log.Errorf)),
+		brokers: cfg.Brokers,
+		w:       w,
+		results: newOutcomeWindow(errorRateWindow),
 	}
+	p.w.Completion = p.logDelivery
+	return p, nil
 }
 
 func (p *producer) PublishMessage(ctx context.Context, kafkaMessages ...kafka.Message) error {
-	return p.w.WriteMessages(ctx, kafkaMessages...)
+	err := p.w.WriteMessages(ctx, kafkaMessages...)
+	p.results.record(err != nil)
+	return err
+}
+
+func (p *producer) ErrorRate() float64 {
+	return p.results.rate()
+}
+
+func (p *producer) Stats() kafka.WriterStats {
+	return p.w.Stats()
 }
 
 func (p *producer) Close() error {
 	return p.w.Close()
 }
+
+// logDelivery logs the partition and offset every message was written to, or the failure, in the
+// trace of the message carried by its headers.
+func (p *producer) logDelivery(messages []kafka.Message, err error) {
+	for i := range messages {
+		message := &messages[i]
+		ctx := otel.GetTextMapPropagator().Extract(context.Background(), HeaderCarrier{Headers: &message.Headers})
+		if err != nil {
+			p.log.ErrorCtx(ctx, "Message delivery failed",
+				logger.FieldTopic, message.Topic,
+				"key", string(message.Key),
+				logger.FieldError, err,
+			)
+			continue
+		}
+		p.log.DebugCtx(ctx, "Message delivered",
+			logger.FieldTopic, message.Topic,
+			"key", string(message.Key),
+			"partition", message.Partition,
+			logger.FieldOffset, message.Offset,
+		)
+	}
+}
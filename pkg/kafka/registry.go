@@ -0,0 +1,204 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	schemaTypeAvro     = "AVRO"
+	schemaTypeProtobuf = "PROTOBUF"
+
+	registryContentType = "application/vnd.schemaregistry.v1+json"
+)
+
+// ErrIncompatibleSchema is returned when the registry rejects a schema that breaks the
+// compatibility level of its subject.
+var ErrIncompatibleSchema = errors.New("schema incompatible with the registered versions")
+
+// SchemaRegistry is a client of the Confluent schema registry API. Registered schemas are cached
+// per subject and schema, so only the first message of a schema reaches the registry.
+type SchemaRegistry struct {
+	url           string
+	username      string
+	password      string
+	compatibility string
+	client        *http.Client
+
+	mu      sync.Mutex
+	ids     map[registeredSchema]int
+	schemas map[int]string
+}
+
+type registeredSchema struct {
+	subject    string
+	schemaType string
+	schema     string
+}
+
+func NewSchemaRegistry(cfg config.SchemaRegistryConfig) *SchemaRegistry {
+	return &SchemaRegistry{
+		url:           strings.TrimRight(cfg.Url, "/"),
+		username:      cfg.Username,
+		password:      cfg.Password,
+		compatibility: cfg.Compatibility,
+		client:        &http.Client{Timeout: cfg.Timeout * time.Second},
+		ids:           make(map[registeredSchema]int),
+		schemas:       make(map[int]string),
+	}
+}
+
+type registrySchema struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+// Register returns the id of schema under subject, registering it when needed. When a
+// compatibility level is configured it is set on the subject and the schema is checked against
+// the latest version first, so an incompatible change fails with ErrIncompatibleSchema.
+//
+// The registry is called without holding the cache, so a slow registry never blocks the subjects
+// already registered. Concurrent first registrations of a schema may all reach the registry,
+// which returns the same id for all of them.
+func (r *SchemaRegistry) Register(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	key := registeredSchema{subject: subject, schemaType: schemaType, schema: schema}
+	r.mu.Lock()
+	id, ok := r.ids[key]
+	r.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	request := registrySchema{Schema: schema}
+	// AVRO is the registry default and not understood by registries before 5.5.
+	if schemaType != schemaTypeAvro {
+		request.SchemaType = schemaType
+	}
+
+	if r.compatibility != "" {
+		body := map[string]string{"compatibility": r.compatibility}
+		if err := r.do(ctx, http.MethodPut, "/config/"+url.PathEscape(subject), body, nil); err != nil {
+			return 0, fmt.Errorf("set compatibility of %s: %w", subject, err)
+		}
+
+		var check struct {
+			IsCompatible bool `json:"is_compatible"`
+		}
+		err := r.do(ctx, http.MethodPost, "/compatibility/subjects/"+url.PathEscape(subject)+"/versions/latest", request, &check)
+		var status *registryError
+		switch {
+		case errors.As(err, &status) && status.notFound():
+			// The first version of the subject.
+		case err != nil:
+			return 0, fmt.Errorf("check compatibility of %s: %w", subject, err)
+		case !check.IsCompatible:
+			return 0, fmt.Errorf("subject %s: %w", subject, ErrIncompatibleSchema)
+		}
+	}
+
+	var registered struct {
+		Id int `json:"id"`
+	}
+	if err := r.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", request, &registered); err != nil {
+		var status *registryError
+		if errors.As(err, &status) && status.StatusCode == http.StatusConflict {
+			return 0, fmt.Errorf("subject %s: %w", subject, ErrIncompatibleSchema)
+		}
+		return 0, fmt.Errorf("register schema of %s: %w", subject, err)
+	}
+
+	r.mu.Lock()
+	r.ids[key] = registered.Id
+	r.mu.Unlock()
+	return registered.Id, nil
+}
+
+// Schema returns the schema registered with id, as deserializers need the schema a value was
+// written with. Schemas never change, so every id is fetched once.
+func (r *SchemaRegistry) Schema(ctx context.Context, id int) (string, error) {
+	r.mu.Lock()
+	schema, ok := r.schemas[id]
+	r.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	var registered registrySchema
+	if err := r.do(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &registered); err != nil {
+		return "", fmt.Errorf("get schema %d: %w", id, err)
+	}
+
+	r.mu.Lock()
+	r.schemas[id] = registered.Schema
+	r.mu.Unlock()
+	return registered.Schema, nil
+}
+
+type registryError struct {
+	StatusCode int
+	ErrorCode  int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (e *registryError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("schema registry responded %d", e.StatusCode)
+	}
+	return fmt.Sprintf("schema registry responded %d: %s", e.StatusCode, e.Message)
+}
+
+// notFound reports a missing subject or version, error codes 40401 and 40402.
+func (e *registryError) notFound() bool {
+	return e.StatusCode == http.StatusNotFound
+}
+
+func (r *SchemaRegistry) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var content io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.url+path, content)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", registryContentType)
+	}
+	req.Header.Set("Accept", registryContentType)
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		failure := &registryError{StatusCode: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(failure)
+		return failure
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
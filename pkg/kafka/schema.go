@@ -0,0 +1,106 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type FieldType string
+
+const (
+	FieldString FieldType = "string"
+	FieldLong   FieldType = "long"
+	FieldDouble FieldType = "double"
+)
+
+// Schema describes a flat record once, so the Avro and Protobuf schemas registered for it always
+// agree. Fields are only ever appended: their position is the Protobuf field number. Version is
+// raised with every change and sent in the schema-version header, whatever the format.
+type Schema struct {
+	Namespace string
+	Name      string
+	Version   int
+	Fields    []SchemaField
+}
+
+type SchemaField struct {
+	Name string
+	Type FieldType
+	// Default is the Avro default of a field added after the first version, which keeps the
+	// schema backward compatible. Nil for fields every version has.
+	Default interface{}
+}
+
+// Record is a message value the serializers can encode. JSON uses the value itself, Avro and
+// Protobuf its Values, in the order of the schema fields.
+type Record interface {
+	Schema() *Schema
+	Values() []interface{}
+}
+
+// Avro returns the schema as Avro record JSON.
+func (s *Schema) Avro() (string, error) {
+	type avroField struct {
+		Name string    `json:"name"`
+		Type FieldType `json:"type"`
+		// Default is marshalled ahead, so that zero defaults such as 0 or "" are kept too.
+		Default json.RawMessage `json:"default,omitempty"`
+	}
+	type avroRecord struct {
+		Type      string      `json:"type"`
+		Name      string      `json:"name"`
+		Namespace string      `json:"namespace,omitempty"`
+		Fields    []avroField `json:"fields"`
+	}
+
+	record := avroRecord{Type: "record", Name: s.Name, Namespace: s.Namespace}
+	for _, field := range s.Fields {
+		f := avroField{Name: field.Name, Type: field.Type}
+		if field.Default != nil {
+			b, err := json.Marshal(field.Default)
+			if err != nil {
+				return "", fmt.Errorf("field %s: %w", field.Name, err)
+			}
+			f.Default = b
+		}
+		record.Fields = append(record.Fields, f)
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Proto returns the schema as a proto3 file with a single message.
+func (s *Schema) Proto() (string, error) {
+	var b strings.Builder
+	b.WriteString("syntax = \"proto3\";\n")
+	if s.Namespace != "" {
+		fmt.Fprintf(&b, "package %s;\n", s.Namespace)
+	}
+	fmt.Fprintf(&b, "\nmessage %s {\n", s.Name)
+	for i, field := range s.Fields {
+		protoType, err := field.Type.proto()
+		if err != nil {
+			return "", fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		fmt.Fprintf(&b, "  %s %s = %d;\n", protoType, field.Name, i+1)
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+func (t FieldType) proto() (string, error) {
+	switch t {
+	case FieldString:
+		return "string", nil
+	case FieldLong:
+		return "int64", nil
+	case FieldDouble:
+		return "double", nil
+	default:
+		return "", fmt.Errorf("unsupported type %q", t)
+	}
+}
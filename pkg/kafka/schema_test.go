@@ -0,0 +1,38 @@
+package kafka
+
+import (
+	"github.com/linkedin/goavro/v2"
+	"testing"
+)
+
+// Zero defaults are defaults all the same: readers fill the field of older records with them.
+func TestSchemaAvroDefaults(t *testing.T) {
+	schema := &Schema{
+		Name:    "Trade",
+		Version: 2,
+		Fields: []SchemaField{
+			{Name: "symbol", Type: FieldString},
+			{Name: "venue", Type: FieldString, Default: ""},
+			{Name: "tradeCount", Type: FieldLong, Default: 0},
+			{Name: "fee", Type: FieldDouble, Default: 0.0},
+			{Name: "price", Type: FieldDouble, Default: 1.5},
+		},
+	}
+	text, err := schema.Avro()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"record","name":"Trade","fields":[` +
+		`{"name":"symbol","type":"string"},` +
+		`{"name":"venue","type":"string","default":""},` +
+		`{"name":"tradeCount","type":"long","default":0},` +
+		`{"name":"fee","type":"double","default":0},` +
+		`{"name":"price","type":"double","default":1.5}]}`
+	if text != want {
+		t.Fatalf("got\n%s\nwant\n%s", text, want)
+	}
+
+	if _, err = goavro.NewCodec(text); err != nil {
+		t.Errorf("invalid avro schema: %v", err)
+	}
+}
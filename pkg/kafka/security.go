@@ -0,0 +1,109 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"os"
+)
+
+// NewTransport builds the transport writers use to reach the brokers, authenticated and
+// encrypted as configured.
+func NewTransport(cfg config.KafkaConfig) (*kafka.Transport, error) {
+	mechanism, tlsConfig, err := security(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Transport{
+		DialTimeout: dialTimeout,
+		SASL:        mechanism,
+		TLS:         tlsConfig,
+	}, nil
+}
+
+// NewDialer builds the dialer for direct broker connections, such as the health check and
+// consumers, with the same security settings as NewTransport.
+func NewDialer(cfg config.KafkaConfig) (*kafka.Dialer, error) {
+	mechanism, tlsConfig, err := security(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Dialer{
+		Timeout:       dialTimeout,
+		DualStack:     true,
+		SASLMechanism: mechanism,
+		TLS:           tlsConfig,
+	}, nil
+}
+
+func security(cfg config.KafkaConfig) (sasl.Mechanism, *tls.Config, error) {
+	mechanism, err := newSaslMechanism(cfg.Sasl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("kafka sasl: %w", err)
+	}
+	tlsConfig, err := newTlsConfig(cfg.Tls)
+	if err != nil {
+		return nil, nil, fmt.Errorf("kafka tls: %w", err)
+	}
+	return mechanism, tlsConfig, nil
+}
+
+// newSaslMechanism returns nil when no mechanism is configured.
+func newSaslMechanism(cfg config.KafkaSaslConfig) (sasl.Mechanism, error) {
+	switch cfg.Mechanism {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{Username: cfg.Username, Password: cfg.Password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, cfg.Username, cfg.Password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, cfg.Username, cfg.Password)
+	default:
+		return nil, fmt.Errorf("unsupported mechanism %q", cfg.Mechanism)
+	}
+}
+
+// newTlsConfig returns nil when TLS is disabled, so connections stay plaintext.
+func newTlsConfig(cfg config.KafkaTlsConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CaFile != "" {
+		pem, err := os.ReadFile(cfg.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca file %s contains no certificates", cfg.CaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,108 @@
+//go:build integration
+
+package kafka
+
+import (
+	"context"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"github.com/segmentio/kafka-go"
+	"os"
+	"testing"
+	"time"
+)
+
+// The SCRAM listener of deployments/docker-compose.yml:
+//
+//	docker compose -f deployments/docker-compose.yml up -d zoo1 kafka1 kafka-scram-init
+//	go test -tags integration ./pkg/kafka/
+//
+// KAFKA_SCRAM_BROKER points the tests at another broker with the same credentials.
+const (
+	scramUser     = "real-time-trade"
+	scramPassword = "real-time-trade"
+)
+
+func scramBroker() string {
+	if broker := os.Getenv("KAFKA_SCRAM_BROKER"); broker != "" {
+		return broker
+	}
+	return "localhost:9093"
+}
+
+func scramConfig(mechanism, password string) config.KafkaConfig {
+	return config.KafkaConfig{
+		Brokers: []string{scramBroker()},
+		Sasl: config.KafkaSaslConfig{
+			Mechanism: mechanism,
+			Username:  scramUser,
+			Password:  password,
+		},
+	}
+}
+
+func TestScramDialer(t *testing.T) {
+	for _, mechanism := range []string{"scram-sha-256", "scram-sha-512"} {
+		t.Run(mechanism, func(t *testing.T) {
+			dialer, err := NewDialer(scramConfig(mechanism, scramPassword))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			conn, err := dialer.DialContext(ctx, "tcp", scramBroker())
+			if err != nil {
+				t.Fatalf("dial %s: %v", scramBroker(), err)
+			}
+			defer conn.Close()
+			if _, err = conn.Brokers(); err != nil {
+				t.Fatalf("list brokers: %v", err)
+			}
+		})
+	}
+}
+
+func TestScramRejectsWrongPassword(t *testing.T) {
+	dialer, err := NewDialer(scramConfig("scram-sha-512", "wrong-password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := dialer.DialContext(ctx, "tcp", scramBroker())
+	if err == nil {
+		conn.Close()
+		t.Fatal("dial with a wrong password succeeded")
+	}
+}
+
+func TestScramTransport(t *testing.T) {
+	cfg := scramConfig("scram-sha-512", scramPassword)
+	transport, err := NewTransport(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := &kafka.Writer{
+		Addr:                   kafka.TCP(cfg.Brokers...),
+		Topic:                  "scram-integration-test",
+		Transport:              transport,
+		AllowAutoTopicCreation: true,
+		RequiredAcks:           kafka.RequireAll,
+	}
+	defer writer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	// The first write may race the creation of the topic.
+	for {
+		err = writer.WriteMessages(ctx, kafka.Message{Key: []byte("BTCUSDT"), Value: []byte(`{"p":"30000"}`)})
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("write over SCRAM: %v", err)
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,201 @@
+package kafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewSaslMechanism(t *testing.T) {
+	cases := []struct {
+		mechanism string
+		name      string
+		wantErr   bool
+	}{
+		{mechanism: "", name: ""},
+		{mechanism: "plain", name: "PLAIN"},
+		{mechanism: "scram-sha-256", name: "SCRAM-SHA-256"},
+		{mechanism: "scram-sha-512", name: "SCRAM-SHA-512"},
+		{mechanism: "SCRAM-SHA-512", wantErr: true},
+		{mechanism: "gssapi", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run("mechanism "+c.mechanism, func(t *testing.T) {
+			mechanism, err := newSaslMechanism(config.KafkaSaslConfig{
+				Mechanism: c.mechanism,
+				Username:  "real-time-trade",
+				Password:  "real-time-trade",
+			})
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("got mechanism %v, want an error", mechanism)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if c.name == "" {
+				if mechanism != nil {
+					t.Errorf("got mechanism %s, want none", mechanism.Name())
+				}
+				return
+			}
+			if mechanism == nil || mechanism.Name() != c.name {
+				t.Errorf("got mechanism %v, want %s", mechanism, c.name)
+			}
+		})
+	}
+}
+
+// certificates are the paths of the PEM files of a CA and of a client certificate and its key.
+type certificates struct {
+	ca, cert, key string
+}
+
+// writeCertificates writes a CA and a client certificate and key signed by it to dir.
+func writeCertificates(t *testing.T, dir string) certificates {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "real-time-trade"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDer, err := x509.CreateCertificate(rand.Reader, clientTemplate, caTemplate, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := certificates{
+		ca:   filepath.Join(dir, "ca.pem"),
+		cert: filepath.Join(dir, "client.pem"),
+		key:  filepath.Join(dir, "client-key.pem"),
+	}
+	writePem(t, files.ca, "CERTIFICATE", caDer)
+	writePem(t, files.cert, "CERTIFICATE", clientDer)
+	writePem(t, files.key, "EC PRIVATE KEY", keyDer)
+	return files
+}
+
+func writePem(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewTlsConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := writeCertificates(t, dir)
+
+	t.Run("disabled", func(t *testing.T) {
+		tlsConfig, err := newTlsConfig(config.KafkaTlsConfig{CaFile: files.ca})
+		if err != nil || tlsConfig != nil {
+			t.Fatalf("got %v, %v, want no TLS", tlsConfig, err)
+		}
+	})
+
+	t.Run("system roots", func(t *testing.T) {
+		tlsConfig, err := newTlsConfig(config.KafkaTlsConfig{Enabled: true, ServerName: "kafka1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tlsConfig.MinVersion != tls.VersionTLS12 || tlsConfig.ServerName != "kafka1" || tlsConfig.InsecureSkipVerify {
+			t.Errorf("unexpected settings %+v", tlsConfig)
+		}
+		if tlsConfig.RootCAs != nil || len(tlsConfig.Certificates) != 0 {
+			t.Error("got a CA or client certificate that was not configured")
+		}
+	})
+
+	t.Run("mutual tls", func(t *testing.T) {
+		tlsConfig, err := newTlsConfig(config.KafkaTlsConfig{
+			Enabled:  true,
+			CaFile:   files.ca,
+			CertFile: files.cert,
+			KeyFile:  files.key,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tlsConfig.Certificates) != 1 {
+			t.Fatalf("got %d client certificates, want 1", len(tlsConfig.Certificates))
+		}
+
+		// The client certificate verifies against the configured CA.
+		client, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = client.Verify(x509.VerifyOptions{
+			Roots:     tlsConfig.RootCAs,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}); err != nil {
+			t.Errorf("client certificate does not verify against the CA: %v", err)
+		}
+	})
+
+	empty := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(empty, []byte("no certificates here\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	failures := []struct {
+		name string
+		cfg  config.KafkaTlsConfig
+		want string
+	}{
+		{"missing ca", config.KafkaTlsConfig{Enabled: true, CaFile: filepath.Join(dir, "missing.pem")}, "read ca file"},
+		{"ca without certificates", config.KafkaTlsConfig{Enabled: true, CaFile: empty}, "contains no certificates"},
+		{"certificate without key", config.KafkaTlsConfig{Enabled: true, CertFile: files.cert}, "load client certificate"},
+		{"key of another certificate", config.KafkaTlsConfig{Enabled: true, CertFile: files.ca, KeyFile: files.key}, "load client certificate"},
+	}
+	for _, c := range failures {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := newTlsConfig(c.cfg)
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("got %v, want an error containing %q", err, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/linkedin/goavro/v2"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"sync"
+)
+
+const (
+	FormatJson     = "json"
+	FormatAvro     = "avro"
+	FormatProtobuf = "protobuf"
+
+	// wireMagicByte starts the Confluent wire format: magic byte, 4 byte big endian schema id,
+	// then the encoded value.
+	wireMagicByte = 0
+)
+
+// Serializer encodes message values for a topic.
+type Serializer interface {
+	Serialize(ctx context.Context, topic string, record Record) ([]byte, error)
+	// Format returns json, avro or protobuf.
+	Format() string
+}
+
+// NewSerializer returns the serializer of the configured format. Avro and Protobuf register
+// their schemas under the <topic>-value subject of the schema registry.
+func NewSerializer(cfg config.KafkaConfig) (Serializer, error) {
+	switch cfg.Format {
+	case "", FormatJson:
+		return jsonSerializer{}, nil
+	case FormatAvro:
+		return &avroSerializer{registry: NewSchemaRegistry(cfg.SchemaRegistry), codecs: make(map[*Schema]*goavro.Codec)}, nil
+	case FormatProtobuf:
+		return &protobufSerializer{registry: NewSchemaRegistry(cfg.SchemaRegistry)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported message format %q", cfg.Format)
+	}
+}
+
+// jsonSerializer keeps the schemaless JSON of the record, as published before formats existed.
+type jsonSerializer struct{}
+
+func (jsonSerializer) Serialize(_ context.Context, _ string, record Record) ([]byte, error) {
+	return json.Marshal(record)
+}
+
+func (jsonSerializer) Format() string {
+	return FormatJson
+}
+
+type avroSerializer struct {
+	registry *SchemaRegistry
+
+	mu     sync.Mutex
+	codecs map[*Schema]*goavro.Codec
+}
+
+func (s *avroSerializer) Serialize(ctx context.Context, topic string, record Record) ([]byte, error) {
+	schema := record.Schema()
+	codec, err := s.codec(schema)
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.registry.Register(ctx, subject(topic), schemaTypeAvro, codec.Schema())
+	if err != nil {
+		return nil, err
+	}
+
+	values := record.Values()
+	native := make(map[string]interface{}, len(schema.Fields))
+	for i, field := range schema.Fields {
+		native[field.Name] = values[i]
+	}
+	return codec.BinaryFromNative(wirePrefix(id), native)
+}
+
+func (s *avroSerializer) Format() string {
+	return FormatAvro
+}
+
+func (s *avroSerializer) codec(schema *Schema) (*goavro.Codec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if codec, ok := s.codecs[schema]; ok {
+		return codec, nil
+	}
+	text, err := schema.Avro()
+	if err != nil {
+		return nil, err
+	}
+	codec, err := goavro.NewCodec(text)
+	if err != nil {
+		return nil, fmt.Errorf("avro schema %s: %w", schema.Name, err)
+	}
+	s.codecs[schema] = codec
+	return codec, nil
+}
+
+type protobufSerializer struct {
+	registry *SchemaRegistry
+}
+
+func (s *protobufSerializer) Serialize(ctx context.Context, topic string, record Record) ([]byte, error) {
+	schema := record.Schema()
+	text, err := schema.Proto()
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.registry.Register(ctx, subject(topic), schemaTypeProtobuf, text)
+	if err != nil {
+		return nil, err
+	}
+
+	// The message indexes follow the schema id; the single 0 stands for the first message.
+	b := append(wirePrefix(id), 0)
+	values := record.Values()
+	for i, field := range schema.Fields {
+		number := protowire.Number(i + 1)
+		switch field.Type {
+		case FieldString:
+			b = protowire.AppendTag(b, number, protowire.BytesType)
+			b = protowire.AppendString(b, values[i].(string))
+		case FieldLong:
+			b = protowire.AppendTag(b, number, protowire.VarintType)
+			b = protowire.AppendVarint(b, uint64(values[i].(int64)))
+		case FieldDouble:
+			b = protowire.AppendTag(b, number, protowire.Fixed64Type)
+			b = protowire.AppendFixed64(b, math.Float64bits(values[i].(float64)))
+		default:
+			return nil, fmt.Errorf("field %s: unsupported type %q", field.Name, field.Type)
+		}
+	}
+	return b, nil
+}
+
+func (s *protobufSerializer) Format() string {
+	return FormatProtobuf
+}
+
+// subject follows the TopicNameStrategy of the Confluent serializers.
+func subject(topic string) string {
+	return topic + "-value"
+}
+
+func wirePrefix(id int) []byte {
+	b := make([]byte, 5, 64)
+	b[0] = wireMagicByte
+	binary.BigEndian.PutUint32(b[1:], uint32(id))
+	return b
+}
@@ -0,0 +1,423 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/linkedin/goavro/v2"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testSchema = &Schema{
+	Namespace: "realtimetrade.test",
+	Name:      "Trade",
+	Version:   1,
+	Fields: []SchemaField{
+		{Name: "symbol", Type: FieldString},
+		{Name: "time", Type: FieldLong},
+		{Name: "price", Type: FieldDouble},
+	},
+}
+
+type testRecord struct {
+	Symbol string  `json:"s"`
+	Time   int64   `json:"T"`
+	Price  float64 `json:"p"`
+}
+
+func (r testRecord) Schema() *Schema {
+	return testSchema
+}
+
+func (r testRecord) Values() []interface{} {
+	return []interface{}{r.Symbol, r.Time, r.Price}
+}
+
+var record = testRecord{Symbol: "BTCUSDT", Time: 1700000000123, Price: 30000.25}
+
+// fakeRegistry implements the schema registry endpoints the client calls. Every distinct schema
+// gets the next id, and a registered schema the id it got before.
+type fakeRegistry struct {
+	mu            sync.Mutex
+	ids           map[string]int
+	subjects      map[string]bool
+	requests      []string
+	schemaTypes   map[string]string
+	compatibility map[string]string
+	incompatible  bool
+	conflict      bool
+	block         chan struct{}
+}
+
+func newFakeRegistry(t *testing.T) (*fakeRegistry, *httptest.Server) {
+	t.Helper()
+	registry := &fakeRegistry{
+		ids:           make(map[string]int),
+		subjects:      make(map[string]bool),
+		schemaTypes:   make(map[string]string),
+		compatibility: make(map[string]string),
+	}
+	server := httptest.NewServer(registry)
+	t.Cleanup(server.Close)
+	return registry, server
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/schemas/ids/") {
+		f.serveSchema(w, strings.TrimPrefix(r.URL.Path, "/schemas/ids/"))
+		return
+	}
+	if r.Header.Get("Content-Type") != registryContentType {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	var body struct {
+		Schema        string `json:"schema"`
+		SchemaType    string `json:"schemaType"`
+		Compatibility string `json:"compatibility"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	subjectPath := strings.TrimPrefix(r.URL.Path, "/subjects/")
+
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	block := f.block
+	f.mu.Unlock()
+	if block != nil && strings.Contains(r.URL.Path, "slow") {
+		<-block
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/config/"):
+		f.compatibility[strings.TrimPrefix(r.URL.Path, "/config/")] = body.Compatibility
+		writeJson(w, http.StatusOK, map[string]string{"compatibility": body.Compatibility})
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/compatibility/subjects/"):
+		subject := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/compatibility/subjects/"), "/versions/latest")
+		if !f.subjects[subject] {
+			writeJson(w, http.StatusNotFound, map[string]interface{}{"error_code": 40401, "message": "Subject not found."})
+			return
+		}
+		writeJson(w, http.StatusOK, map[string]bool{"is_compatible": !f.incompatible})
+	case r.Method == http.MethodPost && strings.HasSuffix(subjectPath, "/versions"):
+		if f.conflict {
+			writeJson(w, http.StatusConflict, map[string]interface{}{"error_code": 409, "message": "Schema being registered is incompatible"})
+			return
+		}
+		subject := strings.TrimSuffix(subjectPath, "/versions")
+		id, ok := f.ids[body.Schema]
+		if !ok {
+			id = len(f.ids) + 1
+			f.ids[body.Schema] = id
+		}
+		f.subjects[subject] = true
+		f.schemaTypes[subject] = body.SchemaType
+		writeJson(w, http.StatusOK, map[string]int{"id": id})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeRegistry) serveSchema(w http.ResponseWriter, id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, http.MethodGet+" /schemas/ids/"+id)
+	for schema, registered := range f.ids {
+		if strconv.Itoa(registered) == id {
+			writeJson(w, http.StatusOK, map[string]string{"schema": schema})
+			return
+		}
+	}
+	writeJson(w, http.StatusNotFound, map[string]interface{}{"error_code": 40403, "message": "Schema not found"})
+}
+
+func (f *fakeRegistry) registrations() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, request := range f.requests {
+		if strings.HasPrefix(request, http.MethodPost+" /subjects/") {
+			count++
+		}
+	}
+	return count
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", registryContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func newTestSerializer(t *testing.T, format, url string) Serializer {
+	t.Helper()
+	serializer, err := NewSerializer(config.KafkaConfig{
+		Format:         format,
+		SchemaRegistry: config.SchemaRegistryConfig{Url: url, Timeout: 5},
+	})
+	if err != nil {
+		t.Fatalf("NewSerializer: %v", err)
+	}
+	if serializer.Format() != format {
+		t.Fatalf("Format() = %s, want %s", serializer.Format(), format)
+	}
+	return serializer
+}
+
+// splitWire checks the Confluent wire format prefix of b and returns its schema id and the
+// encoded value.
+func splitWire(t *testing.T, b []byte) (int, []byte) {
+	t.Helper()
+	if len(b) < 5 {
+		t.Fatalf("message of %d bytes has no wire format prefix", len(b))
+	}
+	if b[0] != wireMagicByte {
+		t.Fatalf("magic byte %d, want %d", b[0], wireMagicByte)
+	}
+	return int(binary.BigEndian.Uint32(b[1:5])), b[5:]
+}
+
+func TestJsonSerializer(t *testing.T) {
+	serializer := newTestSerializer(t, FormatJson, "")
+
+	b, err := serializer.Serialize(context.Background(), "trades-btcusdt", record)
+	if err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	var decoded testRecord
+	if err = json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("message is not JSON: %v", err)
+	}
+	if decoded != record {
+		t.Errorf("decoded %+v, want %+v", decoded, record)
+	}
+}
+
+func TestAvroSerializer(t *testing.T) {
+	registry, server := newFakeRegistry(t)
+	serializer := newTestSerializer(t, FormatAvro, server.URL)
+
+	b, err := serializer.Serialize(context.Background(), "trades-btcusdt", record)
+	if err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	id, value := splitWire(t, b)
+	if id != 1 {
+		t.Errorf("schema id %d, want 1", id)
+	}
+	if schemaType := registry.schemaTypes["trades-btcusdt-value"]; schemaType != "" {
+		t.Errorf("registered as %s, want the AVRO default", schemaType)
+	}
+
+	text, err := testSchema.Avro()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec, err := goavro.NewCodec(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	native, rest, err := codec.NativeFromBinary(value)
+	if err != nil {
+		t.Fatalf("decoding avro: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Errorf("%d bytes after the record", len(rest))
+	}
+	want := map[string]interface{}{"symbol": record.Symbol, "time": record.Time, "price": record.Price}
+	if !reflect.DeepEqual(native, want) {
+		t.Errorf("decoded %v, want %v", native, want)
+	}
+}
+
+func TestProtobufSerializer(t *testing.T) {
+	registry, server := newFakeRegistry(t)
+	serializer := newTestSerializer(t, FormatProtobuf, server.URL)
+
+	b, err := serializer.Serialize(context.Background(), "trades-btcusdt", record)
+	if err != nil {
+		t.Fatalf("Serialize: %v", err)
+	}
+	id, value := splitWire(t, b)
+	if id != 1 {
+		t.Errorf("schema id %d, want 1", id)
+	}
+	if schemaType := registry.schemaTypes["trades-btcusdt-value"]; schemaType != schemaTypeProtobuf {
+		t.Errorf("registered as %q, want %s", schemaType, schemaTypeProtobuf)
+	}
+
+	// The message indexes of the first message.
+	if len(value) == 0 || value[0] != 0 {
+		t.Fatalf("message indexes %v, want [0]", value[:1])
+	}
+	value = value[1:]
+
+	var decoded testRecord
+	for len(value) > 0 {
+		number, wireType, n := protowire.ConsumeTag(value)
+		if n < 0 {
+			t.Fatalf("tag: %v", protowire.ParseError(n))
+		}
+		value = value[n:]
+		switch {
+		case number == 1 && wireType == protowire.BytesType:
+			decoded.Symbol, n = protowire.ConsumeString(value)
+		case number == 2 && wireType == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(value)
+			decoded.Time = int64(v)
+		case number == 3 && wireType == protowire.Fixed64Type:
+			var v uint64
+			v, n = protowire.ConsumeFixed64(value)
+			decoded.Price = math.Float64frombits(v)
+		default:
+			t.Fatalf("unexpected field %d of wire type %d", number, wireType)
+		}
+		if n < 0 {
+			t.Fatalf("field %d: %v", number, protowire.ParseError(n))
+		}
+		value = value[n:]
+	}
+	if decoded != record {
+		t.Errorf("decoded %+v, want %+v", decoded, record)
+	}
+}
+
+func TestSchemaRegistryCachesPerSchema(t *testing.T) {
+	registry, server := newFakeRegistry(t)
+	client := NewSchemaRegistry(config.SchemaRegistryConfig{Url: server.URL, Timeout: 5})
+	ctx := context.Background()
+
+	first, err := client.Register(ctx, "trades-value", schemaTypeAvro, `"string"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := client.Register(ctx, "trades-value", schemaTypeAvro, `"string"`); err != nil || again != first {
+		t.Fatalf("second registration returned %d, %v, want %d", again, err, first)
+	}
+	if registry.registrations() != 1 {
+		t.Errorf("%d registrations, want the second one cached", registry.registrations())
+	}
+
+	// A new schema of the same subject, as after an upgrade, is registered as well.
+	second, err := client.Register(ctx, "trades-value", schemaTypeAvro, `"long"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Errorf("new schema got the id %d of the old one", second)
+	}
+	if registry.registrations() != 2 {
+		t.Errorf("%d registrations, want 2", registry.registrations())
+	}
+}
+
+// A registration waiting on the registry does not hold up schemas that are already cached.
+func TestSchemaRegistryCallsOutsideTheLock(t *testing.T) {
+	registry, server := newFakeRegistry(t)
+	client := NewSchemaRegistry(config.SchemaRegistryConfig{Url: server.URL, Timeout: 5})
+	ctx := context.Background()
+
+	if _, err := client.Register(ctx, "fast-value", schemaTypeAvro, `"string"`); err != nil {
+		t.Fatal(err)
+	}
+
+	unblock := make(chan struct{})
+	registry.mu.Lock()
+	registry.block = unblock
+	registry.mu.Unlock()
+	slow := make(chan error, 1)
+	go func() {
+		_, err := client.Register(ctx, "slow-value", schemaTypeAvro, `"string"`)
+		slow <- err
+	}()
+	for registry.registrations() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cached := make(chan error, 1)
+	go func() {
+		_, err := client.Register(ctx, "fast-value", schemaTypeAvro, `"string"`)
+		cached <- err
+	}()
+	select {
+	case err := <-cached:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cached schema blocked by a registration in flight")
+	}
+
+	close(unblock)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSchemaRegistryCompatibility(t *testing.T) {
+	registry, server := newFakeRegistry(t)
+	client := NewSchemaRegistry(config.SchemaRegistryConfig{Url: server.URL, Compatibility: "BACKWARD", Timeout: 5})
+	ctx := context.Background()
+
+	// The first version of a subject has nothing to be compatible with.
+	if _, err := client.Register(ctx, "trades-value", schemaTypeAvro, `"string"`); err != nil {
+		t.Fatalf("first version: %v", err)
+	}
+	if registry.compatibility["trades-value"] != "BACKWARD" {
+		t.Errorf("compatibility %q, want BACKWARD", registry.compatibility["trades-value"])
+	}
+
+	registry.mu.Lock()
+	registry.incompatible = true
+	registry.mu.Unlock()
+	if _, err := client.Register(ctx, "trades-value", schemaTypeAvro, `"long"`); !errors.Is(err, ErrIncompatibleSchema) {
+		t.Errorf("incompatible version returned %v, want ErrIncompatibleSchema", err)
+	}
+
+	// Registries without a compatibility level configured reject on registration.
+	plain := NewSchemaRegistry(config.SchemaRegistryConfig{Url: server.URL, Timeout: 5})
+	registry.mu.Lock()
+	registry.conflict = true
+	registry.mu.Unlock()
+	if _, err := plain.Register(ctx, "trades-value", schemaTypeAvro, `"double"`); !errors.Is(err, ErrIncompatibleSchema) {
+		t.Errorf("conflicting version returned %v, want ErrIncompatibleSchema", err)
+	}
+}
+
+func TestSchemaRegistryBasicAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "real-time-trade" || password != "secret" {
+			writeJson(w, http.StatusUnauthorized, map[string]interface{}{"error_code": 401, "message": "Unauthorized"})
+			return
+		}
+		writeJson(w, http.StatusOK, map[string]int{"id": 7})
+	}))
+	defer server.Close()
+
+	client := NewSchemaRegistry(config.SchemaRegistryConfig{Url: server.URL + "/", Username: "real-time-trade", Password: "secret", Timeout: 5})
+	if id, err := client.Register(context.Background(), "trades-value", schemaTypeAvro, `"string"`); err != nil || id != 7 {
+		t.Errorf("got %d, %v, want 7", id, err)
+	}
+
+	client = NewSchemaRegistry(config.SchemaRegistryConfig{Url: server.URL, Username: "real-time-trade", Password: "wrong", Timeout: 5})
+	var status *registryError
+	if _, err := client.Register(context.Background(), "trades-value", schemaTypeAvro, `"string"`); !errors.As(err, &status) || status.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got %v, want a 401 registry error", err)
+	}
+}
@@ -0,0 +1,47 @@
+package kafka
+
+import (
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"regexp"
+	"strings"
+)
+
+// Streams published by the service, the {stream} of the topic names.
+const (
+	StreamTrades     = "trades"
+	StreamStats      = "stats"
+	StreamIndicators = "indicators"
+	StreamCandles    = "candles"
+)
+
+// TopicNamer names the topic of a stream, such as trades, from the topicName template of the
+// configured strategy. When the template is empty the default of the strategy applies.
+type TopicNamer struct {
+	template string
+}
+
+func NewTopicNamer(cfg config.KafkaConfig) *TopicNamer {
+	template := cfg.TopicName
+	if template == "" {
+		template = config.DefaultTopicTemplate(cfg.TopicStrategy)
+	}
+	return &TopicNamer{template: template}
+}
+
+// Topic fills in the {exchange}, {stream} and {symbol} placeholders, lower case.
+func (n *TopicNamer) Topic(exchange, stream, symbol string) string {
+	return strings.NewReplacer(
+		"{exchange}", strings.ToLower(exchange),
+		"{stream}", strings.ToLower(stream),
+		"{symbol}", strings.ToLower(symbol),
+	).Replace(n.template)
+}
+
+// Pattern returns a regular expression matching the topics of a stream for every symbol.
+func (n *TopicNamer) Pattern(exchange, stream string) string {
+	return "^" + strings.NewReplacer(
+		regexp.QuoteMeta("{exchange}"), regexp.QuoteMeta(strings.ToLower(exchange)),
+		regexp.QuoteMeta("{stream}"), regexp.QuoteMeta(strings.ToLower(stream)),
+		regexp.QuoteMeta("{symbol}"), "[a-z0-9]+",
+	).Replace(regexp.QuoteMeta(n.template)) + "$"
+}
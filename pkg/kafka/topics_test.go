@@ -0,0 +1,35 @@
+package kafka
+
+import (
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"regexp"
+	"testing"
+)
+
+func TestTopicNamerPattern(t *testing.T) {
+	cases := []struct {
+		strategy, template string
+		matches, others    []string
+	}{
+		{"per-symbol", "", []string{"trades-btcusdt", "trades-ethusdt"}, []string{"stats-btcusdt", "trades-", "xtrades-btcusdt"}},
+		{"per-symbol", "{exchange}.{stream}.{symbol}", []string{"binance.trades.btcusdt"}, []string{"binanceXtrades.btcusdt", "binance.trades.BTCUSDT"}},
+		{"shared", "", []string{"trades"}, []string{"trades-btcusdt", "stats"}},
+		{"per-exchange", "", []string{"binance.trades"}, []string{"binance.stats", "binanceXtrades"}},
+	}
+	for _, c := range cases {
+		t.Run(c.strategy+" "+c.template, func(t *testing.T) {
+			namer := NewTopicNamer(config.KafkaConfig{TopicStrategy: c.strategy, TopicName: c.template})
+			pattern := regexp.MustCompile(namer.Pattern("Binance", StreamTrades))
+			for _, topic := range c.matches {
+				if !pattern.MatchString(topic) {
+					t.Errorf("%s does not match %s", pattern, topic)
+				}
+			}
+			for _, topic := range c.others {
+				if pattern.MatchString(topic) {
+					t.Errorf("%s matches %s", pattern, topic)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package kafka
+
+import "sync"
+
+// outcomeWindow remembers whether each of the last size publishes failed.
+type outcomeWindow struct {
+	mu       sync.Mutex
+	outcomes []bool
+	next     int
+	filled   bool
+	failures int
+}
+
+func newOutcomeWindow(size int) *outcomeWindow {
+	return &outcomeWindow{outcomes: make([]bool, size)}
+}
+
+func (w *outcomeWindow) record(failed bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.outcomes[w.next] {
+		w.failures--
+	}
+	w.outcomes[w.next] = failed
+	if failed {
+		w.failures++
+	}
+
+	w.next = (w.next + 1) % len(w.outcomes)
+	if w.next == 0 {
+		w.filled = true
+	}
+}
+
+func (w *outcomeWindow) rate() float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	count := w.next
+	if w.filled {
+		count = len(w.outcomes)
+	}
+	if count == 0 {
+		return 0
+	}
+	return float64(w.failures) / float64(count)
+}
@@ -1,14 +1,20 @@
 package kafka
 
 import (
+	"github.com/sefikcan/read-time-trade/pkg/config"
 	"github.com/segmentio/kafka-go"
 	"github.com/segmentio/kafka-go/compress"
 )
 
-func NewWriter(brokers []string, errLogger kafka.Logger) *kafka.Writer {
+func NewWriter(cfg config.KafkaConfig, errLogger kafka.Logger) (*kafka.Writer, error) {
+	transport, err := NewTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	w := &kafka.Writer{
-		Addr:                   kafka.TCP(brokers...),
-		Balancer:               &kafka.LeastBytes{},
+		Addr:                   kafka.TCP(cfg.Brokers...),
+		Balancer:               newBalancer(cfg.Balancer),
 		RequiredAcks:           writerRequiredAcks,
 		MaxAttempts:            writerMaxAttempts,
 		ErrorLogger:            errLogger,
@@ -17,6 +23,16 @@ func NewWriter(brokers []string, errLogger kafka.Logger) *kafka.Writer {
 		WriteTimeout:           writerWriteTimeout,
 		Async:                  false,
 		AllowAutoTopicCreation: true,
+		Transport:              transport,
+	}
+	return w, nil
+}
+
+// newBalancer hashes keys with murmur2, as the Java client and franz-go do, so every client puts
+// a symbol on the same partition.
+func newBalancer(name string) kafka.Balancer {
+	if name == "least-bytes" {
+		return &kafka.LeastBytes{}
 	}
-	return w
+	return &kafka.Murmur2Balancer{}
 }
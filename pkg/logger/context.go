@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey int
+
+const requestIdKey contextKey = iota
+
+// Field names shared by the structured log entries of the service.
+const (
+	FieldRequestId    = "request_id"
+	FieldTraceId      = "trace_id"
+	FieldSpanId       = "span_id"
+	FieldSymbol       = "symbol"
+	FieldExchange     = "exchange"
+	FieldStream       = "stream"
+	FieldConnectionId = "connection_id"
+	FieldTopic        = "topic"
+	FieldOffset       = "offset"
+	FieldError        = "error"
+)
+
+// ContextWithRequestId returns a copy of ctx carrying the request id for the Ctx log methods.
+func ContextWithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey, requestId)
+}
+
+// RequestIdFromContext returns the request id stored in ctx, or an empty string.
+func RequestIdFromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey).(string)
+	return requestId
+}
+
+// appendContextFields appends the request id and the trace and span ids found in ctx to
+// keysAndValues. Ids missing from ctx are left out.
+func appendContextFields(ctx context.Context, keysAndValues []interface{}) []interface{} {
+	if ctx == nil {
+		return keysAndValues
+	}
+
+	fields := make([]interface{}, 0, len(keysAndValues)+6)
+	fields = append(fields, keysAndValues...)
+	if requestId := RequestIdFromContext(ctx); requestId != "" {
+		fields = append(fields, FieldRequestId, requestId)
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		fields = append(fields, FieldTraceId, spanContext.TraceID().String(), FieldSpanId, spanContext.SpanID().String())
+	}
+	return fields
+}
@@ -0,0 +1,149 @@
+package logger
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Levels holds the global log level and the overrides of named components. Component names are
+// the dot separated logger names, e.g. "listener" or "listener.btcusdt"; a component without an
+// override uses the level of its closest configured parent, and finally the global level.
+type Levels struct {
+	global zap.AtomicLevel
+
+	mu         sync.RWMutex
+	components map[string]zap.AtomicLevel
+}
+
+// LevelSettings is a snapshot of the configured levels.
+type LevelSettings struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+}
+
+func NewLevels(global zapcore.Level) *Levels {
+	return &Levels{
+		global:     zap.NewAtomicLevelAt(global),
+		components: make(map[string]zap.AtomicLevel),
+	}
+}
+
+// ParseLevel returns the level named by text, e.g. "debug" or "warn".
+func ParseLevel(text string) (zapcore.Level, error) {
+	level, exist := loggerLevelMap[strings.ToLower(text)]
+	if !exist {
+		return zapcore.InfoLevel, fmt.Errorf("unknown log level %q", text)
+	}
+	return level, nil
+}
+
+// SetLevel changes the global level.
+func (l *Levels) SetLevel(level zapcore.Level) {
+	l.global.SetLevel(level)
+}
+
+// SetComponentLevel overrides the level of component and its children without an override.
+func (l *Levels) SetComponentLevel(component string, level zapcore.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if atomicLevel, ok := l.components[component]; ok {
+		atomicLevel.SetLevel(level)
+		return
+	}
+	l.components[component] = zap.NewAtomicLevelAt(level)
+}
+
+// ResetComponentLevel removes the override of component.
+func (l *Levels) ResetComponentLevel(component string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.components, component)
+}
+
+// Level returns the level in effect for the logger named name.
+func (l *Levels) Level(name string) zapcore.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for name != "" {
+		if atomicLevel, ok := l.components[name]; ok {
+			return atomicLevel.Level()
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return l.global.Level()
+}
+
+// Enabled reports whether any logger logs at level, which is what a core is asked before the
+// logger name of an entry is known.
+func (l *Levels) Enabled(level zapcore.Level) bool {
+	if l.global.Enabled(level) {
+		return true
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, atomicLevel := range l.components {
+		if atomicLevel.Enabled(level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Settings returns a snapshot of the global level and the component overrides.
+func (l *Levels) Settings() LevelSettings {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	settings := LevelSettings{
+		Level:      l.global.Level().String(),
+		Components: make(map[string]string, len(l.components)),
+	}
+	names := make([]string, 0, len(l.components))
+	for name := range l.components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		settings.Components[name] = l.components[name].Level().String()
+	}
+	return settings
+}
+
+// levelCore filters entries by the level of the logger that wrote them. The wrapped core must
+// accept every level.
+type levelCore struct {
+	zapcore.Core
+	levels *Levels
+}
+
+func newLevelCore(core zapcore.Core, levels *Levels) zapcore.Core {
+	return &levelCore{Core: core, levels: levels}
+}
+
+func (c *levelCore) Enabled(level zapcore.Level) bool {
+	return c.levels.Enabled(level)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *levelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if entry.Level < c.levels.Level(entry.LoggerName) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
@@ -0,0 +1,158 @@
+package logger
+
+import (
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"reflect"
+	"testing"
+)
+
+// newObservedLogger is a logger of cfg writing to the returned observer instead of stderr.
+func newObservedLogger(cfg *config.Config) (*logger, *observer.ObservedLogs) {
+	l := NewLogger(cfg)
+	l.InitLogger()
+	core, logs := observer.New(zapcore.DebugLevel)
+	l.sugarLogger = zap.New(newLevelCore(core, l.levels)).Sugar()
+	return l, logs
+}
+
+func TestParseLevel(t *testing.T) {
+	cases := []struct {
+		text string
+		want zapcore.Level
+		ok   bool
+	}{
+		{"debug", zapcore.DebugLevel, true},
+		{"WARN", zapcore.WarnLevel, true},
+		{"Error", zapcore.ErrorLevel, true},
+		{"verbose", zapcore.InfoLevel, false},
+		{"", zapcore.InfoLevel, false},
+	}
+	for _, c := range cases {
+		level, err := ParseLevel(c.text)
+		if level != c.want || (err == nil) != c.ok {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", c.text, level, err, c.want)
+		}
+	}
+}
+
+// The configured levels are read like those of the admin routes, in any case.
+func TestInitLoggerReadsLevelsInAnyCase(t *testing.T) {
+	l := NewLogger(&config.Config{Logger: config.LoggerConfig{
+		Level:      "WARN",
+		Encoding:   "json",
+		Components: map[string]string{"listener": "Debug"},
+	}})
+	l.InitLogger()
+
+	if got := l.Levels().Level(""); got != zapcore.WarnLevel {
+		t.Errorf("global level %v, want warn", got)
+	}
+	if got := l.Levels().Level("listener"); got != zapcore.DebugLevel {
+		t.Errorf("listener level %v, want debug", got)
+	}
+}
+
+func TestLevelsComponentOverrides(t *testing.T) {
+	levels := NewLevels(zapcore.InfoLevel)
+	levels.SetComponentLevel("listener", zapcore.DebugLevel)
+	levels.SetComponentLevel("listener.btcusdt", zapcore.ErrorLevel)
+	levels.SetComponentLevel("kafka", zapcore.DebugLevel)
+	levels.SetComponentLevel("kafka", zapcore.WarnLevel)
+
+	cases := []struct {
+		name string
+		want zapcore.Level
+	}{
+		{"", zapcore.InfoLevel},
+		{"http", zapcore.InfoLevel},
+		{"listener", zapcore.DebugLevel},
+		{"listener.ethusdt", zapcore.DebugLevel},
+		{"listener.btcusdt", zapcore.ErrorLevel},
+		{"listener.btcusdt.frames", zapcore.ErrorLevel},
+		{"listenerx", zapcore.InfoLevel},
+		{"kafka.producer", zapcore.WarnLevel},
+	}
+	for _, c := range cases {
+		if got := levels.Level(c.name); got != c.want {
+			t.Errorf("Level(%q) = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	want := LevelSettings{Level: "info", Components: map[string]string{"kafka": "warn", "listener": "debug", "listener.btcusdt": "error"}}
+	if got := levels.Settings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("settings %+v, want %+v", got, want)
+	}
+
+	levels.ResetComponentLevel("listener")
+	levels.SetLevel(zapcore.WarnLevel)
+	if got := levels.Level("listener.ethusdt"); got != zapcore.WarnLevel {
+		t.Errorf("after the reset listener.ethusdt logs at %v, want the global warn", got)
+	}
+	if got := levels.Level("listener.btcusdt"); got != zapcore.ErrorLevel {
+		t.Errorf("after the reset of its parent listener.btcusdt logs at %v, want error", got)
+	}
+}
+
+func TestLevelCore(t *testing.T) {
+	l, logs := newObservedLogger(&config.Config{Logger: config.LoggerConfig{Level: "warn", Encoding: "json"}})
+	core := l.sugarLogger.Desugar().Core()
+
+	if core.Enabled(zapcore.DebugLevel) {
+		t.Error("debug enabled without a logger at debug")
+	}
+	l.Levels().SetComponentLevel("listener", zapcore.DebugLevel)
+	if !core.Enabled(zapcore.DebugLevel) {
+		t.Error("debug disabled with the listener at debug")
+	}
+
+	l.Named("http").Debugw("Dropped")
+	l.Named("http").Warnw("Logged")
+	l.Named("listener").Debugw("Logged")
+	l.Named("listener").Named("btcusdt").Infow("Logged")
+	l.Debugw("Dropped")
+
+	if logs.Len() != 3 || logs.FilterMessage("Dropped").Len() != 0 {
+		t.Errorf("logged %v", logs.All())
+	}
+}
+
+func TestSampled(t *testing.T) {
+	cfg := &config.Config{Logger: config.LoggerConfig{
+		Level:    "info",
+		Encoding: "json",
+		Sampling: config.LogSamplingConfig{Initial: 2, Thereafter: 3},
+	}}
+	l, logs := newObservedLogger(cfg)
+	l.Levels().SetComponentLevel("listener", zapcore.WarnLevel)
+	sampled := l.Named("listener").Sampled()
+
+	// Entries filtered out by level do not count against the sample.
+	for i := 0; i < 5; i++ {
+		sampled.Infow("Trade received")
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("logged %d entries below the level", logs.Len())
+	}
+
+	// The first 2, then every 3rd: entries 1, 2, 5 and 8.
+	l.Levels().SetComponentLevel("listener", zapcore.InfoLevel)
+	for i := 0; i < 8; i++ {
+		sampled.Infow("Trade received")
+	}
+	if logs.Len() != 4 {
+		t.Errorf("logged %d of 8 entries, want 4", logs.Len())
+	}
+
+	// Without sampling every entry is logged.
+	cfg.Logger.Sampling.Initial = 0
+	unsampled, logs := newObservedLogger(cfg)
+	for i := 0; i < 8; i++ {
+		unsampled.Sampled().Infow("Trade received")
+	}
+	if logs.Len() != 8 {
+		t.Errorf("logged %d of 8 entries without sampling", logs.Len())
+	}
+}
@@ -1,10 +1,12 @@
 package logger
 
 import (
+	"context"
 	"github.com/sefikcan/read-time-trade/pkg/config"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"os"
+	"time"
 )
 
 type Logger interface {
@@ -22,11 +24,35 @@ type Logger interface {
 	Errorf(template string, args ...interface{})
 	DPanicf(template string, args ...interface{})
 	Fatalf(template string, args ...interface{})
+
+	// Debugw, Infow, Warnw and Errorw log msg with loosely typed key-value pairs as structured
+	// fields, e.g. Infow("Trade received", "symbol", "BTCUSDT").
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+
+	// DebugCtx, InfoCtx, WarnCtx and ErrorCtx behave like their w counterparts and add the
+	// request id and trace id carried by ctx.
+	DebugCtx(ctx context.Context, msg string, keysAndValues ...interface{})
+	InfoCtx(ctx context.Context, msg string, keysAndValues ...interface{})
+	WarnCtx(ctx context.Context, msg string, keysAndValues ...interface{})
+	ErrorCtx(ctx context.Context, msg string, keysAndValues ...interface{})
+
+	// With returns a child logger adding the key-value pairs to every entry.
+	With(keysAndValues ...interface{}) Logger
+	// Named returns a child logger with name appended to the logger name, dot separated.
+	Named(name string) Logger
+	// Sampled returns a child logger applying the configured sampling, for high-volume entries.
+	Sampled() Logger
+	// Levels returns the levels shared by the logger and all of its children.
+	Levels() *Levels
 }
 
 type logger struct {
 	cfg         *config.Config
 	sugarLogger *zap.SugaredLogger
+	levels      *Levels
 }
 
 func NewLogger(cfg *config.Config) *logger {
@@ -46,8 +72,8 @@ var loggerLevelMap = map[string]zapcore.Level{
 }
 
 func (l *logger) getLogLevel(cfg *config.Config) zapcore.Level {
-	level, exist := loggerLevelMap[cfg.Logger.Level]
-	if !exist {
+	level, err := ParseLevel(cfg.Logger.Level)
+	if err != nil {
 		return zapcore.DebugLevel
 	}
 
@@ -102,8 +128,85 @@ func (l logger) Fatalf(template string, args ...interface{}) {
 	l.sugarLogger.Fatalf(template, args...)
 }
 
+func (l logger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.sugarLogger.Debugw(msg, keysAndValues...)
+}
+
+func (l logger) Infow(msg string, keysAndValues ...interface{}) {
+	l.sugarLogger.Infow(msg, keysAndValues...)
+}
+
+func (l logger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.sugarLogger.Warnw(msg, keysAndValues...)
+}
+
+func (l logger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.sugarLogger.Errorw(msg, keysAndValues...)
+}
+
+func (l logger) DebugCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	l.sugarLogger.Debugw(msg, appendContextFields(ctx, keysAndValues)...)
+}
+
+func (l logger) InfoCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	l.sugarLogger.Infow(msg, appendContextFields(ctx, keysAndValues)...)
+}
+
+func (l logger) WarnCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	l.sugarLogger.Warnw(msg, appendContextFields(ctx, keysAndValues)...)
+}
+
+func (l logger) ErrorCtx(ctx context.Context, msg string, keysAndValues ...interface{}) {
+	l.sugarLogger.Errorw(msg, appendContextFields(ctx, keysAndValues)...)
+}
+
+func (l logger) With(keysAndValues ...interface{}) Logger {
+	return &logger{
+		cfg:         l.cfg,
+		sugarLogger: l.sugarLogger.With(keysAndValues...),
+		levels:      l.levels,
+	}
+}
+
+func (l logger) Named(name string) Logger {
+	return &logger{
+		cfg:         l.cfg,
+		sugarLogger: l.sugarLogger.Named(name),
+		levels:      l.levels,
+	}
+}
+
+// Sampled logs the first Initial entries with the same message and level every second and then
+// every Thereafter-th one. Entries filtered out by level do not count against the sample.
+func (l logger) Sampled() Logger {
+	sampling := l.cfg.Logger.Sampling
+	if sampling.Initial <= 0 {
+		return &l
+	}
+
+	sampled := l.sugarLogger.Desugar().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return newLevelCore(zapcore.NewSamplerWithOptions(core, time.Second, sampling.Initial, sampling.Thereafter), l.levels)
+	}))
+	return &logger{
+		cfg:         l.cfg,
+		sugarLogger: sampled.Sugar(),
+		levels:      l.levels,
+	}
+}
+
+func (l logger) Levels() *Levels {
+	return l.levels
+}
+
 func (l *logger) InitLogger() {
-	logLevel := l.getLogLevel(l.cfg)
+	l.levels = NewLevels(l.getLogLevel(l.cfg))
+	for component, text := range l.cfg.Logger.Components {
+		level, err := ParseLevel(text)
+		if err != nil {
+			level = zapcore.DebugLevel
+		}
+		l.levels.SetComponentLevel(component, level)
+	}
 	logWriter := zapcore.AddSync(os.Stderr)
 
 	var encoderCfg zapcore.EncoderConfig
@@ -127,7 +230,8 @@ func (l *logger) InitLogger() {
 	}
 
 	encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
-	core := zapcore.NewCore(encoder, logWriter, zap.NewAtomicLevelAt(logLevel))
+	// The levels decide per logger name, so the encoding core itself accepts every level.
+	core := newLevelCore(zapcore.NewCore(encoder, logWriter, zapcore.DebugLevel), l.levels)
 	logger := zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1), zap.AddStacktrace(zapcore.ErrorLevel))
 
 	l.sugarLogger = logger.Sugar()
@@ -0,0 +1,77 @@
+package metric
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+	"sync"
+)
+
+// WriterStatsCollector exports kafka.Writer statistics. Writer.Stats resets its counters on every
+// call, so the collector accumulates them into totals between scrapes.
+type WriterStatsCollector struct {
+	stats func() kafka.WriterStats
+
+	mu     sync.Mutex
+	totals kafka.WriterStats
+
+	writes     *prometheus.Desc
+	messages   *prometheus.Desc
+	bytes      *prometheus.Desc
+	errors     *prometheus.Desc
+	retries    *prometheus.Desc
+	writeTime  *prometheus.Desc
+	waitTime   *prometheus.Desc
+	batchTime  *prometheus.Desc
+	batchSize  *prometheus.Desc
+	batchBytes *prometheus.Desc
+}
+
+func NewWriterStatsCollector(name string, stats func() kafka.WriterStats) *WriterStatsCollector {
+	name = sanitizeName(name) + "_kafka_writer_"
+	return &WriterStatsCollector{
+		stats:      stats,
+		writes:     prometheus.NewDesc(name+"writes_total", "Write requests sent to Kafka.", nil, nil),
+		messages:   prometheus.NewDesc(name+"messages_total", "Messages written to Kafka.", nil, nil),
+		bytes:      prometheus.NewDesc(name+"bytes_total", "Message bytes written to Kafka.", nil, nil),
+		errors:     prometheus.NewDesc(name+"errors_total", "Failed Kafka writes.", nil, nil),
+		retries:    prometheus.NewDesc(name+"retries_total", "Retried Kafka writes.", nil, nil),
+		writeTime:  prometheus.NewDesc(name+"write_seconds_avg", "Average write duration since the last scrape.", nil, nil),
+		waitTime:   prometheus.NewDesc(name+"wait_seconds_avg", "Average wait for a connection since the last scrape.", nil, nil),
+		batchTime:  prometheus.NewDesc(name+"batch_seconds_avg", "Average batch duration since the last scrape.", nil, nil),
+		batchSize:  prometheus.NewDesc(name+"batch_size_avg", "Average messages per batch since the last scrape.", nil, nil),
+		batchBytes: prometheus.NewDesc(name+"batch_bytes_avg", "Average bytes per batch since the last scrape.", nil, nil),
+	}
+}
+
+func (c *WriterStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		c.writes, c.messages, c.bytes, c.errors, c.retries,
+		c.writeTime, c.waitTime, c.batchTime, c.batchSize, c.batchBytes,
+	} {
+		ch <- desc
+	}
+}
+
+func (c *WriterStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+
+	c.mu.Lock()
+	c.totals.Writes += stats.Writes
+	c.totals.Messages += stats.Messages
+	c.totals.Bytes += stats.Bytes
+	c.totals.Errors += stats.Errors
+	c.totals.Retries += stats.Retries
+	totals := c.totals
+	c.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(c.writes, prometheus.CounterValue, float64(totals.Writes))
+	ch <- prometheus.MustNewConstMetric(c.messages, prometheus.CounterValue, float64(totals.Messages))
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.CounterValue, float64(totals.Bytes))
+	ch <- prometheus.MustNewConstMetric(c.errors, prometheus.CounterValue, float64(totals.Errors))
+	ch <- prometheus.MustNewConstMetric(c.retries, prometheus.CounterValue, float64(totals.Retries))
+	ch <- prometheus.MustNewConstMetric(c.writeTime, prometheus.GaugeValue, stats.WriteTime.Avg.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.waitTime, prometheus.GaugeValue, stats.WaitTime.Avg.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.batchTime, prometheus.GaugeValue, stats.BatchTime.Avg.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.batchSize, prometheus.GaugeValue, float64(stats.BatchSize.Avg))
+	ch <- prometheus.MustNewConstMetric(c.batchBytes, prometheus.GaugeValue, float64(stats.BatchBytes.Avg))
+}
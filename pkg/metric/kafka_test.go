@@ -0,0 +1,56 @@
+package metric
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/segmentio/kafka-go"
+	"testing"
+	"time"
+)
+
+// Writer.Stats resets its counters on every call, so the counters of a scrape are the totals of
+// all the calls so far and the averages those of the last call.
+func TestWriterStatsCollector(t *testing.T) {
+	scrapes := []kafka.WriterStats{
+		{Writes: 2, Messages: 5, Bytes: 100, Errors: 1, Retries: 3, BatchSize: kafka.SummaryStats{Avg: 4}},
+		{Writes: 1, Messages: 2, Bytes: 40, WriteTime: kafka.DurationStats{Avg: 20 * time.Millisecond}},
+	}
+	calls := 0
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewWriterStatsCollector("trade-service", func() kafka.WriterStats {
+		stats := scrapes[calls]
+		calls++
+		return stats
+	}))
+
+	cases := []map[string]float64{
+		{
+			"trade_service_kafka_writer_writes_total":      2,
+			"trade_service_kafka_writer_messages_total":    5,
+			"trade_service_kafka_writer_bytes_total":       100,
+			"trade_service_kafka_writer_errors_total":      1,
+			"trade_service_kafka_writer_retries_total":     3,
+			"trade_service_kafka_writer_batch_size_avg":    4,
+			"trade_service_kafka_writer_write_seconds_avg": 0,
+		},
+		{
+			"trade_service_kafka_writer_writes_total":      3,
+			"trade_service_kafka_writer_messages_total":    7,
+			"trade_service_kafka_writer_bytes_total":       140,
+			"trade_service_kafka_writer_errors_total":      1,
+			"trade_service_kafka_writer_retries_total":     3,
+			"trade_service_kafka_writer_batch_size_avg":    0,
+			"trade_service_kafka_writer_write_seconds_avg": 0.02,
+		},
+	}
+	for i, want := range cases {
+		got := gather(t, registry)
+		if len(got) != 10 {
+			t.Errorf("scrape %d: %d metrics, want 10", i+1, len(got))
+		}
+		for name, value := range want {
+			if got[name] != value {
+				t.Errorf("scrape %d: %s = %v, want %v", i+1, name, got[name], value)
+			}
+		}
+	}
+}
@@ -3,20 +3,51 @@ package metric
 import (
 	"github.com/labstack/echo/v4"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"log"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"regexp"
 	"strconv"
 )
 
+var (
+	metricNameReplacer = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+	defaultPublishBuckets = prometheus.ExponentialBuckets(0.001, 2, 14)
+	defaultIngestBuckets  = prometheus.ExponentialBuckets(0.005, 2, 12)
+)
+
 type Metrics interface {
 	IncreaseHits(status int, method, path string)
 	ObserveResponseTime(status int, method, path string, observeTime float64)
+
+	IncreaseTradesReceived(symbol string)
+	IncreaseTradesPublished(symbol string)
+	IncreasePipelineErrors(class string)
+	ObservePublishLatency(symbol string, observeTime float64)
+	ObserveIngestLatency(symbol string, observeTime float64)
+	IncreaseReconnects()
+	AddActiveSubscriptions(delta int)
+
+	IncreaseConfigReloads(result string)
+	IncreaseRestartRequired(setting string)
 }
 
 type PrometheusMetrics struct {
 	HitsTotal prometheus.Counter
 	Hits      *prometheus.CounterVec
 	Times     *prometheus.HistogramVec
+
+	TradesReceived      *prometheus.CounterVec
+	TradesPublished     *prometheus.CounterVec
+	PipelineErrors      *prometheus.CounterVec
+	PublishLatency      *prometheus.HistogramVec
+	IngestLatency       *prometheus.HistogramVec
+	Reconnects          prometheus.Counter
+	ActiveSubscriptions prometheus.Gauge
+
+	ConfigReloads   *prometheus.CounterVec
+	RestartRequired *prometheus.CounterVec
 }
 
 func (promMetric *PrometheusMetrics) IncreaseHits(status int, method, path string) {
@@ -28,13 +59,64 @@ func (promMetric *PrometheusMetrics) ObserveResponseTime(status int, method, pat
 	promMetric.Times.WithLabelValues(strconv.Itoa(status), method, path).Observe(observeTime)
 }
 
-func CreateMetrics(address string, name string) (Metrics, error) {
+func (promMetric *PrometheusMetrics) IncreaseTradesReceived(symbol string) {
+	promMetric.TradesReceived.WithLabelValues(symbol).Inc()
+}
+
+func (promMetric *PrometheusMetrics) IncreaseTradesPublished(symbol string) {
+	promMetric.TradesPublished.WithLabelValues(symbol).Inc()
+}
+
+func (promMetric *PrometheusMetrics) IncreasePipelineErrors(class string) {
+	promMetric.PipelineErrors.WithLabelValues(class).Inc()
+}
+
+func (promMetric *PrometheusMetrics) ObservePublishLatency(symbol string, observeTime float64) {
+	promMetric.PublishLatency.WithLabelValues(symbol).Observe(observeTime)
+}
+
+func (promMetric *PrometheusMetrics) ObserveIngestLatency(symbol string, observeTime float64) {
+	promMetric.IngestLatency.WithLabelValues(symbol).Observe(observeTime)
+}
+
+func (promMetric *PrometheusMetrics) IncreaseReconnects() {
+	promMetric.Reconnects.Inc()
+}
+
+func (promMetric *PrometheusMetrics) AddActiveSubscriptions(delta int) {
+	promMetric.ActiveSubscriptions.Add(float64(delta))
+}
+
+func (promMetric *PrometheusMetrics) IncreaseConfigReloads(result string) {
+	promMetric.ConfigReloads.WithLabelValues(result).Inc()
+}
+
+func (promMetric *PrometheusMetrics) IncreaseRestartRequired(setting string) {
+	promMetric.RestartRequired.WithLabelValues(setting).Inc()
+}
+
+// NewRegistry returns a registry with the Go runtime and process collectors registered.
+func NewRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
+
+// CreateMetrics registers the metrics on registry, prefixed with the service name. Characters not
+// allowed in Prometheus metric names, such as the dashes of a service name, are replaced with
+// underscores. Empty bucket settings fall back to the defaults.
+func CreateMetrics(registry prometheus.Registerer, cfg config.MetricConfig) (Metrics, error) {
+	name := sanitizeName(cfg.ServiceName)
+
 	var promMetric PrometheusMetrics
 	promMetric.HitsTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Name: name + "_hits_total",
 	})
 
-	if err := prometheus.Register(promMetric.HitsTotal); err != nil {
+	if err := registry.Register(promMetric.HitsTotal); err != nil {
 		return nil, err
 	}
 
@@ -42,26 +124,98 @@ func CreateMetrics(address string, name string) (Metrics, error) {
 		Name: name + "_hits",
 	}, []string{"status", "method", "path"})
 
-	if err := prometheus.Register(promMetric.Hits); err != nil {
+	if err := registry.Register(promMetric.Hits); err != nil {
 		return nil, err
 	}
 
 	promMetric.Times = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Name: name + "_times",
+		Name:    name + "_times",
+		Buckets: bucketsOrDefault(cfg.Buckets.Http, prometheus.DefBuckets),
 	}, []string{"status", "method", "path"})
 
-	if err := prometheus.Register(promMetric.Times); err != nil {
+	if err := registry.Register(promMetric.Times); err != nil {
 		return nil, err
 	}
 
-	go func() {
-		router := echo.New()
-		router.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
-		log.Printf("Metrics server is running on port: %s", address)
-		if err := router.Start(address); err != nil {
-			log.Fatal(err)
+	promMetric.TradesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: name + "_trades_received_total",
+		Help: "Trades decoded from the exchange stream.",
+	}, []string{"symbol"})
+	promMetric.TradesPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: name + "_trades_published_total",
+		Help: "Trades written to Kafka.",
+	}, []string{"symbol"})
+	promMetric.PipelineErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: name + "_pipeline_errors_total",
+		Help: "Trade pipeline errors by class (connection, subscribe, decode, publish).",
+	}, []string{"class"})
+	promMetric.PublishLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    name + "_publish_latency_seconds",
+		Help:    "Time to write a trade to Kafka.",
+		Buckets: bucketsOrDefault(cfg.Buckets.Publish, defaultPublishBuckets),
+	}, []string{"symbol"})
+	promMetric.IngestLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    name + "_ingest_latency_seconds",
+		Help:    "Time between the exchange trade time and the frame being received.",
+		Buckets: bucketsOrDefault(cfg.Buckets.Ingest, defaultIngestBuckets),
+	}, []string{"symbol"})
+	promMetric.Reconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: name + "_exchange_reconnects_total",
+		Help: "Reconnects to the exchange after a failed connection.",
+	})
+	promMetric.ActiveSubscriptions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: name + "_active_subscriptions",
+		Help: "Streams currently subscribed on the exchange connection.",
+	})
+	promMetric.ConfigReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: name + "_config_reloads_total",
+		Help: "Configuration reloads by result (applied, partial, unchanged, invalid).",
+	}, []string{"result"})
+	promMetric.RestartRequired = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: name + "_config_restart_required_total",
+		Help: "Changed settings that were not applied because they need a restart.",
+	}, []string{"setting"})
+
+	for _, collector := range []prometheus.Collector{
+		promMetric.TradesReceived,
+		promMetric.TradesPublished,
+		promMetric.PipelineErrors,
+		promMetric.PublishLatency,
+		promMetric.IngestLatency,
+		promMetric.Reconnects,
+		promMetric.ActiveSubscriptions,
+		promMetric.ConfigReloads,
+		promMetric.RestartRequired,
+	} {
+		if err := registry.Register(collector); err != nil {
+			return nil, err
 		}
-	}()
+	}
 
 	return &promMetric, nil
 }
+
+// NewHandler serves the metrics gathered from gatherer in the Prometheus exposition format.
+func NewHandler(gatherer prometheus.Gatherer) echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+}
+
+// NewRouter returns a router exposing the metrics of gatherer on /metrics.
+func NewRouter(gatherer prometheus.Gatherer) *echo.Echo {
+	router := echo.New()
+	router.HideBanner = true
+	router.HidePort = true
+	router.GET("/metrics", NewHandler(gatherer))
+	return router
+}
+
+func bucketsOrDefault(buckets []float64, defaults []float64) []float64 {
+	if len(buckets) == 0 {
+		return defaults
+	}
+	return buckets
+}
+
+func sanitizeName(name string) string {
+	return metricNameReplacer.ReplaceAllString(name, "_")
+}
@@ -0,0 +1,178 @@
+package metric
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// gather scrapes gatherer into the value of every metric, keyed by its name and labels such as
+// name{symbol="BTCUSDT"}. Histograms are keyed by their count.
+func gather(t *testing.T, gatherer prometheus.Gatherer) map[string]float64 {
+	t.Helper()
+	families, err := gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			var labels []string
+			for _, label := range m.GetLabel() {
+				labels = append(labels, label.GetName()+`="`+label.GetValue()+`"`)
+			}
+			key := family.GetName()
+			if len(labels) > 0 {
+				key += "{" + strings.Join(labels, ",") + "}"
+			}
+			switch {
+			case m.GetCounter() != nil:
+				values[key] = m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				values[key] = m.GetGauge().GetValue()
+			case m.GetHistogram() != nil:
+				values[key] = float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return values
+}
+
+func names(values map[string]float64) []string {
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestPipelineMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := CreateMetrics(registry, config.MetricConfig{ServiceName: "trade-service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		metrics.IncreaseTradesReceived("BTCUSDT")
+		metrics.IncreaseTradesPublished("BTCUSDT")
+		metrics.IncreasePipelineErrors("decode")
+		metrics.ObservePublishLatency("BTCUSDT", 0.01)
+		metrics.ObserveIngestLatency("BTCUSDT", 0.2)
+		metrics.IncreaseReconnects()
+		metrics.IncreaseConfigReloads("applied")
+		metrics.IncreaseRestartRequired("server.port")
+		metrics.IncreaseHits(200, "GET", "/api/v1/stats/:symbol")
+		metrics.ObserveResponseTime(200, "GET", "/api/v1/stats/:symbol", 0.001)
+	}
+	metrics.AddActiveSubscriptions(3)
+	metrics.AddActiveSubscriptions(-1)
+
+	want := map[string]float64{
+		`trade_service_trades_received_total{symbol="BTCUSDT"}`:                       2,
+		`trade_service_trades_published_total{symbol="BTCUSDT"}`:                      2,
+		`trade_service_pipeline_errors_total{class="decode"}`:                         2,
+		`trade_service_publish_latency_seconds{symbol="BTCUSDT"}`:                     2,
+		`trade_service_ingest_latency_seconds{symbol="BTCUSDT"}`:                      2,
+		`trade_service_exchange_reconnects_total`:                                     2,
+		`trade_service_active_subscriptions`:                                          2,
+		`trade_service_config_reloads_total{result="applied"}`:                        2,
+		`trade_service_config_restart_required_total{setting="server.port"}`:          2,
+		`trade_service_hits_total`:                                                    2,
+		`trade_service_hits{method="GET",path="/api/v1/stats/:symbol",status="200"}`:  2,
+		`trade_service_times{method="GET",path="/api/v1/stats/:symbol",status="200"}`: 2,
+	}
+	got := gather(t, registry)
+	if len(got) != len(want) {
+		t.Errorf("got metrics %q", names(got))
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s = %v, want %v", name, got[name], value)
+		}
+	}
+}
+
+// buckets returns the upper bounds of the buckets of the histogram family name.
+func buckets(t *testing.T, gatherer prometheus.Gatherer, name string) []float64 {
+	t.Helper()
+	families, err := gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		var bounds []float64
+		for _, bucket := range family.GetMetric()[0].GetHistogram().GetBucket() {
+			bounds = append(bounds, bucket.GetUpperBound())
+		}
+		return bounds
+	}
+	t.Fatalf("no metric %s", name)
+	return nil
+}
+
+func TestMetricBuckets(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := CreateMetrics(registry, config.MetricConfig{
+		ServiceName: "trades",
+		Buckets:     config.MetricBucketsConfig{Http: []float64{0.1, 1}, Publish: []float64{0.005, 0.05}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics.ObserveResponseTime(200, "GET", "/", 0.01)
+	metrics.ObservePublishLatency("BTCUSDT", 0.01)
+	metrics.ObserveIngestLatency("BTCUSDT", 0.01)
+
+	cases := []struct {
+		name string
+		want []float64
+	}{
+		{"trades_times", []float64{0.1, 1}},
+		{"trades_publish_latency_seconds", []float64{0.005, 0.05}},
+		// Without ingest buckets configured the defaults apply.
+		{"trades_ingest_latency_seconds", defaultIngestBuckets},
+	}
+	for _, c := range cases {
+		if got := buckets(t, registry, c.name); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s buckets %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// Every registry takes its own set of metrics, so tests and embedding programs do not share the
+// global one; a registry rejects a second set of the same name.
+func TestCreateMetricsRegistries(t *testing.T) {
+	cfg := config.MetricConfig{ServiceName: "trades"}
+	for i := 0; i < 2; i++ {
+		if _, err := CreateMetrics(prometheus.NewRegistry(), cfg); err != nil {
+			t.Fatalf("registry %d: %v", i+1, err)
+		}
+	}
+
+	registry := prometheus.NewRegistry()
+	if _, err := CreateMetrics(registry, cfg); err != nil {
+		t.Fatal(err)
+	}
+	var already prometheus.AlreadyRegisteredError
+	if _, err := CreateMetrics(registry, cfg); !errors.As(err, &already) {
+		t.Errorf("second registration: %v, want prometheus.AlreadyRegisteredError", err)
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	got := gather(t, NewRegistry())
+	for _, name := range []string{"go_goroutines", "process_start_time_seconds"} {
+		if _, ok := got[name]; !ok {
+			t.Errorf("no %s among %q", name, names(got))
+		}
+	}
+}
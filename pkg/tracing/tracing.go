@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"github.com/sefikcan/read-time-trade/pkg/config"
+	"github.com/sefikcan/read-time-trade/pkg/logger"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/sefikcan/read-time-trade"
+
+// httpPropagator extracts incoming W3C trace context and baggage as well as single and multi
+// header B3 so that callers instrumented with either format join the same trace.
+var httpPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+	b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader|b3.B3SingleHeader)),
+)
+
+// HTTPPropagator returns the propagator used for HTTP requests.
+func HTTPPropagator() propagation.TextMapPropagator {
+	return httpPropagator
+}
+
+// Tracer returns the tracer used for the spans of this service.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// NewTracerProvider exports spans over OTLP/HTTP to cfg.Jaeger.Host and installs the provider and
+// the W3C trace context propagator globally. The provider must be shut down to flush spans.
+func NewTracerProvider(ctx context.Context, cfg *config.Config, log logger.Logger) (*sdktrace.TracerProvider, error) {
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Jaeger.Host)}
+	if cfg.Jaeger.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.Jaeger.ServiceName),
+		semconv.ServiceVersion(cfg.Server.AppVersion),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	providerOptions := []sdktrace.TracerProviderOption{
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Jaeger.SamplingRatio))),
+	}
+	if cfg.Jaeger.LogSpans {
+		providerOptions = append(providerOptions, sdktrace.WithSpanProcessor(&logSpanProcessor{log: log}))
+	}
+
+	provider := sdktrace.NewTracerProvider(providerOptions...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider, nil
+}
+
+// logSpanProcessor logs every finished span, the equivalent of the former jaeger LogSpans option.
+type logSpanProcessor struct {
+	log logger.Logger
+}
+
+func (p *logSpanProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (p *logSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	p.log.Debugf("Span %s traceId: %s spanId: %s duration: %s status: %s",
+		s.Name(), s.SpanContext().TraceID(), s.SpanContext().SpanID(), s.EndTime().Sub(s.StartTime()), s.Status().Code)
+}
+
+func (p *logSpanProcessor) Shutdown(context.Context) error {
+	return nil
+}
+
+func (p *logSpanProcessor) ForceFlush(context.Context) error {
+	return nil
+}
+
+// RecordError marks span as failed with err.
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}